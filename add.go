@@ -0,0 +1,124 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// kindAdded is the kind of the replacers of the blank imports added by add
+// rules, whose old path is empty.
+const kindAdded = "added import"
+
+// validateAdd checks an add rule, matching its source exactly by default.
+func (r *Rule) validateAdd() error {
+	if r.Source == "" || r.Dest != "" || r.Transform != "" || r.Alias != "" {
+		return fmt.Errorf("add rule %s must have a source, and no destination, transform or alias", r.Add)
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = MatchExact
+	case MatchPrefix, MatchExact:
+	case MatchRegex:
+		re, err := regexp.Compile(r.Source)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of add rule %s: %v", r.Source, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown match mode %q of add rule %s", r.Mode, r.Source)
+	}
+	return nil
+}
+
+// additions returns the replacers of the blank imports the add rules
+// require in the golang source file, once rewritten by replacers: a file
+// importing the source of an add rule also imports the path it adds, which
+// may in turn be the source of a later add rule.
+func (r *Rewriter) additions(fset *token.FileSet, path string, file *ast.File, replacers []*replacer) []*replacer {
+	rewritten := make(map[*ast.ImportSpec]*replacer)
+	for _, rp := range replacers {
+		rewritten[rp.spec] = rp
+	}
+
+	// the paths imported by the file once rewritten, along with their first
+	// import
+	imported := make(map[string]*ast.ImportSpec)
+	var paths []string
+	for _, imp := range file.Imports {
+		p := importPath(imp)
+		if rp, ok := rewritten[imp]; ok {
+			if rp.removed {
+				continue
+			}
+			p = rp.newPath
+		}
+		if imported[p] == nil {
+			imported[p] = imp
+			paths = append(paths, p)
+		}
+	}
+
+	var added []*replacer
+	rel := ""
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Add == "" || imported[rule.Add] != nil || !r.appliesTo(rule, path, &rel) {
+			continue
+		}
+		for _, p := range paths {
+			if !rule.matchPattern(rule.Source, p) {
+				continue
+			}
+			added = append(added, &replacer{
+				newPath: rule.Add,
+				name:    "_",
+				newName: "_",
+				rule:    i,
+				kind:    kindAdded,
+				pos:     fset.Position(imported[p].Path.Pos()),
+				added:   true,
+			})
+			imported[rule.Add] = imported[p]
+			paths = append(paths, rule.Add)
+			break
+		}
+	}
+	return added
+}
+
+// hasImportDecl reports whether file has an import declaration importing
+// more than the C pseudo package, to add imports to.
+func hasImportDecl(file *ast.File) bool {
+	for _, imp := range file.Imports {
+		if importPath(imp) != cgoPath {
+			return true
+		}
+	}
+	return false
+}
+
+// addImportsEdit returns the edit adding an import declaration of every
+// import right after the package clause of the golang source src.
+func addImportsEdit(fset *token.FileSet, file *ast.File, src []byte, imports []newImport) textEdit {
+	off := fset.Position(file.Name.End()).Offset
+	if i := strings.IndexByte(string(src[off:]), '\n'); i >= 0 {
+		off += i
+	} else {
+		off = len(src)
+	}
+
+	var b strings.Builder
+	for _, imp := range imports {
+		b.WriteString("\n\nimport ")
+		if imp.name != "" {
+			b.WriteString(imp.name + " ")
+		}
+		b.WriteString(strconv.Quote(imp.path))
+	}
+	return textEdit{start: off, end: off, text: b.String()}
+}
@@ -0,0 +1,136 @@
+package yolk
+
+import "testing"
+
+func TestAddRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		src   string
+		want  string
+	}{
+		{
+			name:  "imported",
+			rules: []Rule{{Source: "corp/sqldriver", Add: "corp/sqltelemetry"}},
+			src: `package a
+
+import (
+	"fmt"
+
+	"corp/sqldriver"
+)
+
+var _ = fmt.Println
+var _ = sqldriver.Open
+`,
+			want: `package a
+
+import (
+	"fmt"
+
+	"corp/sqldriver"
+	_ "corp/sqltelemetry"
+)
+
+var _ = fmt.Println
+var _ = sqldriver.Open
+`,
+		},
+		{
+			name:  "not imported",
+			rules: []Rule{{Source: "corp/sqldriver", Add: "corp/sqltelemetry"}},
+			src: `package a
+
+import "corp/sqldriver/v2"
+
+var _ = sqldriver.Open
+`,
+			want: `package a
+
+import "corp/sqldriver/v2"
+
+var _ = sqldriver.Open
+`,
+		},
+		{
+			name:  "already added",
+			rules: []Rule{{Source: "corp/sqldriver", Add: "corp/sqltelemetry"}},
+			src: `package a
+
+import (
+	"corp/sqldriver"
+	"corp/sqltelemetry"
+)
+
+var _ = sqldriver.Open
+var _ = sqltelemetry.Trace
+`,
+			want: `package a
+
+import (
+	"corp/sqldriver"
+	"corp/sqltelemetry"
+)
+
+var _ = sqldriver.Open
+var _ = sqltelemetry.Trace
+`,
+		},
+		{
+			name:  "prefix",
+			rules: []Rule{{Source: "corp/sqldriver", Add: "corp/sqltelemetry", Mode: MatchPrefix}},
+			src: `package a
+
+import "corp/sqldriver/v2"
+
+var _ = sqldriver.Open
+`,
+			want: `package a
+
+import (
+	"corp/sqldriver/v2"
+	_ "corp/sqltelemetry"
+)
+
+var _ = sqldriver.Open
+`,
+		},
+		{
+			name: "rewritten",
+			rules: []Rule{
+				{Source: "old.corp/sqldriver", Dest: "corp/sqldriver"},
+				{Source: "corp/sqldriver", Add: "corp/sqltelemetry"},
+				{Source: "corp/sqltelemetry", Add: "corp/tracing"},
+			},
+			src: `package a
+
+import "old.corp/sqldriver"
+
+var _ = sqldriver.Open
+`,
+			want: `package a
+
+import (
+	"corp/sqldriver"
+	_ "corp/sqltelemetry"
+	_ "corp/tracing"
+)
+
+var _ = sqldriver.Open
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRuleRewriter(t, tt.rules...)
+			got, err := r.RewriteSource("a.go", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// realiases reports whether the rule changes the name of the import spec,
+// whose path it matches. Blank and dot imports keep their designator.
+func (r *Rule) realiases(spec *ast.ImportSpec) bool {
+	name := importName(spec)
+	return r.Alias != "" && name != r.Alias && name != "_" && name != "."
+}
+
+// applyAliases names the imports of the replacers whose rule sets an alias
+// with it, and renames the qualifiers referring to them. An import keeps its
+// name if the alias is already in use in the file. The returned edits apply
+// the renames to the source.
+func (r *Rewriter) applyAliases(fset *token.FileSet, file *ast.File, replacers []*replacer) []textEdit {
+	var edits []textEdit
+	for _, rp := range replacers {
+		alias := r.rules[rp.rule].Alias
+		if alias == "" || rp.merged || rp.removed || rp.added || rp.name == "_" || rp.name == "." {
+			continue
+		}
+
+		oldName := rp.name
+		if oldName == "" {
+			oldName = assumedName(rp.oldPath)
+		}
+		if oldName != alias && nameInUse(file, alias) {
+			r.Log.Warnf("%s: %s is not imported as %s, which is already in use", rp.pos, rp.newPath, alias)
+			continue
+		}
+
+		rp.newName, rp.aliased = alias, true
+		if oldName == alias {
+			continue
+		}
+		for _, id := range renameQualifier(file, oldName, alias) {
+			off := fset.Position(id.Pos()).Offset
+			edits = append(edits, textEdit{start: off, end: off + len(oldName), text: alias})
+		}
+	}
+	return edits
+}
@@ -0,0 +1,176 @@
+package yolk
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// RewriteZip rewrites the files of the zip archive read from src, such as a
+// module zip served by a module proxy, and writes the archive holding the
+// rewritten files to w. The entries keep their names, order and headers.
+// Files failing to be rewritten are kept as they are, and reported by the
+// Errors returned once the archive is written.
+func (r *Rewriter) RewriteZip(w io.Writer, src io.ReaderAt, size int64) error {
+	return r.rewriteZip(w, src, size, nil)
+}
+
+// rewriteZip is RewriteZip, renaming the entries with rename if not nil,
+// the entries renamed to "" being dropped.
+func (r *Rewriter) rewriteZip(w io.Writer, src io.ReaderAt, size int64, rename func(name string) string) error {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return err
+	}
+
+	name := func(f *zip.File) string {
+		if rename == nil {
+			return f.Name
+		}
+		return rename(f.Name)
+	}
+
+	mem := new(MemFS)
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() || name(f) == "" {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		if err := mem.WriteFile(name(f), data, f.Mode()); err != nil {
+			return err
+		}
+	}
+
+	rerr := r.rewriteArchive(mem)
+	if _, ok := rerr.(Errors); rerr != nil && !ok {
+		return rerr
+	}
+
+	files := mem.Files()
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		hdr := f.FileHeader
+		if hdr.Name = name(f); hdr.Name == "" {
+			continue
+		}
+		data, ok := files[hdr.Name]
+		if !ok {
+			if data, err = readZipFile(f); err != nil {
+				return err
+			}
+		}
+
+		// the sizes and checksum are computed again
+		hdr.CompressedSize64, hdr.UncompressedSize64, hdr.CRC32 = 0, 0, 0
+		fw, err := zw.CreateHeader(&hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// RewriteTarGz rewrites the files of the gzipped tar archive read from src
+// and writes the archive holding the rewritten files to w, as RewriteZip
+// does.
+func (r *Rewriter) RewriteTarGz(w io.Writer, src io.Reader) error {
+	gr, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	// the entries are kept in memory to be written again in order
+	type entry struct {
+		hdr  *tar.Header
+		data []byte
+	}
+	var entries []entry
+
+	mem := new(MemFS)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{hdr, data})
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if err := mem.WriteFile(name, data, hdr.FileInfo().Mode()); err != nil {
+			return err
+		}
+	}
+
+	rerr := r.rewriteArchive(mem)
+	if _, ok := rerr.(Errors); rerr != nil && !ok {
+		return rerr
+	}
+
+	files := mem.Files()
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		if e.hdr.Typeflag == tar.TypeReg {
+			e.data = files[strings.TrimPrefix(e.hdr.Name, "./")]
+			e.hdr.Size = int64(len(e.data))
+		}
+		if err := tw.WriteHeader(e.hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
+
+// rewriteArchive rewrites the files of an archive read into mem, the FS of
+// the rewriter for the run.
+func (r *Rewriter) rewriteArchive(mem *MemFS) error {
+	if r.FS != nil {
+		return fmt.Errorf("archives can't be rewritten with FS set")
+	}
+
+	r.FS = IOFS(mem)
+	defer func() { r.FS = nil }()
+	return r.RewriteDir(".")
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
@@ -0,0 +1,152 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultBackupDir is the conventional BackupDir, relative to the walked
+// directory.
+var DefaultBackupDir = filepath.Join(".yolk", "backups")
+
+// backupLayout is the time layout of the names of the backup runs, which
+// sort in chronological order.
+const backupLayout = "20060102-150405.000"
+
+// resolveBackupDir returns the backup directory of the run walking dir.
+func resolveBackupDir(dir, backupDir string) string {
+	if filepath.IsAbs(backupDir) {
+		return filepath.Clean(backupDir)
+	}
+	return filepath.Join(dir, backupDir)
+}
+
+// writeBackups copies the old content of the changed files among written
+// into a new run of the backup directory, mirroring their path relative to
+// dir, and removes the runs beyond KeepBackups.
+func (r *Rewriter) writeBackups(dir string, written []*fileResult) error {
+	root := resolveBackupDir(dir, r.BackupDir)
+	run := filepath.Join(root, time.Now().Format(backupLayout))
+
+	n := 0
+	for _, res := range written {
+		if res.skipped != "" || bytes.Equal(res.src, res.dst) {
+			continue
+		}
+
+		name := filepath.Join(run, filepath.FromSlash(relPath(dir, res.path)))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name, res.src, res.perm); err != nil {
+			return err
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	r.Log.Infof("%d files backed up in %s", n, run)
+
+	if err := makeIgnoredDir(root); err != nil {
+		return err
+	}
+
+	if r.KeepBackups <= 0 {
+		return nil
+	}
+	runs, err := Backups(dir, r.BackupDir)
+	if err != nil {
+		return err
+	}
+	for len(runs) > r.KeepBackups {
+		if err := os.RemoveAll(filepath.Join(root, runs[0])); err != nil {
+			return err
+		}
+		runs = runs[1:]
+	}
+	return nil
+}
+
+// Backups returns the names of the backup runs in the backup directory of
+// dir, from the oldest to the latest.
+func Backups(dir, backupDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(resolveBackupDir(dir, backupDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []string
+	for _, info := range infos {
+		if _, err := time.Parse(backupLayout, info.Name()); err == nil && info.IsDir() {
+			runs = append(runs, info.Name())
+		}
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// RestoreBackup copies back the files of the backup run of dir, or of its
+// latest run if run is empty, over the files rewritten since.
+func RestoreBackup(dir, backupDir, run string) error {
+	if run == "" {
+		runs, err := Backups(dir, backupDir)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("no backup in %s", resolveBackupDir(dir, backupDir))
+		}
+		run = runs[len(runs)-1]
+	}
+
+	root := filepath.Join(resolveBackupDir(dir, backupDir), run)
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+
+	var errs Errors
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		name := filepath.Join(dir, relPath(root, path))
+		if err := restoreFile(name, path, info.Mode().Perm()); err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// restoreFile replaces the content of name with that of the backup.
+func restoreFile(name, backup string, perm os.FileMode) error {
+	old, err := ioutil.ReadFile(backup)
+	if err != nil {
+		return err
+	}
+
+	cur, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return ioutil.WriteFile(name, old, perm)
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(cur, old) {
+		return nil
+	}
+	return writeFile(name, cur, old, perm)
+}
@@ -0,0 +1,58 @@
+package yolk
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackups(t *testing.T) {
+	files := map[string]string{"a.go": oldSource, "b.go": otherFile, "pkg/c.go": oldSource}
+	dir := t.TempDir()
+
+	if err := RestoreBackup(dir, DefaultBackupDir, ""); err == nil {
+		t.Error("RestoreBackup() without any backup succeeds")
+	}
+
+	for i := 0; i < 3; i++ {
+		writeTree(t, dir, files)
+		r := newMemRewriter(t)
+		r.BackupDir = DefaultBackupDir
+		r.KeepBackups = 2
+		if err := r.RewriteDir(dir); err != nil {
+			t.Fatalf("RewriteDir() fails: %v", err)
+		}
+		// the runs are named after the time they start, to the millisecond
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	runs, err := Backups(dir, DefaultBackupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Backups() = %q, want the 2 latest runs", runs)
+	}
+
+	backup := readTree(t, filepath.Join(dir, DefaultBackupDir, runs[1]))
+	want := map[string]string{"a.go": oldSource, "pkg/c.go": oldSource}
+	if len(backup) != len(want) {
+		t.Errorf("backup run holds %d files, want %d", len(backup), len(want))
+	}
+	for name, data := range want {
+		if backup[name] != data {
+			t.Errorf("backup of %s =\n%s\nwant\n%s", name, backup[name], data)
+		}
+	}
+
+	writeTree(t, dir, map[string]string{"pkg/c.go": otherFile})
+	if err := RestoreBackup(dir, DefaultBackupDir, ""); err != nil {
+		t.Fatalf("RestoreBackup() fails: %v", err)
+	}
+	got := readTree(t, dir)
+	for name, data := range files {
+		if got[name] != data {
+			t.Errorf("restored %s =\n%s\nwant\n%s", name, got[name], data)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest is the content of a batch manifest, listing the repositories
+// rewritten with the same rules and options:
+//
+//	workdir: /tmp/yolk-batch      # where the repositories are cloned
+//	branch: migrate-imports       # branch committed to in every repository
+//	patches: out/patches          # write patches instead of rewriting
+//	reports: out/reports          # JSON summary of every repository
+//	rules:
+//	  - source: github.com/old/repo
+//	    dest: github.com/new/repo
+//	repos:
+//	  - url: https://github.com/corp/api.git
+//	    ref: v1.2.0
+//	  - path: ../svc
+//
+// Relative paths are relative to the directory of the manifest.
+type Manifest struct {
+	Profile `yaml:",inline"`
+
+	// Repos lists the repositories, in the order they are rewritten.
+	Repos []Repo `yaml:"repos"`
+	// Workdir is the directory the repositories are cloned in, the
+	// directory of the manifest by default.
+	Workdir string `yaml:"workdir"`
+	// Branch, if set, is created in every repository before rewriting it,
+	// and the rewritten files are committed to it.
+	Branch string `yaml:"branch"`
+	// Message is the text/template of the commit message, executed with the
+	// summary of the repository. DefaultCommitMessage by default.
+	Message string `yaml:"message"`
+	// Patches, if set, is the directory where a patch of every repository is
+	// written, named after it, instead of rewriting its files.
+	Patches string `yaml:"patches"`
+	// Reports, if set, is the directory where the JSON summary of every
+	// repository is written, named after it.
+	Reports string `yaml:"reports"`
+}
+
+// Repo is a repository of a batch.
+type Repo struct {
+	// Name names the repository in the reports, patches and the workdir.
+	// It defaults to the base name of its URL or path.
+	Name string `yaml:"name"`
+	// URL is cloned into the workdir, unless it is there already.
+	URL string `yaml:"url"`
+	// Path is a local repository, used instead of URL.
+	Path string `yaml:"path"`
+	// Ref, if set, is checked out before rewriting.
+	Ref string `yaml:"ref"`
+}
+
+// RepoResult is the outcome of rewriting a repository of a batch.
+type RepoResult struct {
+	Name    string   `json:"name"`
+	Dir     string   `json:"dir"`
+	Branch  string   `json:"branch,omitempty"`
+	Patch   string   `json:"patch,omitempty"`
+	Summary *Summary `json:"summary,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// LoadManifest reads the batch manifest at path, resolving its relative
+// paths.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, err
+	}
+
+	base := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	m.Workdir = resolve(m.Workdir)
+	if m.Workdir == "" {
+		m.Workdir = base
+	}
+	m.Patches = resolve(m.Patches)
+	m.Reports = resolve(m.Reports)
+
+	names := make(map[string]bool)
+	for i := range m.Repos {
+		repo := &m.Repos[i]
+		if (repo.URL == "") == (repo.Path == "") {
+			return nil, fmt.Errorf("repository %d of %s must have either a url or a path", i+1, path)
+		}
+		repo.Path = resolve(repo.Path)
+		if repo.Name == "" {
+			repo.Name = repoName(repo)
+		}
+		if names[repo.Name] {
+			return nil, fmt.Errorf("repository %s is listed twice in %s, give them distinct names", repo.Name, path)
+		}
+		names[repo.Name] = true
+	}
+
+	return &m, nil
+}
+
+// repoName returns the default name of the repository, the base name of its
+// path or URL without the .git extension.
+func repoName(repo *Repo) string {
+	if repo.Path != "" {
+		return filepath.Base(repo.Path)
+	}
+	name := strings.TrimSuffix(strings.TrimRight(repo.URL, "/"), ".git")
+	return path.Base(strings.Replace(name, ":", "/", -1))
+}
+
+// RewriteBatch rewrites every repository of the manifest in turn, with a
+// rewriter returned by newRewriter to which the rules and options of the
+// manifest are added. A repository failing to be rewritten doesn't stop the
+// batch, its error is part of its result.
+func RewriteBatch(m *Manifest, newRewriter func() *Rewriter) []RepoResult {
+	if newRewriter == nil {
+		newRewriter = NewRewriter
+	}
+
+	results := make([]RepoResult, 0, len(m.Repos))
+	for i := range m.Repos {
+		res := m.rewriteRepo(&m.Repos[i], newRewriter())
+		if err := m.writeReport(res); err != nil && res.Error == "" {
+			res.Error = err.Error()
+		}
+		results = append(results, *res)
+	}
+	return results
+}
+
+// rewriteRepo opens the repository, clones it if needed, and rewrites it
+// with rw.
+func (m *Manifest) rewriteRepo(repo *Repo, rw *Rewriter) *RepoResult {
+	res := &RepoResult{Name: repo.Name, Dir: repo.Path}
+	fail := func(err error) *RepoResult {
+		res.Error = err.Error()
+		return res
+	}
+
+	if err := m.Profile.Apply(rw); err != nil {
+		return fail(err)
+	}
+
+	if repo.Path == "" {
+		res.Dir = filepath.Join(m.Workdir, repo.Name)
+		if _, err := os.Stat(res.Dir); os.IsNotExist(err) {
+			rw.Log.Infof("cloning %s into %s", repo.URL, res.Dir)
+			if err := os.MkdirAll(m.Workdir, 0755); err != nil {
+				return fail(err)
+			}
+			if _, err := git(m.Workdir, "clone", "--quiet", repo.URL, repo.Name); err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	if repo.Ref != "" {
+		if _, err := git(res.Dir, "checkout", "--quiet", repo.Ref); err != nil {
+			return fail(err)
+		}
+	}
+
+	var patch bytes.Buffer
+	if m.Patches != "" {
+		rw.DryRun = true
+		rw.Reporter = &PatchReporter{W: &patch, Root: res.Dir}
+	} else if m.Branch != "" {
+		if err := CheckGitClean(res.Dir); err != nil {
+			return fail(err)
+		}
+		if _, err := git(res.Dir, "checkout", "--quiet", "-B", m.Branch); err != nil {
+			return fail(err)
+		}
+		res.Branch = m.Branch
+	}
+
+	rw.Log.Infof("rewriting %s", repo.Name)
+	err := rw.RewriteDir(res.Dir)
+	summary := rw.Summary()
+	res.Summary = &summary
+	if err != nil {
+		return fail(err)
+	}
+
+	if m.Patches != "" && patch.Len() > 0 {
+		res.Patch = filepath.Join(m.Patches, repo.Name+".patch")
+		if err := os.MkdirAll(m.Patches, 0755); err != nil {
+			return fail(err)
+		}
+		if err := ioutil.WriteFile(res.Patch, patch.Bytes(), 0644); err != nil {
+			return fail(err)
+		}
+	}
+
+	if res.Branch != "" && summary.FilesChanged > 0 {
+		msg := m.Message
+		if msg == "" {
+			msg = DefaultCommitMessage
+		}
+		if err := GitCommit(res.Dir, msg, summary); err != nil {
+			return fail(err)
+		}
+	}
+	return res
+}
+
+// writeReport writes the summary of the repository in the reports
+// directory, if any.
+func (m *Manifest) writeReport(res *RepoResult) error {
+	if m.Reports == "" || res.Summary == nil {
+		return nil
+	}
+	if err := os.MkdirAll(m.Reports, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(m.Reports, res.Name+".json"))
+	if err != nil {
+		return err
+	}
+	if err := res.Summary.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,237 @@
+package yolk
+
+import (
+	"bufio"
+	"bytes"
+	"go/build/constraint"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Operating systems and architectures implied by the file name suffixes,
+// as in foo_linux_amd64.go.
+var (
+	knownOS = toSet("aix android darwin dragonfly freebsd hurd illumos ios js linux nacl netbsd openbsd plan9 solaris wasip1 windows zos")
+
+	knownArch = toSet("386 amd64 amd64p32 arm armbe arm64 arm64be loong64 mips mipsle mips64 mips64le mips64p32 mips64p32le " +
+		"ppc ppc64 ppc64le riscv riscv64 s390 s390x sparc sparc64 wasm")
+)
+
+func toSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// compileBuild parses the build constraint expression of the rule.
+func (r *Rule) compileBuild() error {
+	if r.Build == "" {
+		return nil
+	}
+	expr, err := constraint.Parse("//go:build " + r.Build)
+	if err != nil {
+		return err
+	}
+	r.build = expr
+	return nil
+}
+
+// inBuild reports whether the golang source file may be built with tags
+// satisfying the build constraint of rule, if any, the tags which neither
+// the build constraints of file nor the suffix of its name refer to being
+// unset.
+func (r *Rewriter) inBuild(rule *Rule, file string) bool {
+	if rule.build == nil {
+		return true
+	}
+	r.mu.Lock()
+	expr := r.builds[file]
+	r.mu.Unlock()
+
+	search := &tagSearch{named: make(map[string]bool), values: make(map[string]bool)}
+	if expr != nil {
+		exprTags(expr, search.named)
+	}
+	for tag := range search.named {
+		search.tags = append(search.tags, tag)
+	}
+	sort.Strings(search.tags)
+	return search.satisfiable(expr, rule.build)
+}
+
+// noteBuild records the build constraint of the golang source file path,
+// whose content is src, if some rules are scoped by build constraints.
+func (r *Rewriter) noteBuild(path string, src []byte) {
+	scoped := false
+	for i := range r.rules {
+		scoped = scoped || r.rules[i].build != nil
+	}
+	if !scoped {
+		return
+	}
+
+	expr := fileConstraint(filepath.Base(path), src)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.builds == nil {
+		r.builds = make(map[string]constraint.Expr)
+	}
+	r.builds[path] = expr
+}
+
+// fileConstraint returns the build constraint of the golang source file
+// name, whose content is src: its //go:build line, or else its // +build
+// lines, along with the GOOS and GOARCH of the suffix of its name. It is nil
+// if the file has none. The lines are the line comments before the package
+// clause.
+func fileConstraint(name string, src []byte) constraint.Expr {
+	var expr, plus constraint.Expr
+	for _, tag := range nameTags(name) {
+		expr = andExpr(expr, &constraint.TagExpr{Tag: tag})
+	}
+
+	var build constraint.Expr
+	sc := bufio.NewScanner(bytes.NewReader(src))
+	sc.Buffer(nil, len(src)+1)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "//") {
+			// the package clause, or a block comment which ends the
+			// header as far as build constraints go
+			break
+		}
+		if !constraint.IsGoBuild(line) && !constraint.IsPlusBuild(line) {
+			continue
+		}
+		x, err := constraint.Parse(line)
+		switch {
+		case err != nil:
+		case constraint.IsGoBuild(line):
+			build = x
+		default:
+			plus = andExpr(plus, x)
+		}
+	}
+
+	if build == nil {
+		build = plus
+	}
+	return andExpr(expr, build)
+}
+
+func andExpr(x, y constraint.Expr) constraint.Expr {
+	switch {
+	case x == nil:
+		return y
+	case y == nil:
+		return x
+	}
+	return &constraint.AndExpr{X: x, Y: y}
+}
+
+// nameTags returns the GOOS and GOARCH of the suffix of the file name.
+func nameTags(name string) []string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	elems := strings.Split(name, "_")
+	if len(elems) < 2 {
+		return nil
+	}
+
+	n := len(elems)
+	switch {
+	case n >= 3 && knownOS[elems[n-2]] && knownArch[elems[n-1]]:
+		return elems[n-2:]
+	case knownOS[elems[n-1]], knownArch[elems[n-1]]:
+		return elems[n-1:]
+	}
+	return nil
+}
+
+// exprTags adds the tags expr refers to to tags.
+func exprTags(expr constraint.Expr, tags map[string]bool) {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		tags[x.Tag] = true
+	case *constraint.NotExpr:
+		exprTags(x.X, tags)
+	case *constraint.AndExpr:
+		exprTags(x.X, tags)
+		exprTags(x.Y, tags)
+	case *constraint.OrExpr:
+		exprTags(x.X, tags)
+		exprTags(x.Y, tags)
+	}
+}
+
+// tagSearch looks for the values of the tags of a file satisfying build
+// constraints, the other tags being unset.
+type tagSearch struct {
+	// tags are the tags of the file, in the order they are set, and named
+	// their set.
+	tags  []string
+	named map[string]bool
+	// values are the values of the tags set so far.
+	values map[string]bool
+}
+
+// satisfiable reports whether some values of the tags not set yet satisfy
+// both the build constraint of the file, if not nil, and the one of a rule.
+func (s *tagSearch) satisfiable(file, rule constraint.Expr) bool {
+	v, known := s.eval(rule)
+	if known && !v {
+		return false
+	}
+	if file != nil {
+		fv, fknown := s.eval(file)
+		if fknown && !fv {
+			return false
+		}
+		known = known && fknown
+	}
+	if known {
+		return true
+	}
+
+	tag := s.tags[len(s.values)]
+	defer delete(s.values, tag)
+	for _, value := range []bool{true, false} {
+		s.values[tag] = value
+		if s.satisfiable(file, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// eval evaluates expr with the tags set so far, and whether its value is
+// known with only those.
+func (s *tagSearch) eval(expr constraint.Expr) (value, known bool) {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		if v, ok := s.values[x.Tag]; ok {
+			return v, true
+		}
+		return false, !s.named[x.Tag]
+	case *constraint.NotExpr:
+		v, ok := s.eval(x.X)
+		return !v, ok
+	case *constraint.AndExpr:
+		a, aok := s.eval(x.X)
+		b, bok := s.eval(x.Y)
+		if aok && !a || bok && !b {
+			return false, true
+		}
+		return true, aok && bok
+	case *constraint.OrExpr:
+		a, aok := s.eval(x.X)
+		b, bok := s.eval(x.Y)
+		if aok && a || bok && b {
+			return true, true
+		}
+		return false, aok && bok
+	}
+	return false, true
+}
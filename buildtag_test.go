@@ -0,0 +1,51 @@
+package yolk
+
+import (
+	"testing"
+)
+
+func TestRuleBuild(t *testing.T) {
+	const body = "package a\n\nimport \"old.corp/lib/foo\"\n\nvar _ = foo.X\n"
+
+	tests := []struct {
+		name   string
+		build  string
+		file   string
+		header string
+		want   bool
+	}{
+		{name: "negated tag of an unconstrained file", build: "!cgo", file: "a.go", want: true},
+		{name: "negated tag required by the file", build: "!cgo", file: "a.go", header: "//go:build cgo\n\n", want: false},
+		{name: "negated tag excluded by the file", build: "!cgo", file: "a.go", header: "//go:build !cgo\n\n", want: true},
+		{name: "tag of an unconstrained file", build: "integration", file: "a.go", want: false},
+		{name: "tag required by the file", build: "integration", file: "a.go", header: "//go:build integration\n\n", want: true},
+		{name: "tag among others", build: "integration", file: "a.go", header: "//go:build integration || e2e\n\n", want: true},
+		{name: "tag excluded by the file", build: "linux", file: "a.go", header: "//go:build !linux\n\n", want: false},
+		{name: "plus build lines", build: "integration", file: "a.go", header: "// +build integration e2e\n\n", want: true},
+		{name: "plus build lines and'ed", build: "!e2e", file: "a.go", header: "// +build integration\n// +build e2e\n\n", want: false},
+		{name: "go build line first", build: "e2e", file: "a.go", header: "//go:build integration\n// +build e2e\n\n", want: false},
+		{name: "file name suffix", build: "linux && !cgo", file: "a_linux.go", want: true},
+		{name: "other file name suffix", build: "linux && !cgo", file: "a_windows_amd64.go", want: false},
+		{name: "file name suffix and constraint", build: "linux && !cgo", file: "a_linux.go", header: "//go:build cgo\n\n", want: false},
+		{name: "many tags", build: "linux && !cgo", file: "a.go", header: "//go:build (386 || amd64 || arm || arm64 || loong64 || mips || mips64 || mips64le || mipsle || ppc64 || ppc64le || riscv64 || s390x) && (linux || android) && !purego\n\n", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRewriter()
+			r.FS = IOFS(NewMemFS(nil))
+			if err := r.Add(Rule{Source: "old.corp/lib", Dest: "new.corp/lib", Build: tt.build}); err != nil {
+				t.Fatal(err)
+			}
+
+			src := tt.header + body
+			got, err := r.RewriteSource(tt.file, []byte(src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if rewritten := string(got) != src; rewritten != tt.want {
+				t.Errorf("RewriteSource() rewrites %s: %v, want %v", tt.file, rewritten, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package yolk
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	modpath "golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// majorBump is the module bumped by BumpMajor.
+type majorBump struct {
+	oldPath, newPath string
+
+	// major is the major version of newPath, as v3.
+	major string
+
+	// rule is the index of the rule of the bump.
+	rule int
+}
+
+// NextMajor returns the path of the next major version of the module path,
+// following semantic import versioning: a path without a major version
+// suffix is a v0 or v1 module, followed by path/v2, and path/vN is followed
+// by path/vN+1. The gopkg.in paths have their .vN suffix incremented.
+func NextMajor(path string) (string, error) {
+	prefix, pathMajor, ok := modpath.SplitPathVersion(path)
+	if !ok {
+		return "", fmt.Errorf("invalid module path %s", path)
+	}
+	if pathMajor == "" {
+		return path + "/v2", nil
+	}
+
+	n, err := strconv.Atoi(pathMajor[2:])
+	if err != nil {
+		return "", fmt.Errorf("invalid major version suffix of module path %s", path)
+	}
+	if n < 2 && pathMajor[0] == '/' {
+		return "", fmt.Errorf("invalid major version suffix of module path %s", path)
+	}
+	return fmt.Sprintf("%s%cv%d", prefix, pathMajor[0], n+1), nil
+}
+
+// BumpMajor moves the module modPath to its next major version in the
+// directory dir, as returned by NextMajor: the imports of its packages, the
+// module directive of its go.mod file and the require, exclude and replace
+// directives of the other modules are rewritten, the versions of the
+// directives being bumped to the first version of the new major when they
+// don't match it. The modules with the other major versions of modPath are
+// left alone. An empty modPath bumps the module enclosing dir.
+func (r *Rewriter) BumpMajor(dir, modPath string) error {
+	if modPath == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if modPath = modulePathOf(abs); modPath == "" {
+			return fmt.Errorf("%s is not in a module", dir)
+		}
+	}
+
+	newPath, err := NextMajor(modPath)
+	if err != nil {
+		return err
+	}
+	if err := r.Add(Rule{Source: modPath, Dest: newPath, Mode: MatchPrefix}); err != nil {
+		return err
+	}
+
+	_, pathMajor, _ := modpath.SplitPathVersion(newPath)
+	r.bumped = &majorBump{
+		oldPath: modPath,
+		newPath: newPath,
+		major:   pathMajor[1:],
+		rule:    len(r.rules) - 1,
+	}
+	defer func() { r.bumped = nil }()
+
+	r.Log.Infof("bumping %s to %s", modPath, newPath)
+	r.GoMod = true
+	return r.RewriteDir(dir)
+}
+
+// otherMajor reports whether path belongs to another major version of the
+// module bumped by BumpMajor than the one matched by rule, such as
+// example.com/m/v2/pkg for example.com/m.
+func (r *Rewriter) otherMajor(rule int, path string) bool {
+	b := r.bumped
+	if b == nil || rule != b.rule || !strings.HasPrefix(path, b.oldPath+"/") {
+		return false
+	}
+
+	elem := strings.TrimPrefix(path, b.oldPath+"/")
+	if i := strings.IndexByte(elem, '/'); i >= 0 {
+		elem = elem[:i]
+	}
+	return isMajorVersion(elem)
+}
+
+// bumpVersion returns the version of a directive of the module bumped by
+// BumpMajor, set to the first version of the new major if it doesn't match
+// it already.
+func (b *majorBump) bumpVersion(version string) string {
+	if !semver.IsValid(version) {
+		return version
+	}
+	if semver.Major(version) == b.major && semver.Build(version) != "+incompatible" {
+		return version
+	}
+	return b.major + ".0.0"
+}
@@ -0,0 +1,167 @@
+package yolk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheFile is the path of the cache of the files left unchanged, relative
+// to the walked directory.
+var CacheFile = filepath.Join(".yolk", "cache.json")
+
+// fileCache records the hash of the content of the files a run found
+// nothing to rewrite in, relative to the walked directory, for the rules and
+// options hashed as key. It is safe to be used concurrently.
+type fileCache struct {
+	dir string
+
+	mu      sync.Mutex
+	Key     string            `json:"key"`
+	Files   map[string]string `json:"files"`
+	changed bool
+	hits    int
+}
+
+// cacheKey returns the hash of the rules and of the options changing the
+// content written by the rewriter, or "" if the result of rewriting a file
+// depends on more than its content and path.
+func (r *Rewriter) cacheKey() string {
+	if r.Typed || r.renamed != nil || r.bumped != nil || r.forked != nil {
+		return ""
+	}
+
+	var handlers []string
+	for _, h := range r.custom {
+		handlers = append(handlers, h.Name())
+	}
+	data, err := json.Marshal(struct {
+		Rules              []Rule
+		Handlers           []string
+		FileTypes          []string
+		LocalPrefixes      []string
+		GoMod              bool
+		RenameSelectors    bool
+		AliasPreserve      bool
+		DropImportComments bool
+		GenerateDirectives bool
+		Strings            bool
+		RewriteGenerated   bool
+		FailOnParseError   bool
+		MinimalDiff        bool
+	}{
+		r.rules, handlers, r.FileTypes, r.LocalPrefixes, r.GoMod, r.RenameSelectors, r.AliasPreserve,
+		r.DropImportComments, r.GenerateDirectives, r.Strings, r.RewriteGenerated, r.FailOnParseError, r.MinimalDiff,
+	})
+	if err != nil {
+		return ""
+	}
+	return hashOf(data)
+}
+
+// loadCache returns the cache of dir, emptied if it was written for other
+// rules or options, or nil unless Cache is set for a run on disk.
+func (r *Rewriter) loadCache(dir string) *fileCache {
+	if !r.Cache || r.FS != nil {
+		return nil
+	}
+	key := r.cacheKey()
+	if key == "" {
+		return nil
+	}
+
+	c := &fileCache{dir: dir}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, CacheFile)); err == nil {
+		json.Unmarshal(data, c)
+	}
+	if c.Key != key || c.Files == nil {
+		c.Key, c.Files, c.changed = key, make(map[string]string), true
+	}
+	return c
+}
+
+// clean reports whether the file path with content src was left unchanged
+// by a previous run.
+func (c *fileCache) clean(path string, src []byte) bool {
+	if c == nil {
+		return false
+	}
+	hash := hashOf(src)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Files[relPath(c.dir, path)] != hash {
+		return false
+	}
+	c.hits++
+	return true
+}
+
+// record records whether the file of res was left unchanged, not matching
+// any rule.
+func (c *fileCache) record(res *fileResult) {
+	if c == nil {
+		return
+	}
+	isClean := res.err == nil && res.skipped == "" && len(res.replacers) == 0 && bytes.Equal(res.src, res.dst)
+	rel := relPath(c.dir, res.path)
+
+	var hash string
+	if isClean {
+		hash = hashOf(res.src)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cur, ok := c.Files[rel]; isClean && cur != hash {
+		c.Files[rel], c.changed = hash, true
+	} else if !isClean && ok {
+		delete(c.Files, rel)
+		c.changed = true
+	}
+}
+
+// saveCache saves the cache of the run, unless it is a dry run, which uses
+// the cache but writes nothing in the tree.
+func (r *Rewriter) saveCache() error {
+	if r.DryRun {
+		return nil
+	}
+	return r.cache.save()
+}
+
+// save writes the cache in its directory if it changed, replacing the file
+// at once so that concurrent runs read either cache whole.
+func (c *fileCache) save() error {
+	if c == nil || !c.changed {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	cdir := filepath.Join(c.dir, filepath.Dir(CacheFile))
+	if err := makeIgnoredDir(cdir); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(cdir, "cache-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.dir, CacheFile))
+}
@@ -0,0 +1,63 @@
+package yolk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.go": oldSource, "b.go": otherFile, "pkg/c.go": otherFile})
+
+	steps := []struct {
+		name  string
+		setup func(r *Rewriter)
+		write map[string]string
+		hits  string
+	}{
+		{name: "first run"},
+		{name: "second run", hits: "2 files unchanged"},
+		{name: "third run", hits: "3 files unchanged"},
+		{name: "file changed", write: map[string]string{"b.go": oldSource}, hits: "2 files unchanged"},
+		{name: "dry run", setup: func(r *Rewriter) { r.DryRun = true }, hits: "2 files unchanged"},
+		// the dry run does not record b.go
+		{name: "after dry run", hits: "2 files unchanged"},
+		{
+			name:  "rules changed",
+			setup: func(r *Rewriter) { r.AddRule("old.corp/other", "new.corp/other") },
+		},
+		{name: "no cache", setup: func(r *Rewriter) { r.Cache = false }},
+	}
+
+	for _, step := range steps {
+		writeTree(t, dir, step.write)
+		var log bytes.Buffer
+		r := newMemRewriter(t)
+		r.Cache = true
+		r.Jobs = 4
+		r.Log = &Logger{W: &log, Level: LevelDebug}
+		if step.setup != nil {
+			step.setup(r)
+		}
+		if err := r.RewriteDir(dir); err != nil {
+			t.Fatalf("%s: RewriteDir() fails: %v", step.name, err)
+		}
+
+		hit := strings.Contains(log.String(), "unchanged since a previous run")
+		if step.hits == "" && hit || step.hits != "" && !strings.Contains(log.String(), step.hits) {
+			t.Errorf("%s: RewriteDir() logs\n%s\nwant %q", step.name, log.String(), step.hits)
+		}
+		for name, data := range readTree(t, dir) {
+			if data == oldSource {
+				t.Errorf("%s: %s is left unchanged", step.name, name)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, CacheFile)); err != nil {
+		t.Errorf("cache is not written: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package yolk
+
+import "go/ast"
+
+// cgoPath is the path of the pseudo package of cgo, whose import is
+// preceded by the C preamble of the file in a comment.
+const cgoPath = "C"
+
+// importsC reports whether the import declaration gen imports the cgo
+// pseudo package. Such a declaration is never sorted or printed again, so
+// that the preamble stays attached to the import.
+func importsC(gen *ast.GenDecl) bool {
+	for _, spec := range gen.Specs {
+		if importPath(spec.(*ast.ImportSpec)) == cgoPath {
+			return true
+		}
+	}
+	return false
+}
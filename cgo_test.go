@@ -0,0 +1,51 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// TestRewriteSourceCgo rewrites the files of testdata/cgo, checking the
+// preamble of the import of C is left alone.
+func TestRewriteSourceCgo(t *testing.T) {
+	runGoldenTests(t, "cgo", nil, func(t *testing.T, src, got []byte) {
+		if before, after := cgoPreamble(t, src), cgoPreamble(t, got); after != before {
+			t.Errorf("preamble of the import of C = %q, want %q", after, before)
+		}
+	})
+}
+
+// cgoPreamble returns the preamble of the import of C in the golang source
+// src, failing the test unless C is imported.
+func cgoPreamble(t *testing.T, src []byte) string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			if importPath(imp) != cgoPath || importName(imp) != "" {
+				continue
+			}
+			doc := imp.Doc
+			if doc == nil && !gen.Lparen.IsValid() {
+				doc = gen.Doc
+			}
+			if doc == nil {
+				t.Fatalf("import of C has lost its preamble")
+			}
+			return doc.Text()
+		}
+	}
+	t.Fatalf("import of C is missing")
+	return ""
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/barryz/yolk"
+)
+
+// command is a subcommand of yolk, run with the arguments left once its
+// flags are parsed.
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(fs *flag.FlagSet, o *options)
+	run     func(o *options, args []string)
+
+	// dirs tells the command handles several directories, by repeated -d
+	// flags or as its arguments.
+	dirs bool
+}
+
+// commands lists the subcommands of yolk, rewrite being run when none is
+// given.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "rewrite", args: "[dir...]", summary: "rewrite the import paths matched by the rules in the directories of -d and the arguments, the default command",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, writeFlags, rewriteFlags), run: runRewrite, dirs: true},
+		{name: "check", args: "[dir...]", summary: "list the files which would be changed without rewriting them, and exit with 1 if there are any",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags), run: runCheck, dirs: true},
+		{name: "list", summary: "list the paths matching the rules by rule, as file:line:column, without rewriting them",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags), run: runList},
+		{name: "lint", summary: "check the imports against the policies of the rules file, and exit with 1 if some are denied",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags), run: runLint},
+		{name: "graph", summary: "print the import graph, with the edges matched by the rules",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, graphFlags), run: runGraph},
+		{name: "undo", summary: "revert the files rewritten by the last run in the directory",
+			flags: commonFlags, run: runUndo},
+		{name: "restore", args: "[run]", summary: "copy back the files of the latest or given backup run",
+			flags: flagGroups(commonFlags, restoreFlags), run: runRestore},
+		{name: "test-rules", args: "rules.yaml", summary: "check the rules of a rules file against its tests, the import paths they must replace",
+			flags: commonFlags, run: runTestRules},
+		{name: "rename-package", args: "old/path new/path", summary: "change the import path and name of a package",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, writeFlags), run: runRenamePackage},
+		{name: "mv", args: "old/path new/path", summary: "move the directory of a package and rename it",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, writeFlags), run: runMove},
+		{name: "fork", args: "module[@version] new/path", summary: "copy a module into the directory of new/path and import the copy",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, writeFlags), run: runFork},
+		{name: "shim", args: "old/path new/path", summary: "write a deprecated package at old/path forwarding to the package moved to new/path",
+			flags: flagGroups(commonFlags, dryRunFlags), run: runShim},
+		{name: "bump-major", args: "[module/path]", summary: "move a module, the one of the directory by default, to its next major version",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, writeFlags), run: runBumpMajor},
+		{name: "archive", args: "in.zip|in.tar.gz out", summary: "rewrite the files of a module zip or gzipped tarball into a new archive",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags), run: runArchive},
+		{name: "batch", args: "manifest.yaml", summary: "rewrite the repositories listed in the manifest",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, dryRunFlags), run: runBatch},
+		{name: "serve", summary: "run a language server on stdio with -lsp, or an HTTP API of rewrite jobs with -http",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, serveFlags), run: runServe},
+		{name: "proxy", summary: "run a module proxy serving the modules of an upstream proxy rewritten, to be set as GOPROXY",
+			flags: flagGroups(commonFlags, ruleFlags, optionFlags, proxyFlags), run: runProxy},
+		{name: "completion", args: "bash|zsh|fish", summary: "print the shell completion script of yolk",
+			flags: noFlags, run: runCompletion},
+		{name: "help", args: "[command]", summary: "show the usage of yolk or of a command",
+			flags: noFlags, run: runHelp},
+	}
+}
+
+// lookupCommand returns the command named name.
+func lookupCommand(name string) (*command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// flagSet returns the flag set of the command setting the options o, whose
+// usage is its help.
+func (c *command) flagSet(o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("yolk "+c.name, flag.ContinueOnError)
+	c.flags(fs, o)
+	fs.Usage = func() { c.usage(fs) }
+	return fs
+}
+
+func (c *command) usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: yolk %s", c.name)
+	if c.args != "" {
+		fmt.Fprintf(out, " %s", c.args)
+	}
+	fmt.Fprintf(out, " [options]\n%s\n", c.summary)
+
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	if n > 0 {
+		fmt.Fprint(out, "Options:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// parse parses the flags of the command in args, which may be given before,
+// after or between its arguments, and returns the options they give and the
+// arguments. The arguments following -- are never parsed as flags.
+func (c *command) parse(args []string) (*options, []string) {
+	o := new(options)
+	fs := c.flagSet(o)
+
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(0)
+			}
+			os.Exit(exitFatal)
+		}
+
+		left := fs.Args()
+		if n := len(args) - len(left); n > 0 && args[n-1] == "--" {
+			return c.checkDirs(o, append(rest, left...))
+		}
+		if len(left) == 0 {
+			return c.checkDirs(o, rest)
+		}
+		rest = append(rest, left[0])
+		args = left[1:]
+	}
+}
+
+// checkDirs exits if -d is repeated for a command handling a single
+// directory, and returns o and args.
+func (c *command) checkDirs(o *options, args []string) (*options, []string) {
+	if len(o.dirs) > 1 && !c.dirs {
+		exitOnErr(fmt.Errorf("%s handles a single directory, -d can't be repeated", c.name))
+	}
+	return o, args
+}
+
+// flagGroups returns the registration of all the flags of groups.
+func flagGroups(groups ...func(fs *flag.FlagSet, o *options)) func(fs *flag.FlagSet, o *options) {
+	return func(fs *flag.FlagSet, o *options) {
+		for _, g := range groups {
+			g(fs, o)
+		}
+	}
+}
+
+func noFlags(fs *flag.FlagSet, o *options) {}
+
+// commonFlags registers the flags of the directory and the logging.
+func commonFlags(fs *flag.FlagSet, o *options) {
+	o.dir = "./"
+	fs.Var(dirFlag{o}, "d", "source code directory which to handle, may be repeated by rewrite and check")
+	fs.Var(dirFlag{o}, "dir", "source code directory which to handle, same as -d")
+	fs.BoolVar(&o.verbose, "v", false, "log every changed file")
+	fs.BoolVar(&o.debug, "vv", false, "log every handled and skipped file")
+	fs.BoolVar(&o.quiet, "q", false, "only log errors, without progress")
+	fs.BoolVar(&o.quiet, "quiet", false, "only log errors, without progress, same as -q")
+	fs.StringVar(&o.logFormat, "log-format", "text", "format of the log written to stderr: text or json, one event per line")
+}
+
+// ruleFlags registers the flags of the rules.
+func ruleFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.source, "s", "", "source import path which to replace")
+	fs.StringVar(&o.source, "source", "", "source import path which to replace, same as -s")
+	fs.StringVar(&o.dest, "r", "", "destination import path which to replace")
+	fs.StringVar(&o.dest, "dest", "", "destination import path which to replace, same as -r")
+	fs.StringVar(&o.alias, "alias", "", "name the imports of -s are given, their qualifiers renamed along, without -r to only set it")
+	fs.StringVar(&o.unalias, "unalias", "", "drop the names of the imports of -s, or of every import without it, renaming their qualifiers: always, or versioned for the names holding the major version of the path")
+	fs.Var(&o.excepts, "except", "comma separated import paths left alone by the rules of -s and -m, along with the paths under them")
+	fs.Var(&o.mappings, "m", "comma separated old=new import path mappings, may be repeated")
+	fs.Var(&o.mappings, "map", "comma separated old=new import path mappings, may be repeated, same as -m")
+	fs.Var(&o.embeds, "embed", "comma separated old=new mappings of the moved directories of embedded files, relative to -d, rewriting the //go:embed patterns")
+	fs.StringVar(&o.rulesFile, "f", "", "rules file which holds the replace rules")
+	fs.StringVar(&o.rulesFile, "rules", "", "rules file which holds the replace rules, same as -f")
+	fs.StringVar(&o.profile, "p", "", "profile of the rules file whose rules and options are also applied")
+	fs.StringVar(&o.profile, "profile", "", "profile of the rules file whose rules and options are also applied, same as -p")
+	fs.BoolVar(&o.regex, "regex", false, "treat the sources of -s and -m as regular expressions, groups can be referenced as $1")
+	fs.BoolVar(&o.exact, "exact", false, "only replace import paths equal to the source of -s and -m")
+	fs.BoolVar(&o.reverse, "reverse", false, "swap the source and destination of every rule, undoing a previous migration")
+}
+
+// optionFlags registers the flags of the options of the rewriter and of the
+// summary of the run.
+func optionFlags(fs *flag.FlagSet, o *options) {
+	fs.IntVar(&o.jobs, "j", runtime.NumCPU(), "number of files rewritten concurrently")
+	fs.IntVar(&o.jobs, "jobs", runtime.NumCPU(), "number of files rewritten concurrently, same as -j")
+	fs.IntVar(&o.maxDepth, "max-depth", 0, "number of directory levels walked under every directory, 1 for its own files only, 0 for no limit")
+	fs.Var(&o.maxSize, "max-file-size", "size above which files are skipped, in bytes or followed by K, M or G, 0 for no limit")
+	fs.IntVar(&o.maxFiles, "max-files", 0, "number of files to handle above which the run fails before rewriting any, 0 for no limit")
+	fs.BoolVar(&o.goMod, "gomod", false, "also rewrite the module, require and replace directives of go.mod and go.work files")
+	fs.BoolVar(&o.minDiff, "minimal-diff", false, "only change the lines holding a rewritten import path, without sorting nor formatting the import declarations")
+	fs.BoolVar(&o.strict, "strict", false, "abort at the first file failing to be rewritten and restore the files already rewritten")
+	fs.BoolVar(&o.atomic, "atomic", false, "write the rewritten files only if all of them succeed, restoring all of them if a write fails")
+	fs.BoolVar(&o.typed, "typed", false, "load the packages with go/packages, only rewrite imports of the moved modules and type check the result, restoring all files on new errors")
+	fs.StringVar(&o.verify, "verify", "", "run go build or go vet on the rewritten modules, restoring all files if it fails: build or vet")
+	fs.BoolVar(&o.renameSel, "rename-selectors", false, "rename package qualifiers in code when the package name of a rewritten import changes")
+	fs.BoolVar(&o.aliasKeep, "alias-preserve", false, "alias rewritten imports with their old package name when it changes")
+	fs.BoolVar(&o.prune, "prune-unused", false, "delete the imports of the rewritten files which no code refers to anymore, scanning identifiers without loading types")
+	fs.BoolVar(&o.vendor, "include-vendor", false, "also rewrite vendored source files and vendor/modules.txt")
+	fs.BoolVar(&o.noWork, "ignore-workspace", false, "also rewrite the directories outside of the modules used by the go.work file of -d, as with GOWORK=off")
+	fs.BoolVar(&o.generated, "rewrite-generated", false, "also rewrite files marked with a \"Code generated ... DO NOT EDIT.\" comment")
+	fs.BoolVar(&o.dropICmt, "drop-import-comments", false, "remove the import comments of package clauses instead of rewriting them")
+	fs.BoolVar(&o.genDirs, "generate-directives", false, "also rewrite the paths in //go:generate directives")
+	fs.BoolVar(&o.strLits, "strings", false, "also rewrite string literals holding a matched import path, listing each of them")
+	fs.Var(&o.skipSufx, "skip-suffix", "comma separated file name suffixes which are never rewritten, replacing the default generated code suffixes")
+	fs.Var(&o.excludes, "exclude", "comma separated glob patterns of paths which are not rewritten, may be repeated")
+	fs.Var(&o.includes, "include", "comma separated glob patterns restricting the rewritten files, may be repeated")
+	fs.Var(&o.modules, "module", "comma separated module directories restricting the rewritten files, may be repeated")
+	fs.Var(&o.fileTypes, "types", "comma separated types of the files rewritten: go, proto, bazel, make, docker, defaults to go")
+	fs.Var(&o.locals, "local", "comma separated import path prefixes grouped after third party packages, as goimports -local")
+	fs.StringVar(&o.testdata, "testdata", yolk.TestdataRewrite, "policy for the files under testdata directories: rewrite or skip")
+	fs.StringVar(&o.tests, "tests", yolk.TestsInclude, "policy for the _test.go files: include, only to rewrite nothing else, or skip")
+	fs.BoolVar(&o.parseFail, "fail-on-parse-error", false, "fail the files which don't parse instead of skipping them, except under testdata")
+	fs.BoolVar(&o.unusedErr, "fail-on-unused-rules", false, "exit with 3 if some rules matched no path, to validate the rules in CI")
+	fs.BoolVar(&o.gitignore, "respect-gitignore", true, "skip the untracked paths git ignores when -d is in a git repository")
+	fs.BoolVar(&o.symlinks, "follow-symlinks", false, "walk the directories and rewrite the files reached through symlinks")
+	fs.BoolVar(&o.gitMode, "git", false, "only rewrite files tracked by git, refusing a dirty worktree")
+	fs.BoolVar(&o.force, "force", false, "run on a dirty git worktree")
+	fs.BoolVar(&o.journal, "journal", false, "record the rewritten files, with their old content, in .yolk/journal.json for yolk undo")
+	fs.BoolVar(&o.noCache, "no-cache", false, "rewrite every file, ignoring .yolk/cache.json which records the files found unchanged by previous runs with the same rules")
+	fs.StringVar(&o.backupDir, "backup-dir", "", "directory relative to -d where the old content of rewritten files is kept, in a directory per run, such as .yolk/backups")
+	fs.IntVar(&o.keepBkps, "keep-backups", 0, "number of the latest runs kept in -backup-dir, all of them by default")
+	fs.BoolVar(&o.keepTimes, "preserve-times", false, "keep the modification time of rewritten files")
+	fs.StringVar(&o.report, "report", "text", "format of the summary printed after rewriting: text, json, sarif or none; the diffs of -n go to stderr with json and sarif")
+}
+
+// dryRunFlags registers the flags printing the changes instead of writing
+// them.
+func dryRunFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.dryRun, "n", false, "print the diff of changed files instead of rewriting them")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "print the diff of changed files instead of rewriting them, same as -n")
+}
+
+// writeFlags registers the flags deciding how the changed files are
+// written.
+func writeFlags(fs *flag.FlagSet, o *options) {
+	dryRunFlags(fs, o)
+	fs.BoolVar(&o.explain, "explain", false, "annotate every change with the rule making it and its position in the rules file, ahead of the diff or on stderr")
+	fs.BoolVar(&o.interact, "interactive", false, "show the diff of every changed file and ask whether to write it")
+	fs.StringVar(&o.output, "output", "", "write the changes to a git apply compatible patch instead of rewriting files, as patch=FILE")
+	fs.StringVar(&o.outDir, "out", "", "write the rewritten files to the same paths under this directory, leaving the source tree untouched")
+	fs.BoolVar(&o.fixMod, "fix-mod", false, "run go mod edit in every module after rewriting to rename its module paths")
+	fs.BoolVar(&o.tidy, "tidy", false, "run go mod tidy in every module with rewritten files, after -fix-mod, reporting its output")
+	fs.BoolVar(&o.modVendor, "vendor", false, "run go mod vendor in every module with rewritten files and a vendor directory, after -tidy, reporting its output")
+	fs.BoolVar(&o.gitCommit, "git-commit", false, "commit the rewritten files, implies -git")
+	fs.StringVar(&o.gitMsg, "git-message", yolk.DefaultCommitMessage, "text/template of the -git-commit message, executed with the run summary")
+}
+
+// rewriteFlags registers the flags of the rewrite command only.
+func rewriteFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.check, "check", false, "list files which would be changed without rewriting them, and exit with 1 if there are any, as yolk check does")
+	fs.BoolVar(&o.watch, "watch", false, "keep watching the directory and rewrite files as they are created or modified")
+}
+
+func graphFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.graphFmt, "format", "dot", "format of the graph: dot or json")
+}
+
+func restoreFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.backupDir, "backup-dir", yolk.DefaultBackupDir, "directory relative to -d where the backup runs are kept")
+}
+
+func serveFlags(fs *flag.FlagSet, o *options) {
+	fs.BoolVar(&o.serveLSP, "lsp", false, "run a language server on stdio offering to rewrite the open documents")
+	fs.StringVar(&o.httpAddr, "http", "", "address of an HTTP API planning, applying and rolling back rewrite jobs, on localhost unless it has a host")
+	fs.StringVar(&o.token, "token", os.Getenv("YOLK_TOKEN"), "bearer token the requests of the HTTP API must carry, $YOLK_TOKEN by default, required with -http")
+	fs.Var(&o.roots, "allow-root", "comma separated directories which the jobs of the HTTP API may rewrite, along with their subdirectories, may be repeated, required with -http")
+}
+
+func proxyFlags(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&o.httpAddr, "http", "localhost:8080", "address the module proxy listens on")
+	fs.StringVar(&o.upstream, "upstream", yolk.DefaultUpstream, "URL of the module proxy the modules are fetched from")
+}
+
+// usage prints the commands of yolk.
+func usage() {
+	out := os.Stderr
+	fmt.Fprint(out, "yolk is go source code import statement modifier\n")
+	fmt.Fprint(out, "Usage: yolk <command> [arguments] [options]\n")
+	fmt.Fprint(out, "       yolk [options]   same as yolk rewrite [options]\n")
+	fmt.Fprint(out, "Commands:\n")
+	for _, c := range commands {
+		name := c.name
+		if c.args != "" {
+			name += " " + c.args
+		}
+		fmt.Fprintf(out, "  %-36s %s\n", name, c.summary)
+	}
+	fmt.Fprint(out, "Run yolk help <command> or yolk <command> -h for the options of a command.\n")
+	fmt.Fprint(out, "Exit status: 0 on success, 1 if check finds files to change, lint denied imports or test-rules failing tests, 2 if some files fail to be rewritten or -tidy or -vendor fail, 3 if -fail-on-unused-rules finds unused rules, 255 on fatal errors\n")
+}
+
+func runHelp(o *options, args []string) {
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	c, ok := lookupCommand(args[0])
+	if !ok {
+		exitOnErr(fmt.Errorf("unknown command %q", args[0]))
+	}
+	fs := c.flagSet(new(options))
+	fs.SetOutput(os.Stdout)
+	fs.Usage()
+}
+
+// flagNames returns the names of the flags of the command.
+func (c *command) flagNames() []string {
+	var names []string
+	c.flagSet(new(options)).VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+// commandNames returns the names of the commands, joined by sep.
+func commandNames(sep string) string {
+	names := make([]string, 0, len(commands))
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, sep)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runCompletion prints the completion script of the shell given as
+// argument, completing the commands and the flags of every command.
+func runCompletion(o *options, args []string) {
+	if len(args) != 1 {
+		exitOnErr(fmt.Errorf("completion requires a shell: bash, zsh or fish"))
+	}
+
+	var buf bytes.Buffer
+	switch args[0] {
+	case "bash":
+		bashCompletion(&buf)
+	case "zsh":
+		// zsh runs the bash completion through bashcompinit
+		fmt.Fprint(&buf, "#compdef yolk\n\nautoload -U +X bashcompinit && bashcompinit\n\n")
+		bashCompletion(&buf)
+	case "fish":
+		fishCompletion(&buf)
+	default:
+		exitOnErr(fmt.Errorf("unknown shell %q, want bash, zsh or fish", args[0]))
+	}
+	os.Stdout.Write(buf.Bytes())
+}
+
+func bashCompletion(buf *bytes.Buffer) {
+	fmt.Fprint(buf, "_yolk() {\n")
+	fmt.Fprint(buf, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} cmd=rewrite\n")
+	fmt.Fprint(buf, "\tif [ \"$COMP_CWORD\" -eq 1 ] && [[ $cur != -* ]]; then\n")
+	fmt.Fprintf(buf, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", commandNames(" "))
+	fmt.Fprint(buf, "\t\treturn\n")
+	fmt.Fprint(buf, "\tfi\n")
+	fmt.Fprint(buf, "\t[[ ${COMP_WORDS[1]} != -* ]] && cmd=${COMP_WORDS[1]}\n")
+	fmt.Fprint(buf, "\t[[ $cur == -* ]] || return\n")
+	fmt.Fprint(buf, "\tcase $cmd in\n")
+	for _, c := range commands {
+		if names := c.flagNames(); len(names) > 0 {
+			fmt.Fprintf(buf, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.name, strings.Join(names, " "))
+		}
+	}
+	fmt.Fprint(buf, "\tesac\n")
+	fmt.Fprint(buf, "}\n\n")
+	fmt.Fprint(buf, "complete -o default -F _yolk yolk\n")
+}
+
+func fishCompletion(buf *bytes.Buffer) {
+	fmt.Fprint(buf, "complete -c yolk -f\n")
+	for _, c := range commands {
+		fmt.Fprintf(buf, "complete -c yolk -n __fish_use_subcommand -a %s -d %s\n", c.name, fishQuote(c.summary))
+	}
+	for _, c := range commands {
+		c.flagSet(new(options)).VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(buf, "complete -c yolk -n '__fish_seen_subcommand_from %s' -o %s -d %s\n", c.name, f.Name, fishQuote(f.Usage))
+		})
+	}
+}
+
+// fishQuote returns s single quoted for fish.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/barryz/yolk"
+)
+
+// explainReporter writes the explanations of the changes of the files
+// rewritten with -explain, without their diff.
+type explainReporter struct {
+	w io.Writer
+}
+
+func (e *explainReporter) Report(path string, src, dst []byte) error {
+	return nil
+}
+
+func (e *explainReporter) Explain(path string, changes []yolk.Explanation) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintf(e.w, "%s:%s\n", path, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
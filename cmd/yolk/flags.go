@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// mapping is a single source=destination import path mapping.
+type mapping struct {
+	source string
+	dest   string
+}
+
+// mappingsFlag collects the mappings of repeated -m flags, each of which
+// holds comma separated old=new pairs.
+type mappingsFlag []mapping
+
+func (m *mappingsFlag) String() string {
+	pairs := make([]string, 0, len(*m))
+	for _, mp := range *m {
+		pairs = append(pairs, mp.source+"="+mp.dest)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *mappingsFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("invalid mapping %q, want old=new", pair)
+		}
+		*m = append(*m, mapping{source: kv[0], dest: kv[1]})
+	}
+	return nil
+}
+
+// listFlag collects the values of repeated flags, each of which holds comma
+// separated values.
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func (l *listFlag) String() string {
+	return strings.Join(l.values, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	l.set = true
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l.values = append(l.values, v)
+		}
+	}
+	return nil
+}
+
+// dirFlag is the directory of -d, the first one if it is repeated, every
+// repetition adding a directory to dirs for the commands handling several.
+type dirFlag struct {
+	o *options
+}
+
+func (d dirFlag) String() string {
+	if d.o == nil {
+		return ""
+	}
+	return d.o.dir
+}
+
+func (d dirFlag) Set(value string) error {
+	d.o.dirs = append(d.o.dirs, value)
+	d.o.dir = d.o.dirs[0]
+	return nil
+}
+
+// sizeFlag is a size in bytes, which may be followed by a K, M or G unit of
+// 1024 bytes and its powers.
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *sizeFlag) Set(value string) error {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+	text, unit := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	if n := len(text); n > 0 && units[text[n-1:]] != 0 {
+		text, unit = text[:n-1], units[text[n-1:]]
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, want bytes or a number of K, M or G", value)
+	}
+	*s = sizeFlag(n * unit)
+	return nil
+}
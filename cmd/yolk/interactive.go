@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/barryz/yolk"
+)
+
+const promptHelp = `y - write this file
+n - do not write this file
+a - write this file and all the later ones
+q - quit, writing neither this file nor the later ones
+`
+
+// prompter asks whether to write every changed file, showing its diff, as
+// git add -p does.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	all bool
+}
+
+func (p *prompter) confirm(path string, src, dst []byte) (bool, error) {
+	if p.all {
+		return true, nil
+	}
+
+	p.out.Write(yolk.Diff(path, src, dst))
+	for {
+		fmt.Fprintf(p.out, "Write %s [y,n,a,q,?]? ", path)
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(p.out)
+			return false, yolk.ErrStop
+		}
+
+		switch strings.TrimSpace(line) {
+		case "y":
+			return true, nil
+		case "n":
+			return false, nil
+		case "a":
+			p.all = true
+			return true, nil
+		case "q":
+			return false, yolk.ErrStop
+		default:
+			fmt.Fprint(p.out, promptHelp)
+		}
+	}
+}
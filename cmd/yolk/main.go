@@ -0,0 +1,926 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/barryz/yolk"
+)
+
+// options is the configuration given by the flags of a command.
+type options struct {
+	dir       string
+	dirs      []string
+	source    string
+	dest      string
+	rulesFile string
+	logFormat string
+	profile   string
+	graphFmt  string
+	testdata  string
+	tests     string
+	alias     string
+	unalias   string
+	backupDir string
+	verify    string
+	httpAddr  string
+	upstream  string
+	token     string
+	gitMsg    string
+	output    string
+	outDir    string
+	report    string
+	dryRun    bool
+	regex     bool
+	exact     bool
+	jobs      int
+	maxFiles  int
+	maxDepth  int
+	maxSize   sizeFlag
+	goMod     bool
+	fixMod    bool
+	tidy      bool
+	modVendor bool
+	watch     bool
+	check     bool
+	strict    bool
+	minDiff   bool
+	atomic    bool
+	renameSel bool
+	aliasKeep bool
+	prune     bool
+	vendor    bool
+	noWork    bool
+	generated bool
+	dropICmt  bool
+	genDirs   bool
+	strLits   bool
+	skipSufx  listFlag
+	excludes  listFlag
+	excepts   listFlag
+	includes  listFlag
+	modules   listFlag
+	roots     listFlag
+	symlinks  bool
+	interact  bool
+	journal   bool
+	noCache   bool
+	reverse   bool
+	verbose   bool
+	debug     bool
+	quiet     bool
+	serveLSP  bool
+	keepBkps  int
+	keepTimes bool
+	parseFail bool
+	unusedErr bool
+	gitignore bool
+	typed     bool
+	locals    listFlag
+	fileTypes listFlag
+	gitMode   bool
+	gitCommit bool
+	force     bool
+	mappings  mappingsFlag
+	explain   bool
+	embeds    mappingsFlag
+}
+
+const (
+	// exitChanged is the exit status of -check when files would be changed,
+	// of lint when imports are denied and of test-rules when tests fail.
+	exitChanged = 1
+	// exitFailed is the exit status when some files fail to be rewritten.
+	exitFailed = 2
+	// exitUnused is the exit status of -fail-on-unused-rules when some rules
+	// matched no path.
+	exitUnused = 3
+	// exitFatal is the exit status when the run is aborted.
+	exitFatal = 255
+)
+
+func exitOnErr(err error) {
+	log.Println(err)
+	os.Exit(exitFatal)
+}
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime)
+
+	name, args := "rewrite", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		usage()
+		return
+	}
+
+	c, ok := lookupCommand(name)
+	if !ok {
+		usage()
+		exitOnErr(fmt.Errorf("unknown command %q", name))
+	}
+	o, args := c.parse(args)
+	c.run(o, args)
+}
+
+// setup checks the flags shared by the commands rewriting a directory, and
+// returns the logger and the match mode of the rules they give.
+func setup(o *options) (*yolk.Logger, yolk.MatchMode) {
+	switch o.report {
+	case "text", "json", "sarif", "none":
+	default:
+		exitOnErr(fmt.Errorf("unknown report format %q", o.report))
+	}
+
+	switch o.logFormat {
+	case yolk.LogText, yolk.LogJSON:
+	default:
+		exitOnErr(fmt.Errorf("unknown log format %q", o.logFormat))
+	}
+
+	if o.renameSel && o.aliasKeep {
+		exitOnErr(fmt.Errorf("-rename-selectors and -alias-preserve can't be used together"))
+	}
+
+	if o.regex && o.exact {
+		exitOnErr(fmt.Errorf("-regex and -exact can't be used together"))
+	}
+
+	mode := yolk.MatchPrefix
+	switch {
+	case o.regex:
+		mode = yolk.MatchRegex
+	case o.exact:
+		mode = yolk.MatchExact
+	}
+
+	o.gitMode = o.gitMode || o.gitCommit
+	if o.gitMode && !o.force {
+		if err := yolk.CheckGitClean(o.dir); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	return newLogger(o), mode
+}
+
+// requireArgs exits unless args holds between min and max arguments, what
+// describing them.
+func requireArgs(name string, args []string, min, max int, what string) {
+	switch {
+	case len(args) > 0 && max == 0:
+		exitOnErr(fmt.Errorf("%s takes no arguments, got %s", name, strings.Join(args, " ")))
+	case len(args) < min || len(args) > max:
+		exitOnErr(fmt.Errorf("%s requires %s", name, what))
+	}
+}
+
+func runRewrite(o *options, args []string) {
+	// the directories of the arguments are added to those of -d, which
+	// defaults to the current one without any
+	dirs := append(o.dirs, args...)
+	if len(dirs) == 0 {
+		dirs = []string{o.dir}
+	}
+	o.dir, o.dirs = dirs[0], dirs
+	if len(dirs) > 1 && (o.watch || o.outDir != "" || o.output != "" || o.gitCommit) {
+		exitOnErr(fmt.Errorf("-watch, -out, -output and -git-commit handle a single directory"))
+	}
+
+	rewrite(o, true, func(rw *yolk.Rewriter) error {
+		if o.watch {
+			done := make(chan struct{})
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sig
+				close(done)
+			}()
+
+			if err := rw.Watch(o.dir, done); err != nil {
+				exitOnErr(err)
+			}
+			os.Exit(0)
+		}
+		return rewriteDirs(rw, o.dirs, o.strict)
+	})
+}
+
+// roots returns the directories of the run, the one of -d by default.
+func roots(o *options) []string {
+	if len(o.dirs) == 0 {
+		return []string{o.dir}
+	}
+	return o.dirs
+}
+
+// rewriteDirs rewrites every directory of dirs in turn, the failures of the
+// files of all of them being returned together. In strict mode the
+// directories left are skipped after a failure.
+func rewriteDirs(rw *yolk.Rewriter, dirs []string, strict bool) error {
+	var errs yolk.Errors
+	for _, dir := range dirs {
+		err := rw.RewriteDir(dir)
+		if ferrs, ok := err.(yolk.Errors); ok && !strict {
+			errs = append(errs, ferrs...)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func runCheck(o *options, args []string) {
+	o.check = true
+	runRewrite(o, args)
+}
+
+func runRenamePackage(o *options, args []string) {
+	requireArgs("rename-package", args, 2, 2, "the old and new import paths")
+	rewrite(o, false, func(rw *yolk.Rewriter) error {
+		return rw.RenamePackage(o.dir, args[0], args[1])
+	})
+}
+
+func runMove(o *options, args []string) {
+	requireArgs("mv", args, 2, 2, "the old and new import paths")
+	rewrite(o, false, func(rw *yolk.Rewriter) error {
+		return rw.MovePackage(o.dir, args[0], args[1])
+	})
+}
+
+func runFork(o *options, args []string) {
+	requireArgs("fork", args, 2, 2, "the module path and the new import path")
+	rewrite(o, false, func(rw *yolk.Rewriter) error {
+		return rw.Fork(o.dir, args[0], args[1])
+	})
+}
+
+func runShim(o *options, args []string) {
+	requireArgs("shim", args, 2, 2, "the old and new import paths")
+	rw := yolk.NewRewriter()
+	rw.Log = newLogger(o)
+	if o.dryRun {
+		rw.DryRun = true
+		rw.Reporter = &yolk.DiffReporter{W: diffOutput(o)}
+	}
+	if err := rw.Shim(o.dir, args[0], args[1]); err != nil {
+		exitOnErr(err)
+	}
+}
+
+func runBumpMajor(o *options, args []string) {
+	requireArgs("bump-major", args, 0, 1, "at most one module path")
+	modPath := ""
+	if len(args) > 0 {
+		modPath = args[0]
+	}
+	rewrite(o, false, func(rw *yolk.Rewriter) error {
+		return rw.BumpMajor(o.dir, modPath)
+	})
+}
+
+// diffOutput returns where the diffs of a dry run are written: stdout,
+// unless the JSON or SARIF report is written there.
+func diffOutput(o *options) io.Writer {
+	if o.report == "json" || o.report == "sarif" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// rewrite runs do with the rewriter of the flags, the implicit rule of -s
+// and -r included if asked, then reports the summary of the run and exits
+// with its status.
+func rewrite(o *options, implicit bool, do func(rw *yolk.Rewriter) error) {
+	logger, mode := setup(o)
+	rw := newRewriter(o, logger, mode, implicit)
+	if o.interact {
+		p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+		rw.Confirm = p.confirm
+	}
+	if o.dryRun {
+		rw.DryRun = true
+		rw.Reporter = &yolk.DiffReporter{W: diffOutput(o)}
+	}
+	if o.check {
+		rw.DryRun = true
+		// the JSON and SARIF reports list the files on stdout already
+		if o.report != "json" && o.report != "sarif" {
+			rw.Reporter = &yolk.ListReporter{W: os.Stdout}
+		}
+	}
+	if o.output != "" {
+		kv := strings.SplitN(o.output, "=", 2)
+		if len(kv) != 2 || kv[0] != "patch" || kv[1] == "" {
+			exitOnErr(fmt.Errorf("invalid output %q, want patch=FILE", o.output))
+		}
+
+		f, err := os.Create(kv[1])
+		if err != nil {
+			exitOnErr(err)
+		}
+		defer f.Close()
+
+		rw.DryRun = true
+		rw.Reporter = &yolk.PatchReporter{W: f, Root: o.dir}
+	}
+	if o.outDir != "" {
+		// go mod edit and git work on the tree of -d, which is left alone
+		if o.fixMod || o.gitCommit {
+			exitOnErr(fmt.Errorf("-out can't be used with -fix-mod or -git-commit"))
+		}
+		rw.FS = yolk.OutDir(o.dir, o.outDir)
+		// there is nothing to undo in the source tree
+		rw.Journal = false
+	}
+
+	if o.explain {
+		rw.Explain = true
+		if rw.Reporter == nil {
+			rw.Reporter = &explainReporter{w: os.Stderr}
+		}
+	}
+
+	err := do(rw)
+	if _, ok := err.(yolk.Errors); err != nil && !ok {
+		exitOnErr(err)
+	}
+
+	// files are restored after a strict or atomic failure, leave the modules
+	// alone too
+	modFailed := false
+	if !((o.strict || o.atomic) && err != nil) {
+		if o.fixMod {
+			for _, dir := range roots(o) {
+				if err := rw.FixModules(dir); err != nil {
+					exitOnErr(err)
+				}
+			}
+		}
+		if o.tidy || o.modVendor {
+			if err := rw.RunModCommands(); err != nil {
+				rw.Log.Errorf("%v", err)
+				modFailed = true
+			}
+		}
+	}
+
+	summary := rw.Summary()
+	if n := countSkipped(summary, yolk.SkipSymlink); n > 0 {
+		rw.Log.Warnf("%d symlinks skipped, use -follow-symlinks to rewrite them", n)
+	}
+	unused := warnUnused(rw, summary)
+
+	if o.gitCommit && err == nil && !rw.DryRun && summary.FilesChanged > 0 {
+		if err := yolk.GitCommit(o.dir, o.gitMsg, summary); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	switch o.report {
+	case "text":
+		summary.WriteText(os.Stderr)
+	case "json":
+		summary.WriteJSON(os.Stdout)
+	case "sarif":
+		summary.WriteSARIF(os.Stdout, o.dir)
+	case "none":
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	switch {
+	case summary.FilesFailed > 0 || modFailed:
+		os.Exit(exitFailed)
+	case o.unusedErr && unused:
+		os.Exit(exitUnused)
+	case o.check && summary.FilesChanged > 0:
+		os.Exit(exitChanged)
+	}
+}
+
+func runGraph(o *options, args []string) {
+	requireArgs("graph", args, 0, 0, "")
+	if o.graphFmt != "dot" && o.graphFmt != "json" {
+		exitOnErr(fmt.Errorf("unknown graph format %q", o.graphFmt))
+	}
+
+	logger, mode := setup(o)
+	rw := newRewriter(o, logger, mode, false)
+	g, err := rw.Graph(o.dir)
+	if err != nil {
+		exitOnErr(err)
+	}
+	if o.graphFmt == "json" {
+		err = g.WriteJSON(os.Stdout)
+	} else {
+		err = g.WriteDOT(os.Stdout)
+	}
+	if err != nil {
+		exitOnErr(err)
+	}
+}
+
+func runList(o *options, args []string) {
+	requireArgs("list", args, 0, 0, "")
+	if o.report == "sarif" {
+		exitOnErr(fmt.Errorf("list reports are text, json or none"))
+	}
+
+	logger, mode := setup(o)
+	list(o, newRewriter(o, logger, mode, true))
+}
+
+func runTestRules(o *options, args []string) {
+	requireArgs("test-rules", args, 1, 1, "the rules file")
+	cfg, err := yolk.LoadConfig(args[0])
+	if err != nil {
+		exitOnErr(err)
+	}
+	results, err := cfg.TestRules()
+	if err != nil {
+		exitOnErr(err)
+	}
+
+	failed := 0
+	for _, res := range results {
+		name := res.Path
+		if res.File != "" {
+			name += " in " + res.File
+		}
+		if res.Profile != "" {
+			name = res.Profile + ": " + name
+		}
+		rule := res.Rule
+		if rule == "" {
+			rule = "no rule"
+		}
+
+		if res.Failed() {
+			failed++
+			fmt.Printf("FAIL %s: got %s by %s, want %s\n", name, res.Got, rule, res.Want)
+		} else if o.verbose {
+			fmt.Printf("ok   %s: %s by %s\n", name, res.Got, rule)
+		}
+	}
+	fmt.Printf("%d tests, %d failed\n", len(results), failed)
+	if failed > 0 {
+		os.Exit(exitChanged)
+	}
+}
+
+func runLint(o *options, args []string) {
+	requireArgs("lint", args, 0, 0, "")
+	if o.report == "sarif" {
+		exitOnErr(fmt.Errorf("lint reports are text, json or none"))
+	}
+
+	logger, mode := setup(o)
+	rw := newRewriter(o, logger, mode, false)
+	violations, err := rw.Lint(o.dir)
+	if err != nil {
+		exitOnErr(err)
+	}
+
+	switch o.report {
+	case "text":
+		for _, v := range violations {
+			fmt.Println(v)
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if violations == nil {
+			violations = []yolk.Violation{}
+		}
+		enc.Encode(violations)
+	}
+	if len(violations) > 0 {
+		os.Exit(exitChanged)
+	}
+}
+
+func runServe(o *options, args []string) {
+	requireArgs("serve", args, 0, 0, "")
+	if o.serveLSP == (o.httpAddr != "") {
+		exitOnErr(fmt.Errorf("serve requires either -lsp or -http"))
+	}
+
+	logger, mode := setup(o)
+	if o.httpAddr != "" {
+		if o.token == "" || len(o.roots.values) == 0 {
+			exitOnErr(fmt.Errorf("serve -http requires a token, from -token or $YOLK_TOKEN, and the -allow-root directories"))
+		}
+		srv := &yolk.Server{
+			NewRewriter: func() *yolk.Rewriter { return newRewriter(o, logger, mode, false) },
+			Token:       o.token,
+			Roots:       o.roots.values,
+		}
+		// jobs rewrite directories of this host, which other hosts only
+		// reach when asked explicitly
+		addr := o.httpAddr
+		if strings.HasPrefix(addr, ":") {
+			addr = "localhost" + addr
+		}
+		logger.Infof("serving rewrite jobs on %s", addr)
+		if err := srv.ListenAndServe(addr); err != nil {
+			exitOnErr(err)
+		}
+		return
+	}
+
+	rw := newRewriter(o, logger, mode, false)
+	if err := rw.ServeLSP(os.Stdin, os.Stdout); err != nil {
+		exitOnErr(err)
+	}
+}
+
+func runProxy(o *options, args []string) {
+	requireArgs("proxy", args, 0, 0, "")
+
+	logger, mode := setup(o)
+	// the rules are checked once before serving
+	newRewriter(o, logger, mode, false)
+	proxy := &yolk.Proxy{
+		Upstream: o.upstream,
+		NewRewriter: func() *yolk.Rewriter {
+			return newMemRewriter(o, logger, mode, false)
+		},
+	}
+	logger.Infof("serving the modules of %s on %s", o.upstream, o.httpAddr)
+	if err := http.ListenAndServe(o.httpAddr, proxy); err != nil {
+		exitOnErr(err)
+	}
+}
+
+func runBatch(o *options, args []string) {
+	requireArgs("batch", args, 1, 1, "a manifest")
+	if o.report == "sarif" {
+		exitOnErr(fmt.Errorf("batch reports are text, json or none"))
+	}
+
+	logger, mode := setup(o)
+	batch(o, args[0], logger, mode)
+}
+
+func runArchive(o *options, args []string) {
+	requireArgs("archive", args, 2, 2, "the input and output archives")
+	if o.report == "sarif" {
+		exitOnErr(fmt.Errorf("archive reports are text, json or none"))
+	}
+
+	logger, mode := setup(o)
+	rw := newMemRewriter(o, logger, mode, true)
+
+	err := rewriteArchive(rw, args[0], args[1])
+	if _, ok := err.(yolk.Errors); err != nil && !ok {
+		exitOnErr(err)
+	}
+
+	summary := rw.Summary()
+	unused := warnUnused(rw, summary)
+	switch o.report {
+	case "text":
+		summary.WriteText(os.Stderr)
+	case "json":
+		summary.WriteJSON(os.Stdout)
+	case "none":
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	switch {
+	case summary.FilesFailed > 0:
+		os.Exit(exitFailed)
+	case o.unusedErr && unused:
+		os.Exit(exitUnused)
+	}
+}
+
+// rewriteArchive writes the archive in with its files rewritten by rw to
+// out, both zip or gzipped tar files as told by their extension.
+func rewriteArchive(rw *yolk.Rewriter, in, out string) error {
+	isZip := func(name string) bool { return strings.HasSuffix(name, ".zip") }
+	isTarGz := func(name string) bool { return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") }
+	switch {
+	case isZip(in) && !isZip(out), isTarGz(in) && !isTarGz(out):
+		return fmt.Errorf("%s and %s are not archives of the same format", in, out)
+	case !isZip(in) && !isTarGz(in):
+		return fmt.Errorf("unknown archive format of %s, want .zip, .tar.gz or .tgz", in)
+	}
+
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if isZip(in) {
+		err = rw.RewriteZip(dst, src, info.Size())
+	} else {
+		err = rw.RewriteTarGz(dst, src)
+	}
+	if cerr := dst.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	if _, ok := err.(yolk.Errors); err != nil && !ok {
+		os.Remove(out)
+	}
+	return err
+}
+
+// list prints the paths matched by the rules of rw in the directory, grouped
+// by rule, without rewriting any file.
+func list(o *options, rw *yolk.Rewriter) {
+	rw.DryRun = true
+	rw.Reporter = nil
+	rw.Journal = false
+	rw.BackupDir = ""
+
+	err := rw.RewriteDir(o.dir)
+	if _, ok := err.(yolk.Errors); err != nil && !ok {
+		exitOnErr(err)
+	}
+
+	summary := rw.Summary()
+	unused := warnUnused(rw, summary)
+	switch o.report {
+	case "text":
+		summary.WriteEdits(os.Stdout)
+	case "json":
+		summary.WriteJSON(os.Stdout)
+	case "none":
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	switch {
+	case summary.FilesFailed > 0:
+		os.Exit(exitFailed)
+	case o.unusedErr && unused:
+		os.Exit(exitUnused)
+	}
+}
+
+// warnUnused logs a warning for every rule of the summary which matched no
+// path, and reports whether there is any.
+func warnUnused(rw *yolk.Rewriter, summary yolk.Summary) bool {
+	unused := summary.UnusedRules()
+	for _, rule := range unused {
+		rw.Log.Warnf("rule %s matched no path", rule)
+	}
+	return len(unused) > 0
+}
+
+// newMemRewriter returns the rewriter of newRewriter for the commands which
+// rewrite files in memory, leaving nothing to undo on disk.
+func newMemRewriter(o *options, logger *yolk.Logger, mode yolk.MatchMode, implicit bool) *yolk.Rewriter {
+	rw := newRewriter(o, logger, mode, implicit)
+	rw.Journal = false
+	return rw
+}
+
+// newRewriter returns a rewriter with the options and rules given on the
+// command line, without its reporter. The implicit rule of -s and -r is
+// added even if they are not given, when no other rule is.
+func newRewriter(o *options, logger *yolk.Logger, mode yolk.MatchMode, implicit bool) *yolk.Rewriter {
+	rw := yolk.NewRewriter()
+	rw.Log = logger
+	rw.Jobs = o.jobs
+	rw.MaxFileSize = int64(o.maxSize)
+	rw.MaxFiles = o.maxFiles
+	rw.MaxDepth = o.maxDepth
+	rw.GoMod = o.goMod
+	rw.Tidy = o.tidy
+	rw.Vendor = o.modVendor
+	rw.Strict = o.strict
+	rw.MinimalDiff = o.minDiff
+	rw.Atomic = o.atomic
+	rw.Typed = o.typed
+	rw.Verify = o.verify
+	rw.RenameSelectors = o.renameSel
+	rw.AliasPreserve = o.aliasKeep
+	rw.PruneUnused = o.prune
+	rw.IncludeVendor = o.vendor
+	rw.IgnoreWorkspace = o.noWork
+	rw.Testdata = o.testdata
+	rw.Tests = o.tests
+	rw.FailOnParseError = o.parseFail
+	rw.RewriteGenerated = o.generated
+	rw.DropImportComments = o.dropICmt
+	rw.GenerateDirectives = o.genDirs
+	rw.Strings = o.strLits
+	if o.skipSufx.set {
+		rw.SkipSuffixes = o.skipSufx.values
+	}
+	rw.Exclude = o.excludes.values
+	rw.Include = o.includes.values
+	rw.Modules = o.modules.values
+	rw.FollowSymlinks = o.symlinks
+	rw.Journal = o.journal
+	rw.Cache = !o.noCache
+	rw.BackupDir = o.backupDir
+	rw.PreserveTimes = o.keepTimes
+	rw.KeepBackups = o.keepBkps
+	rw.LocalPrefixes = o.locals.values
+	rw.GitTracked = o.gitMode
+	rw.RespectGitignore = o.gitignore
+	rw.FileTypes = o.fileTypes.values
+
+	if o.rulesFile != "" {
+		cfg, err := yolk.LoadConfig(o.rulesFile)
+		if err != nil {
+			exitOnErr(err)
+		}
+		if o.profile != "" {
+			err = cfg.ApplyProfile(rw, o.profile)
+		} else {
+			err = cfg.Apply(rw)
+		}
+		if err != nil {
+			exitOnErr(err)
+		}
+	} else if o.profile != "" {
+		exitOnErr(fmt.Errorf("-p requires a rules file given by -f"))
+	}
+
+	if o.unalias != "" {
+		rule := yolk.Rule{Source: o.source, Unalias: o.unalias, Except: o.excepts.values}
+		if mode != yolk.MatchPrefix {
+			// the mode defaults to the one of the unalias mode
+			rule.Mode = mode
+		}
+		if err := rw.Add(rule); err != nil {
+			exitOnErr(err)
+		}
+	} else if o.source != "" || o.dest != "" || (implicit && len(o.mappings) == 0 && len(o.embeds) == 0 && o.rulesFile == "") {
+		rule := yolk.Rule{Source: o.source, Dest: o.dest, Mode: mode, Alias: o.alias, Except: o.excepts.values}
+		if o.dest == "" && o.alias != "" && mode == yolk.MatchPrefix {
+			// a rule only setting an alias matches its source exactly
+			rule.Mode = ""
+		}
+		if err := rw.Add(rule); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	for _, m := range o.mappings {
+		if err := rw.Add(yolk.Rule{Source: m.source, Dest: m.dest, Mode: mode, Except: o.excepts.values}); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	for _, m := range o.embeds {
+		if err := rw.Add(yolk.Rule{Source: m.source, Dest: m.dest, Embed: true}); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	if o.reverse {
+		if err := rw.Reverse(); err != nil {
+			exitOnErr(err)
+		}
+	}
+
+	return rw
+}
+
+// newLogger returns the logger of the verbosity flags, showing the progress
+// on terminals.
+func newLogger(o *options) *yolk.Logger {
+	level := yolk.LevelInfo
+	switch {
+	case o.quiet:
+		level = yolk.LevelQuiet
+	case o.debug:
+		level = yolk.LevelDebug
+	case o.verbose:
+		level = yolk.LevelVerbose
+	}
+
+	progress := false
+	if fi, err := os.Stderr.Stat(); err == nil {
+		progress = fi.Mode()&os.ModeCharDevice != 0 && !o.interact
+	}
+	return &yolk.Logger{W: os.Stderr, Level: level, Format: o.logFormat, Progress: progress}
+}
+
+// batch rewrites the repositories listed in the manifest.
+func batch(o *options, manifest string, logger *yolk.Logger, mode yolk.MatchMode) {
+	m, err := yolk.LoadManifest(manifest)
+	if err != nil {
+		exitOnErr(err)
+	}
+
+	results := yolk.RewriteBatch(m, func() *yolk.Rewriter {
+		rw := newRewriter(o, logger, mode, false)
+		if o.dryRun {
+			rw.DryRun = true
+			rw.Reporter = &yolk.DiffReporter{W: diffOutput(o)}
+		}
+		return rw
+	})
+
+	failed := false
+	for _, res := range results {
+		failed = failed || res.Error != "" || res.Summary != nil && res.Summary.FilesFailed > 0
+	}
+
+	switch o.report {
+	case "text":
+		for _, res := range results {
+			switch {
+			case res.Error != "":
+				fmt.Fprintf(os.Stderr, "%s: failed: %s\n", res.Name, res.Error)
+			case res.Patch != "":
+				fmt.Fprintf(os.Stderr, "%s: %d files changed, patch %s\n", res.Name, res.Summary.FilesChanged, res.Patch)
+			case res.Branch != "":
+				fmt.Fprintf(os.Stderr, "%s: %d files changed on branch %s\n", res.Name, res.Summary.FilesChanged, res.Branch)
+			default:
+				fmt.Fprintf(os.Stderr, "%s: %d files changed\n", res.Name, res.Summary.FilesChanged)
+			}
+		}
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+	}
+
+	if failed {
+		os.Exit(exitFailed)
+	}
+}
+
+// runRestore copies back the files of the backup run given as argument, the
+// latest one by default.
+func runRestore(o *options, args []string) {
+	requireArgs("restore", args, 0, 1, "at most one backup run")
+	run := ""
+	if len(args) > 0 {
+		run = args[0]
+	}
+
+	err := yolk.RestoreBackup(o.dir, o.backupDir, run)
+	if _, ok := err.(yolk.Errors); ok {
+		log.Println(err)
+		os.Exit(exitFailed)
+	}
+	if err != nil {
+		exitOnErr(err)
+	}
+}
+
+// runUndo reverts the last run in the directory.
+func runUndo(o *options, args []string) {
+	requireArgs("undo", args, 0, 0, "")
+
+	err := yolk.Undo(o.dir)
+	if os.IsNotExist(err) {
+		exitOnErr(fmt.Errorf("no journal in %s, only the runs with -journal can be undone", o.dir))
+	}
+	if _, ok := err.(yolk.Errors); ok {
+		log.Println(err)
+		os.Exit(exitFailed)
+	}
+	if err != nil {
+		exitOnErr(err)
+	}
+}
+
+// countSkipped returns the number of paths skipped for reason.
+func countSkipped(s yolk.Summary, reason string) int {
+	n := 0
+	for _, sk := range s.Skipped {
+		if sk.Reason == reason {
+			n++
+		}
+	}
+	return n
+}
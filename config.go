@@ -0,0 +1,164 @@
+package yolk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of a rules file. Besides the rules and options
+// always applied, it may define named profiles, such as the phases of a
+// migration, whose rules and options are only applied when selected.
+//
+//	rules:
+//	  - source: github.com/old/repo
+//	    dest: github.com/new/repo
+//	  - source: github.com/old/pkg
+//	    dest: github.com/new/pkg
+//	    mode: exact
+//	  - transform: gopkg.in-to-github
+//	embed:
+//	  - source: assets/templates
+//	    dest: web/templates
+//	skip: ["_mock.go"]
+//	exclude: ["third_party", "**/testdata/**"]
+//	include: ["services/**"]
+//	modules: ["services/foo"]
+//	types: [go, proto, bazel]
+//	policy:
+//	  - deny: corp/internal/experimental
+//	    exclude: ["experimental/**"]
+//	tests:
+//	  - path: github.com/old/repo/sub
+//	    want: github.com/new/repo/sub
+//	plugins:
+//	  - name: tmpl
+//	    files: ["*.tmpl"]
+//	    command: [yolk-tmpl, -strict]
+//	profiles:
+//	  final-cutover:
+//	    rules:
+//	      - source: corp.example.com/staging
+//	        dest: corp.example.com/prod
+type Config struct {
+	Profile `yaml:",inline"`
+
+	// Profiles maps the profile names to their rules and options.
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile is a set of rules and options.
+type Profile struct {
+	// Rules are applied in order.
+	Rules []Rule `yaml:"rules"`
+	// Embed maps the paths of moved embedded files, relative to the
+	// walked directory, rewriting the //go:embed patterns: its rules are
+	// applied after Rules as embed rules.
+	Embed []Rule `yaml:"embed"`
+	// Skip lists additional file name suffixes which are never rewritten.
+	Skip []string `yaml:"skip"`
+	// Exclude lists glob patterns of files and directories which are not
+	// rewritten, see Rewriter.Exclude.
+	Exclude []string `yaml:"exclude"`
+	// Include lists glob patterns restricting the rewritten files.
+	Include []string `yaml:"include"`
+	// Modules lists the module directories restricting the rewritten
+	// files, see Rewriter.Modules.
+	Modules []string `yaml:"modules"`
+	// Local lists the import path prefixes grouped after third party
+	// packages.
+	Local []string `yaml:"local"`
+	// Types lists the types of the files rewritten, see Rewriter.FileTypes.
+	Types []string `yaml:"types"`
+	// Plugins lists the handlers of the files of other formats, run as
+	// external commands, see ExecHandler.
+	Plugins []ExecHandler `yaml:"plugins"`
+	// Policy lists the import policies checked by Rewriter.Lint.
+	Policy []Policy `yaml:"policy"`
+	// Tests lists the import paths the rules are checked against by
+	// Config.TestRules, without being applied to any file.
+	Tests []RuleTest `yaml:"tests"`
+}
+
+// LoadConfig reads the rules file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, err
+	}
+	cfg.setOrigins(path, data)
+
+	return &cfg, nil
+}
+
+// Apply adds the rules and options of the config to the rewriter, leaving
+// its profiles out.
+func (c *Config) Apply(r *Rewriter) error {
+	return c.Profile.Apply(r)
+}
+
+// ApplyProfile adds the rules and options of the config to the rewriter,
+// followed by those of the profile name.
+func (c *Config) ApplyProfile(r *Rewriter, name string) error {
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q, want one of %s", name, strings.Join(names, ","))
+	}
+
+	if err := c.Apply(r); err != nil {
+		return err
+	}
+	return p.Apply(r)
+}
+
+// Apply adds the rules and options of the profile to the rewriter.
+func (p *Profile) Apply(r *Rewriter) error {
+	for _, rule := range p.Rules {
+		if err := r.Add(rule); err != nil {
+			return err
+		}
+	}
+	for _, rule := range p.Embed {
+		rule.Embed = true
+		if err := r.Add(rule); err != nil {
+			return err
+		}
+	}
+
+	for _, policy := range p.Policy {
+		if err := r.AddPolicy(policy); err != nil {
+			return err
+		}
+	}
+	for i := range p.Plugins {
+		h := p.Plugins[i]
+		switch {
+		case h.Type == "" || len(h.Files) == 0 || len(h.Command) == 0:
+			return fmt.Errorf("plugin %q must have a name, files and a command", h.Type)
+		case h.Type == TypeGo || builtinHandlers[h.Type] != nil:
+			return fmt.Errorf("plugin %s is named after a built-in file type", h.Type)
+		}
+		r.AddHandler(&h)
+	}
+
+	r.SkipSuffixes = append(r.SkipSuffixes, p.Skip...)
+	r.Exclude = append(r.Exclude, p.Exclude...)
+	r.Include = append(r.Include, p.Include...)
+	r.Modules = append(r.Modules, p.Modules...)
+	r.LocalPrefixes = append(r.LocalPrefixes, p.Local...)
+	r.FileTypes = append(r.FileTypes, p.Types...)
+	return nil
+}
@@ -0,0 +1,96 @@
+package yolk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const configFile = `rules:
+  - source: old.corp/lib
+    dest: new.corp/lib
+  - source: old.corp/exact
+    dest: new.corp/exact
+    mode: exact
+skip: ["_mock.go"]
+exclude: ["third_party"]
+local: [new.corp]
+profiles:
+  cutover:
+    rules:
+      - source: old.corp/staging
+        dest: new.corp/prod
+`
+
+// writeConfig writes the rules file data in a temporary directory and
+// returns its path.
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, configFile))
+	if err != nil {
+		t.Fatalf("LoadConfig() fails: %v", err)
+	}
+
+	r := NewRewriter()
+	if err := cfg.Apply(r); err != nil {
+		t.Fatalf("Apply() fails: %v", err)
+	}
+	runMatchTests(t, r, []matchTest{
+		{path: "old.corp/lib/foo", want: "new.corp/lib/foo"},
+		{path: "old.corp/exact", want: "new.corp/exact"},
+		{path: "old.corp/exact/sub", want: ""},
+		{path: "old.corp/staging", want: ""},
+	})
+	if got := r.SkipSuffixes[len(r.SkipSuffixes)-1]; got != "_mock.go" {
+		t.Errorf("last skipped suffix = %q, want _mock.go", got)
+	}
+	if len(r.Exclude) != 1 || len(r.LocalPrefixes) != 1 {
+		t.Errorf("Exclude = %q and LocalPrefixes = %q, want one of each", r.Exclude, r.LocalPrefixes)
+	}
+
+	r = NewRewriter()
+	if err := cfg.ApplyProfile(r, "cutover"); err != nil {
+		t.Fatalf("ApplyProfile() fails: %v", err)
+	}
+	runMatchTests(t, r, []matchTest{
+		{path: "old.corp/lib/foo", want: "new.corp/lib/foo"},
+		{path: "old.corp/staging/x", want: "new.corp/prod/x"},
+	})
+	if err := cfg.ApplyProfile(NewRewriter(), "unknown"); err == nil {
+		t.Errorf("ApplyProfile() of an unknown profile succeeds")
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "unknown field", data: "rules:\n  - source: a\n    dset: b\n", want: "dset"},
+		{name: "missing destination", data: "rules:\n  - source: a\n", want: "destination"},
+		{name: "shadowed rule", data: "rules:\n  - source: a\n    dest: b\n  - source: a/c\n    dest: d\n", want: "rules.yaml:4"},
+		{name: "unknown mode", data: "rules:\n  - source: a\n    dest: b\n    mode: glob\n", want: "glob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(writeConfig(t, tt.data))
+			if err == nil {
+				err = cfg.Apply(NewRewriter())
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() and Apply() fail with %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// diffContext is the number of unchanged lines printed around each hunk.
+const diffContext = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type edit struct {
+	kind opKind
+	line string
+}
+
+// Diff returns the unified diff between a and b, labeled with the file
+// name. It returns nil if a and b are identical.
+func Diff(name string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	name = filepath.ToSlash(name)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n", path.Join("a", name))
+	fmt.Fprintf(&buf, "+++ %s\n", path.Join("b", name))
+	writeHunks(&buf, edits)
+	return buf.Bytes()
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+
+	lines := make([]string, 0, bytes.Count(b, []byte{'\n'})+1)
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			lines = append(lines, string(b))
+			break
+		}
+		lines = append(lines, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return lines
+}
+
+// diffLines computes the shortest edit script transforming a into b using
+// the Myers algorithm, after trimming the common prefix and suffix.
+func diffLines(a, b []string) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		edits = append(edits, edit{opEqual, l})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		edits = append(edits, edit{opEqual, l})
+	}
+	return edits
+}
+
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	trace := make([][]int, 0)
+
+	for d := 0; d <= max; d++ {
+		vc := make([]int, len(v))
+		copy(vc, v)
+		trace = append(trace, vc)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+
+	return nil
+}
+
+func backtrack(trace [][]int, a, b []string, offset int) []edit {
+	x, y := len(a), len(b)
+	edits := make([]edit, 0, x+y)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{opEqual, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{opInsert, b[y]})
+			} else {
+				x--
+				edits = append(edits, edit{opDelete, a[x]})
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func writeHunks(buf *bytes.Buffer, edits []edit) {
+	for i := 0; i < len(edits); {
+		if edits[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		// extend the hunk until diffContext*2 unchanged lines are seen
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != opEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].kind == opEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = run
+		}
+
+		writeHunk(buf, edits, start, end)
+		i = end
+	}
+}
+
+func writeHunk(buf *bytes.Buffer, edits []edit, start, end int) {
+	oldStart, newStart := 1, 1
+	for _, e := range edits[:start] {
+		if e.kind != opInsert {
+			oldStart++
+		}
+		if e.kind != opDelete {
+			newStart++
+		}
+	}
+
+	oldLen, newLen := 0, 0
+	for _, e := range edits[start:end] {
+		if e.kind != opInsert {
+			oldLen++
+		}
+		if e.kind != opDelete {
+			newLen++
+		}
+	}
+	if oldLen == 0 {
+		oldStart--
+	}
+	if newLen == 0 {
+		newStart--
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLen), hunkRange(newStart, newLen))
+	for _, e := range edits[start:end] {
+		switch e.kind {
+		case opEqual:
+			buf.WriteByte(' ')
+		case opDelete:
+			buf.WriteByte('-')
+		case opInsert:
+			buf.WriteByte('+')
+		}
+		buf.WriteString(e.line)
+		if len(e.line) == 0 || e.line[len(e.line)-1] != '\n' {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, length int) string {
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
@@ -0,0 +1,155 @@
+package yolk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	lines := func(n int, change map[int]string) string {
+		var b strings.Builder
+		for i := 1; i <= n; i++ {
+			if s, ok := change[i]; ok {
+				b.WriteString(s)
+				continue
+			}
+			b.WriteString("line " + string(rune('a'+i-1)) + "\n")
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "identical",
+			a:    lines(3, nil),
+			b:    lines(3, nil),
+		},
+		{
+			name: "one line changed",
+			a:    oldSource,
+			b:    newSource,
+			want: `--- a/a.go
++++ b/a.go
+@@ -1,5 +1,5 @@
+ package a
+ 
+-import "old.corp/lib/foo"
++import "new.corp/lib/foo"
+ 
+ var _ = foo.X
+`,
+		},
+		{
+			name: "hunks apart",
+			a:    lines(20, nil),
+			b:    lines(20, map[int]string{2: "line B\n", 19: "line S\n"}),
+			want: `--- a/a.go
++++ b/a.go
+@@ -1,5 +1,5 @@
+ line a
+-line b
++line B
+ line c
+ line d
+ line e
+@@ -16,5 +16,5 @@
+ line p
+ line q
+ line r
+-line s
++line S
+ line t
+`,
+		},
+		{
+			name: "hunks joined",
+			a:    lines(10, nil),
+			b:    lines(10, map[int]string{2: "line B\n", 8: "line H\n"}),
+			want: `--- a/a.go
++++ b/a.go
+@@ -1,10 +1,10 @@
+ line a
+-line b
++line B
+ line c
+ line d
+ line e
+ line f
+ line g
+-line h
++line H
+ line i
+ line j
+`,
+		},
+		{
+			name: "lines inserted and deleted",
+			a:    lines(4, map[int]string{2: ""}),
+			b:    lines(4, map[int]string{3: "line c\nline x\n", 4: ""}),
+			want: `--- a/a.go
++++ b/a.go
+@@ -1,3 +1,4 @@
+ line a
++line b
+ line c
+-line d
++line x
+`,
+		},
+		{
+			name: "no newline at end of file",
+			a:    "package a",
+			b:    "package b",
+			want: `--- a/a.go
++++ b/a.go
+@@ -1 +1 @@
+-package a
+\ No newline at end of file
++package b
+\ No newline at end of file
+`,
+		},
+		{
+			name: "new file",
+			a:    "",
+			b:    "package a\n",
+			want: `--- a/a.go
++++ b/a.go
+@@ -0,0 +1 @@
++package a
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff("a.go", []byte(tt.a), []byte(tt.b)); string(got) != tt.want {
+				t.Errorf("Diff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteDirDryRunDiff(t *testing.T) {
+	mem := NewMemFS(map[string][]byte{"a.go": []byte(oldSource), "b.go": []byte(otherFile)})
+	var out bytes.Buffer
+	r := newMemRewriter(t)
+	r.FS = IOFS(mem)
+	r.DryRun = true
+	r.Reporter = &DiffReporter{W: &out}
+	if err := r.RewriteDir("."); err != nil {
+		t.Fatalf("RewriteDir() fails: %v", err)
+	}
+
+	if want := string(Diff("a.go", []byte(oldSource), []byte(newSource))); out.String() != want {
+		t.Errorf("RewriteDir() reports\n%s\nwant\n%s", out.String(), want)
+	}
+	if got := string(mem.Files()["a.go"]); got != oldSource {
+		t.Errorf("a.go =\n%s\nwant it unchanged in dry run mode", got)
+	}
+}
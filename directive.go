@@ -0,0 +1,47 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// rewriteGenerateDirectives returns the edits rewriting the import and
+// module paths found among the arguments of the //go:generate directives of
+// file. A version suffix, as in example.com/tool@v1.0.0, is kept.
+func (r *Rewriter) rewriteGenerateDirectives(fset *token.FileSet, file *ast.File) ([]textEdit, []*replacer) {
+	var (
+		edits []textEdit
+		hits  []*replacer
+	)
+	m := r.mapper(fset.File(file.Pos()).Name(), kindDirective, &hits)
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, "//go:generate ") {
+				edits = append(edits, rewriteArgs(c.Text, fset.Position(c.Pos()).Offset, m)...)
+			}
+		}
+	}
+	return edits, hits
+}
+
+// fieldsIndex returns the [start, end) offsets of the white space separated
+// fields of s.
+func fieldsIndex(s string) [][2]int {
+	var fields [][2]int
+	start := -1
+	for i := 0; i < len(s); i++ {
+		space := s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r'
+		switch {
+		case space && start >= 0:
+			fields = append(fields, [2]int{start, i})
+			start = -1
+		case !space && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, [2]int{start, len(s)})
+	}
+	return fields
+}
@@ -0,0 +1,139 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// kindEmbed is the kind of the replacers of the patterns of //go:embed
+// directives, whose paths are relative to the walked directory.
+const kindEmbed = "go:embed"
+
+// validateEmbed checks an embed rule, whose source and destination are the
+// slash separated paths of a directory or file relative to the walked
+// directory, matched as a prefix by default.
+func (r *Rule) validateEmbed() error {
+	switch {
+	case r.Source == "" || r.Dest == "":
+		return fmt.Errorf("embed rule %s must have a source and a destination", r)
+	case r.Transform != "" || r.Alias != "" || r.Remove != "" || r.Add != "" || r.Symbol != "":
+		return fmt.Errorf("embed rule %s only maps a path to another", r)
+	}
+	for _, p := range []string{r.Source, r.Dest} {
+		if path.IsAbs(p) || p != path.Clean(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("invalid path %q of embed rule %s, want a clean path relative to the walked directory", p, r)
+		}
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = MatchPrefix
+	case MatchPrefix, MatchExact:
+	default:
+		return fmt.Errorf("embed rule %s only matches exact paths or prefixes", r)
+	}
+	return nil
+}
+
+// rewriteEmbedDirectives returns the edits rewriting the patterns of the
+// //go:embed directives of the golang source file filename which lie in a
+// directory or file moved by the embed rules. A pattern is relative to the
+// directory of the file, its new path must stay under it. The all: prefix
+// and the quotes of a pattern are kept.
+func (r *Rewriter) rewriteEmbedDirectives(fset *token.FileSet, file *ast.File, filename string) ([]textEdit, []*replacer) {
+	if !r.hasEmbedRules() {
+		return nil, nil
+	}
+
+	var (
+		edits []textEdit
+		hits  []*replacer
+	)
+	dir := relPath(r.root, filepath.Dir(filename))
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, "//go:embed ") {
+				continue
+			}
+			base := fset.Position(c.Pos()).Offset
+			for _, f := range fieldsIndex(c.Text)[1:] {
+				pattern, start, end := c.Text[f[0]:f[1]], f[0], f[1]
+				quoted := pattern[0] == '"' || pattern[0] == '`'
+				if quoted {
+					p, err := strconv.Unquote(pattern)
+					if err != nil {
+						continue
+					}
+					pattern, start, end = p, start+1, end-1
+				}
+				prefix := ""
+				if strings.HasPrefix(pattern, "all:") {
+					prefix, pattern = "all:", pattern[len("all:"):]
+				}
+
+				i, np, ok := r.matchEmbed(filename, path.Join(dir, pattern))
+				if !ok {
+					continue
+				}
+				rel, ok := relEmbed(dir, np)
+				pos := fset.Position(c.Pos())
+				if !ok {
+					r.Log.Warnf("%s: %s is not rewritten, %s is outside of the directory of the file", pos, pattern, np)
+					continue
+				}
+				text := prefix + rel
+				if !quoted && strings.ContainsAny(text, " \t\"`") {
+					text = strconv.Quote(text)
+				}
+
+				edits = append(edits, textEdit{start: base + start, end: base + end, text: text})
+				hits = append(hits, &replacer{oldPath: pattern, newPath: rel, rule: i, kind: kindEmbed, pos: pos})
+			}
+		}
+	}
+	return edits, hits
+}
+
+// matchEmbed returns the index of the first embed rule matching the slash
+// separated path relative to the walked directory in the file, and the
+// path replaced by it.
+func (r *Rewriter) matchEmbed(file, p string) (int, string, bool) {
+	rel := ""
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !rule.Embed || !r.appliesTo(rule, file, &rel) {
+			continue
+		}
+		if np, ok := rule.apply(p); ok && np != p {
+			return i, np, true
+		}
+	}
+	return -1, "", false
+}
+
+// relEmbed returns the slash separated path p relative to dir, both being
+// relative to the walked directory, if p lies under dir.
+func relEmbed(dir, p string) (string, bool) {
+	if dir == "." {
+		return p, p != ".." && !strings.HasPrefix(p, "../")
+	}
+	if !strings.HasPrefix(p, dir+"/") {
+		return "", false
+	}
+	return p[len(dir)+1:], true
+}
+
+// hasEmbedRules reports whether some rules move embedded files.
+func (r *Rewriter) hasEmbedRules() bool {
+	for i := range r.rules {
+		if r.rules[i].Embed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package yolk
+
+import "bytes"
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// textFormat is how the content of a file is encoded besides its text: a
+// byte order mark, and CRLF line endings. They are stripped before the
+// content is rewritten, and restored afterwards, so that rewritten files
+// keep them and added lines end the way the others do.
+type textFormat struct {
+	bom  bool
+	crlf bool
+}
+
+// stripFormat returns the format of src and its content without the byte
+// order mark, with LF line endings if all lines end with CRLF. Files mixing
+// line endings are left as they are.
+func stripFormat(src []byte) (textFormat, []byte) {
+	var f textFormat
+	if bytes.HasPrefix(src, utf8BOM) {
+		f.bom = true
+		src = src[len(utf8BOM):]
+	}
+
+	if n := bytes.Count(src, []byte("\r\n")); n > 0 && n == bytes.Count(src, []byte("\n")) {
+		f.crlf = true
+		src = bytes.Replace(src, []byte("\r\n"), []byte("\n"), -1)
+	}
+	return f, src
+}
+
+// restore returns text encoded in the format f.
+func (f textFormat) restore(text []byte) []byte {
+	if f.crlf {
+		text = bytes.Replace(text, []byte("\n"), []byte("\r\n"), -1)
+	}
+	if f.bom {
+		text = append(append([]byte(nil), utf8BOM...), text...)
+	}
+	return text
+}
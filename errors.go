@@ -0,0 +1,38 @@
+package yolk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrStop is returned by Rewriter.Confirm to stop a run, leaving the
+// current file and all the later ones alone.
+var ErrStop = errors.New("stopped")
+
+// FileError is the error of rewriting a single file.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("rewrite import fails with %s due to %s", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates the errors of all files failing to be rewritten in a run,
+// in walking order.
+type Errors []*FileError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return fmt.Sprintf("%d files fail to be rewritten:\n%s", len(e), strings.Join(msgs, "\n"))
+}
@@ -0,0 +1,158 @@
+package yolk
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Explanation is a change of a file along with the rule making it, as told
+// to an Explainer in Explain mode.
+type Explanation struct {
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Kind   string `json:"kind"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	// Rule is the rule making the change, Name its name and Origin the
+	// position of the rule in its rules file, if any.
+	Rule   string `json:"rule"`
+	Name   string `json:"name,omitempty"`
+	Origin string `json:"origin,omitempty"`
+}
+
+// String returns the explanation in the form of "line:column: kind old =>
+// new by name: rule at origin".
+func (e Explanation) String() string {
+	rule := e.Rule
+	if e.Name != "" {
+		rule = e.Name + ": " + rule
+	}
+	if e.Origin != "" {
+		rule += " at " + e.Origin
+	}
+	return fmt.Sprintf("%d:%d: %s %s => %s by %s", e.Line, e.Column, e.Kind, e.Old, e.New, rule)
+}
+
+// Explainer is a Reporter which is also told the rule behind every change
+// of the files it reports, in Explain mode, before they are reported.
+type Explainer interface {
+	Explain(path string, changes []Explanation) error
+}
+
+// explain tells the Reporter the changes of res with their rules, if it is
+// an Explainer.
+func (r *Rewriter) explain(res *fileResult) error {
+	e, ok := r.Reporter.(Explainer)
+	if !ok || len(res.replacers) == 0 {
+		return nil
+	}
+
+	locate(res.src, res.replacers)
+	changes := make([]Explanation, 0, len(res.replacers))
+	for _, rp := range res.replacers {
+		rule := r.rules[rp.rule]
+		changes = append(changes, Explanation{
+			Line:   rp.pos.Line,
+			Column: rp.pos.Column,
+			Kind:   rp.kind,
+			Old:    rp.oldPath,
+			New:    rp.newPath,
+			Rule:   rule.String(),
+			Name:   rule.Name,
+			Origin: rule.origin,
+		})
+	}
+	return e.Explain(res.path, changes)
+}
+
+// located returns the rule along with its origin, if any.
+func (r Rule) located() string {
+	if r.origin == "" {
+		return r.String()
+	}
+	return r.String() + " at " + r.origin
+}
+
+// writeExplanations writes the changes of path to w as comment lines, which
+// diff and patch tools skip.
+func writeExplanations(w io.Writer, path string, changes []Explanation) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintf(w, "# %s:%s\n", path, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// yamlKeyRe matches a line of a YAML block mapping, possibly the first
+// line of a sequence item, the key being its second group.
+var yamlKeyRe = regexp.MustCompile(`^(- +)?([A-Za-z0-9_.-]+|"[^"]*"|'[^']*'):( |$)`)
+
+// ruleLines returns the line numbers of the items of the rule lists of the
+// YAML rules file data, by the dot separated keys of the lists, such as
+// rules or profiles.final-cutover.embed. Only block sequences are found.
+func ruleLines(data []byte) map[string][]int {
+	type key struct {
+		indent int
+		name   string
+	}
+	var (
+		stack []key
+		lines = make(map[string][]int)
+	)
+	path := func() string {
+		names := make([]string, len(stack))
+		for i, k := range stack {
+			names[i] = k.name
+		}
+		return strings.Join(names, ".")
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimLeft(line, " ")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		indent := len(line) - len(text)
+		item := text == "-" || strings.HasPrefix(text, "- ")
+
+		// an item may stand at the indentation of the key of its list
+		for len(stack) > 0 && (stack[len(stack)-1].indent > indent || !item && stack[len(stack)-1].indent == indent) {
+			stack = stack[:len(stack)-1]
+		}
+		if item {
+			if p := path(); len(stack) > 0 && (stack[len(stack)-1].name == "rules" || stack[len(stack)-1].name == "embed") {
+				lines[p] = append(lines[p], i+1)
+			}
+		}
+
+		m := yamlKeyRe.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+		stack = append(stack, key{indent: indent + len(m[1]), name: strings.Trim(m[2], `"'`)})
+	}
+	return lines
+}
+
+// setOrigins sets the origins of the rules of the config loaded from the
+// file path holding data.
+func (c *Config) setOrigins(path string, data []byte) {
+	lines := ruleLines(data)
+	set := func(rules []Rule, key string) {
+		for i := range rules {
+			if i < len(lines[key]) {
+				rules[i].origin = fmt.Sprintf("%s:%d", path, lines[key][i])
+			}
+		}
+	}
+
+	set(c.Rules, "rules")
+	set(c.Embed, "embed")
+	for name, p := range c.Profiles {
+		set(p.Rules, "profiles."+name+".rules")
+		set(p.Embed, "profiles."+name+".embed")
+	}
+}
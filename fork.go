@@ -0,0 +1,167 @@
+package yolk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleFork is the module copied into the module of the walked directory
+// by Fork.
+type moduleFork struct {
+	// nested holds the paths of the modules nested in the forked module,
+	// which are not copied.
+	nested []string
+
+	// rule is the index of the rule of the fork.
+	rule int
+}
+
+// Fork copies the module modPath, as in the module cache, into the
+// directory newPath has in the modules of dir, such as
+// example.com/m/internal/thirdparty/lib, for a hard fork maintained along
+// with the code using it. The version of the module is the one required by
+// dir, unless modPath is followed by @version. The imports of its packages
+// are then rewritten in dir, as with a prefix rule: the packages of the
+// copy import each other relative to its new root, and the rest of dir
+// imports the copy. The go.mod and go.sum files and the nested modules of
+// modPath are not copied, and the imports of the nested modules are left
+// alone. Nothing is copied in DryRun mode.
+func (r *Rewriter) Fork(dir, modPath, newPath string) error {
+	if r.FS != nil {
+		return fmt.Errorf("forking a module requires the files to be on disk, not in FS")
+	}
+	newDir, ok := r.pathDir(dir, newPath)
+	if !ok {
+		return fmt.Errorf("%s is not in the modules of %s", newPath, dir)
+	}
+	if _, err := os.Stat(newDir); !os.IsNotExist(err) {
+		return fmt.Errorf("%s already exists", newDir)
+	}
+
+	src, err := downloadModule(dir, modPath)
+	if err != nil {
+		return err
+	}
+	if i := strings.IndexByte(modPath, '@'); i >= 0 {
+		modPath = modPath[:i]
+	}
+
+	fork := &moduleFork{}
+	if r.DryRun {
+		r.Log.Infof("would copy %s to %s", src, newDir)
+		fork.nested, err = copyModule(src, "")
+	} else {
+		fork.nested, err = copyModule(src, newDir)
+		r.Log.Infof("copied %s to %s", src, newDir)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := r.Add(Rule{Source: modPath, Dest: newPath, Mode: MatchPrefix}); err != nil {
+		return err
+	}
+	fork.rule = len(r.rules) - 1
+	r.forked = fork
+	defer func() { r.forked = nil }()
+
+	// the copy is a part of the module of dir, whose requirements are left
+	// to go mod tidy
+	r.GoMod = false
+	return r.RewriteDir(dir)
+}
+
+// downloadModule returns the directory of the module path, with an
+// optional @version, in the module cache, downloading it if needed.
+func downloadModule(dir, path string) (string, error) {
+	cmd := exec.Command("go", "mod", "download", "-json", path)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+
+	var m struct {
+		Dir   string
+		Error string
+	}
+	if jerr := json.Unmarshal(out, &m); jerr != nil && err == nil {
+		err = jerr
+	}
+	switch {
+	case m.Error != "":
+		return "", fmt.Errorf("download module %s fails: %s", path, m.Error)
+	case err != nil:
+		return "", fmt.Errorf("download module %s fails due to %v: %s", path, err, stderr.Bytes())
+	case m.Dir == "":
+		return "", fmt.Errorf("module %s is not downloaded", path)
+	}
+	return m.Dir, nil
+}
+
+// copyModule copies the files of the module in src to dst, but for its
+// go.mod and go.sum files, its vendor directory and its nested modules,
+// whose paths are returned. Nothing is written if dst is empty.
+func copyModule(src, dst string) ([]string, error) {
+	var nested []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path == src {
+				return nil
+			}
+			if info.Name() == "vendor" || strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if m, ok := readModule(diskFS{}, path); ok {
+				nested = append(nested, m.path)
+				return filepath.SkipDir
+			}
+			if dst == "" {
+				return nil
+			}
+			return os.MkdirAll(filepath.Join(dst, rel), 0755)
+		}
+
+		if rel == "go.mod" || rel == "go.sum" || !info.Mode().IsRegular() || dst == "" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dst, filepath.Dir(rel)), 0755); err != nil {
+			return err
+		}
+		// the files of the module cache are read-only
+		return ioutil.WriteFile(filepath.Join(dst, rel), data, 0644)
+	})
+	return nested, err
+}
+
+// otherModule reports whether path belongs to a module nested in the module
+// forked by Fork, which is not copied along, while rule matches it.
+func (r *Rewriter) otherModule(rule int, path string) bool {
+	f := r.forked
+	if f == nil || rule != f.rule {
+		return false
+	}
+	for _, m := range f.nested {
+		if hasPathPrefix(path, m) {
+			return true
+		}
+	}
+	return false
+}
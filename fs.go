@@ -0,0 +1,121 @@
+package yolk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystem is the file system walked and rewritten by a Rewriter, see its
+// FS field. Names are paths in the form of the operating system, as given
+// to RewriteDir.
+type FileSystem interface {
+	// Stat and Lstat return the information of the file name, Lstat not
+	// following a symlink.
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+
+	// ReadDir returns the names of the entries of the directory name,
+	// sorted.
+	ReadDir(name string) ([]string, error)
+
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// diskFS is the FileSystem of the operating system.
+type diskFS struct{}
+
+func (diskFS) Stat(name string) (os.FileInfo, error)  { return os.Stat(name) }
+func (diskFS) Lstat(name string) (os.FileInfo, error) { return os.Lstat(name) }
+func (diskFS) ReadFile(name string) ([]byte, error)   { return ioutil.ReadFile(name) }
+
+func (diskFS) ReadDir(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (diskFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// fs returns the file system of the rewriter.
+func (r *Rewriter) fs() FileSystem {
+	if r.FS == nil {
+		return diskFS{}
+	}
+	return r.FS
+}
+
+// writeFile replaces the content src of path with data in the file system
+// of the rewriter. Files on disk are backed up until the write succeeds.
+func (r *Rewriter) writeFile(path string, src, data []byte, perm os.FileMode) error {
+	if r.FS == nil {
+		return writeFile(path, src, data, perm)
+	}
+	return r.FS.WriteFile(path, data, perm)
+}
+
+// validateFS checks that the options of the rewriter which run commands on
+// the files or write other files than the rewritten ones are off, unless
+// the rewriter works on disk.
+func (r *Rewriter) validateFS() error {
+	if r.FS == nil {
+		return nil
+	}
+
+	for _, opt := range []struct {
+		name string
+		on   bool
+	}{
+		{"Typed", r.Typed},
+		{"Verify", r.Verify != ""},
+		{"GitTracked", r.GitTracked},
+		{"Journal", r.Journal},
+		{"BackupDir", r.BackupDir != ""},
+		{"PreserveTimes", r.PreserveTimes},
+	} {
+		if opt.on {
+			return fmt.Errorf("%s requires the files to be on disk, not in FS", opt.name)
+		}
+	}
+	return nil
+}
+
+// OutDir returns the FileSystem reading the files under dir on disk and
+// writing the rewritten ones to the same path under out instead, creating
+// its directories as needed: the tree of dir is left untouched and out
+// only holds the changed files.
+func OutDir(dir, out string) FileSystem {
+	return outDir{dir: dir, out: out}
+}
+
+type outDir struct {
+	diskFS
+	dir, out string
+}
+
+func (o outDir) WriteFile(name string, data []byte, perm os.FileMode) error {
+	rel, err := filepath.Rel(o.dir, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is not under %s", name, o.dir)
+	}
+
+	path := filepath.Join(o.out, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
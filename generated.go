@@ -0,0 +1,51 @@
+package yolk
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// generatedRe matches the line marking generated code, see
+// https://golang.org/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the golang source src carries the generated
+// code marker. Only the comments ahead of the package clause are scanned,
+// so the file doesn't have to be parsed.
+func isGenerated(src []byte) bool {
+	inBlock := false
+	for len(src) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line, src = src[:i], src[i+1:]
+		} else {
+			line, src = src, nil
+		}
+		line = bytes.TrimSpace(line)
+
+		if inBlock {
+			if i := bytes.Index(line, []byte("*/")); i >= 0 {
+				inBlock = false
+				line = bytes.TrimSpace(line[i+2:])
+				if len(line) == 0 {
+					continue
+				}
+			} else {
+				continue
+			}
+		}
+
+		switch {
+		case len(line) == 0:
+		case bytes.HasPrefix(line, []byte("//")):
+			if generatedRe.Match(line) {
+				return true
+			}
+		case bytes.HasPrefix(line, []byte("/*")):
+			inBlock = !bytes.Contains(line[2:], []byte("*/"))
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DefaultCommitMessage is the template of the commit message created by
+// GitCommit, executed with the Summary of the run.
+const DefaultCommitMessage = `Rewrite import paths
+
+{{range .Rules}}{{if .Imports}}- {{if .Transform}}{{.Transform}}{{else}}{{.Source}} => {{.Dest}}{{end}} ({{.Imports}} imports)
+{{end}}{{end}}`
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s fails due to %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// gitTrackedFiles returns the cleaned paths of the files under dir tracked
+// by git.
+func gitTrackedFiles(dir string) (map[string]bool, error) {
+	out, err := git(dir, "ls-files", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := make(map[string]bool)
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			tracked[filepath.Join(dir, filepath.FromSlash(name))] = true
+		}
+	}
+	return tracked, nil
+}
+
+// gitIgnoredPaths returns the slash separated paths, relative to dir, of
+// the untracked files and directories under dir which git ignores, as all
+// of its exclude files tell: the .gitignore files of the worktree including
+// those above dir, .git/info/exclude and core.excludesFile. A directory
+// ignored as a whole is listed alone.
+func gitIgnoredPaths(dir string) (map[string]bool, error) {
+	out, err := git(dir, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := make(map[string]bool)
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			ignored[strings.TrimSuffix(name, "/")] = true
+		}
+	}
+	return ignored, nil
+}
+
+// InGitRepo reports whether dir is inside a git worktree.
+func InGitRepo(dir string) bool {
+	out, err := git(dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil && string(bytes.TrimSpace(out)) == "true"
+}
+
+// CheckGitClean returns an error if the git worktree containing dir has
+// uncommitted changes.
+func CheckGitClean(dir string) error {
+	out, err := git(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(out)) > 0 {
+		return fmt.Errorf("git worktree of %s is dirty, commit or stash the changes first", dir)
+	}
+	return nil
+}
+
+// GitCommit commits all changes to the tracked files of the git worktree
+// containing dir, with the message executed from the text/template tmpl
+// with the summary of the run.
+func GitCommit(dir, tmpl string, summary Summary) error {
+	t, err := template.New("message").Parse(tmpl)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	if err := t.Execute(&msg, summary); err != nil {
+		return err
+	}
+
+	_, err = git(dir, "commit", "--all", "--message", msg.String())
+	return err
+}
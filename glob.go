@@ -0,0 +1,68 @@
+package yolk
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob reports whether the slash separated relative path name matches
+// the glob pattern. Besides the syntax of path.Match, a "**" element matches
+// zero or more path elements. A pattern without any slash is matched
+// against the last element of name only. Paths are matched regardless of
+// case where file names are, as on Windows.
+func matchGlob(pattern, name string) bool {
+	pattern = slashPattern(pattern)
+	if foldPaths {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// slashPattern returns pattern with slash separators. Backslashes are
+// separators on Windows, rather than escapes as path.Match has them.
+func slashPattern(pattern string) string {
+	if filepath.Separator == '/' {
+		return pattern
+	}
+	return strings.Replace(pattern, string(filepath.Separator), "/", -1)
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) (string, bool) {
+	for _, p := range patterns {
+		if matchGlob(p, name) {
+			return p, true
+		}
+	}
+	return "", false
+}
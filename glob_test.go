@@ -0,0 +1,48 @@
+package yolk
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "*.pb.go", name: "api/v1/api.pb.go", want: true},
+		{pattern: "*.pb.go", name: "api/v1/api.go", want: false},
+		{pattern: "web/*.tmpl", name: "web/index.tmpl", want: true},
+		{pattern: "web/*.tmpl", name: "web/admin/index.tmpl", want: false},
+		{pattern: "web/**/*.tmpl", name: "web/admin/index.tmpl", want: true},
+		{pattern: "web/**/*.tmpl", name: "web/index.tmpl", want: true},
+		{pattern: "**/testdata/**", name: "pkg/testdata/a/b.go", want: true},
+		{pattern: "internal/*", name: "pkg/internal/a.go", want: false},
+		{pattern: "Web/*.TMPL", name: "web/index.tmpl", want: foldPaths},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestMatchGlobSeparators checks that patterns written with the separator of
+// the platform match, as they are given on the command line.
+func TestMatchGlobSeparators(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+	}{
+		{pattern: "web/*.tmpl", name: "web/index.tmpl"},
+		{pattern: "web/**/*.tmpl", name: "web/admin/index.tmpl"},
+		{pattern: "cmd/yolk", name: "cmd/yolk"},
+	}
+	for _, tt := range tests {
+		pattern := filepath.FromSlash(tt.pattern)
+		if !matchGlob(pattern, tt.name) {
+			t.Errorf("matchGlob(%q, %q) = false, want true", pattern, tt.name)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 module github.com/barryz/yolk
 
-go 1.13
+go 1.16
 
-require golang.org/x/tools v0.0.0-20200515220128-d3bf790afa53
+require (
+	github.com/fsnotify/fsnotify v1.4.9
+	golang.org/x/mod v0.3.0
+	golang.org/x/tools v0.0.0-20200515220128-d3bf790afa53
+	gopkg.in/yaml.v2 v2.3.0
+)
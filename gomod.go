@@ -0,0 +1,69 @@
+package yolk
+
+import (
+	"go/token"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// rewriteModFile returns the content of the go.mod file src with the module
+// paths of its module, require, exclude and replace directives rewritten.
+func (r *Rewriter) rewriteModFile(path string, src []byte) ([]byte, []*replacer, error) {
+	f, err := modfile.Parse(path, src, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var replacers []*replacer
+	rewrite := func(line *modfile.Line, old string) {
+		rule, np, ok := r.match(path, old)
+		if !ok || np == old {
+			return
+		}
+
+		for i, tok := range line.Token {
+			if unquoteToken(tok) == old {
+				line.Token[i] = modfile.AutoQuote(np)
+				if b := r.bumped; b != nil && rule == b.rule && i+1 < len(line.Token) {
+					line.Token[i+1] = b.bumpVersion(line.Token[i+1])
+				}
+				pos := token.Position{Line: line.Start.Line, Column: line.Start.LineRune}
+				replacers = append(replacers, &replacer{oldPath: old, newPath: np, rule: rule, kind: kindModFile, pos: pos})
+				return
+			}
+		}
+	}
+
+	if f.Module != nil {
+		rewrite(f.Module.Syntax, f.Module.Mod.Path)
+	}
+	for _, req := range f.Require {
+		rewrite(req.Syntax, req.Mod.Path)
+	}
+	for _, ex := range f.Exclude {
+		rewrite(ex.Syntax, ex.Mod.Path)
+	}
+	for _, rep := range f.Replace {
+		rewrite(rep.Syntax, rep.Old.Path)
+		if !modfile.IsDirectoryPath(rep.New.Path) {
+			rewrite(rep.Syntax, rep.New.Path)
+		}
+	}
+
+	if len(replacers) == 0 {
+		return src, nil, nil
+	}
+
+	return modfile.Format(f.Syntax), replacers, nil
+}
+
+func unquoteToken(tok string) string {
+	if strings.HasPrefix(tok, `"`) || strings.HasPrefix(tok, "`") {
+		if s, err := strconv.Unquote(tok); err == nil {
+			return s
+		}
+	}
+	return tok
+}
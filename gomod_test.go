@@ -0,0 +1,65 @@
+package yolk
+
+import "testing"
+
+func TestRewriteModFile(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "module",
+			src:  "module old.corp/lib/app\n\ngo 1.16\n",
+			want: "module new.corp/lib/app\n\ngo 1.16\n",
+		},
+		{
+			name: "require block",
+			src:  "module example.com/m\n\nrequire (\n\told.corp/lib v1.2.0\n\texample.com/other v0.1.0\n)\n",
+			want: "module example.com/m\n\nrequire (\n\tnew.corp/lib v1.2.0\n\texample.com/other v0.1.0\n)\n",
+		},
+		{
+			name: "exclude",
+			src:  "module example.com/m\n\nexclude old.corp/lib/sub v0.3.0\n",
+			want: "module example.com/m\n\nexclude new.corp/lib/sub v0.3.0\n",
+		},
+		{
+			name: "replace module",
+			src:  "module example.com/m\n\nreplace example.com/fork => old.corp/lib v1.0.0\n",
+			want: "module example.com/m\n\nreplace example.com/fork => new.corp/lib v1.0.0\n",
+		},
+		{
+			name: "replace directory",
+			src:  "module example.com/m\n\nreplace old.corp/lib => ./old.corp/lib\n",
+			want: "module example.com/m\n\nreplace new.corp/lib => ./old.corp/lib\n",
+		},
+		{
+			name: "unchanged",
+			src:  "module example.com/m\n\nrequire example.com/other v0.1.0 // keep\n",
+			want: "module example.com/m\n\nrequire example.com/other v0.1.0 // keep\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRuleRewriter(t, Rule{Source: "old.corp/lib", Dest: "new.corp/lib"})
+			got, replacers, err := r.rewriteModFile("go.mod", []byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rewriteModFile() = %q, want %q", got, tt.want)
+			}
+			if changed := tt.src != tt.want; changed != (len(replacers) > 0) {
+				t.Errorf("rewriteModFile() returns %d replacers", len(replacers))
+			}
+		})
+	}
+}
+
+func TestRewriteModFileError(t *testing.T) {
+	r := newRuleRewriter(t, Rule{Source: "old.corp/lib", Dest: "new.corp/lib"})
+	if _, _, err := r.rewriteModFile("go.mod", []byte("module\nrequire (\n")); err == nil {
+		t.Error("rewriteModFile() of a malformed go.mod succeeds")
+	}
+}
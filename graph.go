@@ -0,0 +1,141 @@
+package yolk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Graph is the import graph of the packages of a directory.
+type Graph struct {
+	// Packages lists the import paths of the packages of the directory,
+	// sorted. The packages they import are only known from the edges.
+	Packages []string    `json:"packages"`
+	Edges    []GraphEdge `json:"edges"`
+	// Rules are the rules of the rewriter, matching the edges.
+	Rules []Rule `json:"rules"`
+}
+
+// GraphEdge is the import of a package by another one, matched by the rule
+// of index Rule of the graph, or -1 if no rule matches it.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Rule int    `json:"rule"`
+}
+
+// Graph returns the import graph of the golang source files walked from
+// dir, that RewriteDir would rewrite, without rewriting anything. The
+// packages of the modules found in dir are named after their import paths,
+// the others after their directory relative to dir.
+func (r *Rewriter) Graph(dir string) (*Graph, error) {
+	r.findModules(dir)
+	r.resetIgnores(dir)
+	r.root = dir
+
+	pkgs := make(map[string]bool)
+	edges := make(map[GraphEdge]bool)
+	fset := token.NewFileSet()
+	err := r.walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ok, _, err := r.handle(dir, name, info)
+		if !ok || !strings.HasSuffix(name, ".go") {
+			return err
+		}
+
+		src, rerr := r.fs().ReadFile(name)
+		if rerr != nil {
+			return rerr
+		}
+		f, perr := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+		if perr != nil {
+			r.Log.Warnf("%v", perr)
+			return nil
+		}
+
+		from := r.packagePath(dir, filepath.Dir(name))
+		pkgs[from] = true
+		for _, imp := range f.Imports {
+			to := importPath(imp)
+			if to == from {
+				// external test packages import the package they test
+				continue
+			}
+			rule, _, _ := r.match(name, to)
+			edges[GraphEdge{From: from, To: to, Rule: rule}] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		Packages: make([]string, 0, len(pkgs)),
+		Edges:    make([]GraphEdge, 0, len(edges)),
+		Rules:    append([]Rule{}, r.rules...),
+	}
+	for p := range pkgs {
+		g.Packages = append(g.Packages, p)
+	}
+	for e := range edges {
+		g.Edges = append(g.Edges, e)
+	}
+	sort.Strings(g.Packages)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g, nil
+}
+
+// packagePath returns the import path of the package in the directory
+// pkgDir walked from root.
+func (r *Rewriter) packagePath(root, pkgDir string) string {
+	if dir, m, ok := r.moduleOf(filepath.Join(pkgDir, "x.go")); ok && m.path != "" {
+		return path.Join(m.path, relPath(dir, pkgDir))
+	}
+	return relPath(root, pkgDir)
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz. The packages
+// of the directory are boxes, and the edges matched by a rule are red and
+// labeled with it.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph imports {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	for _, p := range g.Packages {
+		fmt.Fprintf(bw, "\t%q [shape=box];\n", p)
+	}
+	for _, e := range g.Edges {
+		if e.Rule >= 0 && e.Rule < len(g.Rules) {
+			fmt.Fprintf(bw, "\t%q -> %q [color=red, label=%q];\n", e.From, e.To, g.Rules[e.Rule].String())
+			continue
+		}
+		fmt.Fprintf(bw, "\t%q -> %q;\n", e.From, e.To)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteJSON writes the graph as indented JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
@@ -0,0 +1,47 @@
+package yolk
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/imports"
+)
+
+// importsMu guards the LocalPrefix setting of the imports package, which is
+// global.
+var importsMu sync.Mutex
+
+// importClass returns the group goimports puts the import path in: the
+// standard library, the third party packages, the appengine packages and
+// the packages under the local prefixes, in this order.
+func importClass(path string, locals []string) int {
+	for _, p := range locals {
+		if strings.HasPrefix(path, p) || strings.TrimSuffix(p, "/") == path {
+			return 3
+		}
+	}
+	if strings.HasPrefix(path, "appengine") {
+		return 2
+	}
+	if strings.Contains(strings.Split(path, "/")[0], ".") {
+		return 1
+	}
+	return 0
+}
+
+// formatImports formats the golang source src the way goimports does,
+// without adding or removing any import: imports are merged into a single
+// declaration and grouped into the standard library, third party packages
+// and the packages under LocalPrefixes, in this order.
+func (r *Rewriter) formatImports(path string, src []byte) ([]byte, error) {
+	importsMu.Lock()
+	defer importsMu.Unlock()
+
+	imports.LocalPrefix = strings.Join(r.LocalPrefixes, ",")
+	return imports.Process(path, src, &imports.Options{
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   tabWidth,
+		FormatOnly: true,
+	})
+}
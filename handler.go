@@ -0,0 +1,224 @@
+package yolk
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mapper returns the import path replacing path according to the rules of
+// a rewriter, and whether it is replaced at all.
+type Mapper func(path string) (string, bool)
+
+// Handler rewrites the import paths referenced by a kind of file other
+// than golang source files. The paths given to a handler are slash
+// separated, and relative to the directory walked by the rewriter.
+type Handler interface {
+	// Name is the type name selecting the handler, as in Rewriter.Types.
+	Name() string
+	// Match reports whether the handler rewrites the file path.
+	Match(path string) bool
+	// Rewrite returns the content src of path with the import paths
+	// replaced by m.
+	Rewrite(path string, src []byte, m Mapper) ([]byte, error)
+}
+
+// TypeGo is the type of golang source files, which are always handled by
+// the rewriter itself, along with go.mod and vendor/modules.txt files.
+const TypeGo = "go"
+
+var builtinHandlers = map[string]Handler{
+	"proto":  protoHandler{},
+	"bazel":  bazelHandler{},
+	"make":   makeHandler{},
+	"docker": dockerHandler{},
+}
+
+// Types returns the names of all file types known to the rewriter.
+func (r *Rewriter) Types() []string {
+	names := []string{TypeGo}
+	for name := range builtinHandlers {
+		names = append(names, name)
+	}
+	for _, h := range r.custom {
+		names = append(names, h.Name())
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// AddHandler registers a custom handler, enabled whatever FileTypes is.
+func (r *Rewriter) AddHandler(h Handler) {
+	r.custom = append(r.custom, h)
+}
+
+// handlers returns the handlers of FileTypes besides golang source files,
+// and whether golang source files are handled.
+func (r *Rewriter) handlers() ([]Handler, bool, error) {
+	types := r.FileTypes
+	if len(types) == 0 {
+		types = []string{TypeGo}
+	}
+
+	var (
+		hs     []Handler
+		goType bool
+	)
+	for _, t := range types {
+		if t == TypeGo {
+			goType = true
+			continue
+		}
+
+		h, ok := builtinHandlers[t]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown file type %q, want one of %s", t, strings.Join(r.Types(), ","))
+		}
+		hs = append(hs, h)
+	}
+	return append(hs, r.custom...), goType, nil
+}
+
+// handlerFor returns the handler of the file path, or nil if it is a
+// golang file, as reported by the second result.
+func (r *Rewriter) handlerFor(path string) (Handler, bool) {
+	hs, goType, _ := r.handlers()
+	if goType && isGoFile(path) {
+		return nil, true
+	}
+
+	rel := relPath(r.root, path)
+	for _, h := range hs {
+		if h.Match(rel) {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func isGoFile(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasSuffix(name, ".go") || name == "go.mod" || isWorkFile(name) || isModulesTxt(path)
+}
+
+// mapper returns the Mapper of the rules in the file, appending the
+// replacements it makes to hits as replacers of kind.
+func (r *Rewriter) mapper(file, kind string, hits *[]*replacer) Mapper {
+	return func(path string) (string, bool) {
+		rule, np, ok := r.match(file, path)
+		if !ok || np == path {
+			return path, false
+		}
+		*hits = append(*hits, &replacer{oldPath: path, newPath: np, rule: rule, kind: kind})
+		return np, true
+	}
+}
+
+// rewriteSubmatch replaces the first capture group of every match of re in
+// src by m.
+func rewriteSubmatch(re *regexp.Regexp, src []byte, m Mapper) []byte {
+	var edits []textEdit
+	for _, loc := range re.FindAllSubmatchIndex(src, -1) {
+		if np, ok := m(string(src[loc[2]:loc[3]])); ok {
+			edits = append(edits, textEdit{start: loc[2], end: loc[3], text: np})
+		}
+	}
+	return applyEdits(src, edits)
+}
+
+// rewriteArgs returns the edits of the white space separated arguments of
+// line, at offset base, which are import paths replaced by m. A version
+// suffix, as in example.com/tool@v1.0.0, is kept.
+func rewriteArgs(line string, base int, m Mapper) []textEdit {
+	var edits []textEdit
+	for _, f := range fieldsIndex(line) {
+		path := line[f[0]:f[1]]
+		if i := strings.IndexByte(path, '@'); i >= 0 {
+			path = path[:i]
+		}
+		if np, ok := m(path); ok {
+			edits = append(edits, textEdit{start: base + f[0], end: base + f[0] + len(path), text: np})
+		}
+	}
+	return edits
+}
+
+// bazelImportPathRe matches the importpath attributes of Bazel rules, the
+// import path being its first group.
+var bazelImportPathRe = regexp.MustCompile(`importpath\s*=\s*"([^"]*)"`)
+
+// bazelHandler rewrites the importpath attributes of Bazel build files.
+type bazelHandler struct{}
+
+func (bazelHandler) Name() string { return "bazel" }
+
+func (bazelHandler) Match(path string) bool {
+	switch filepath.Base(path) {
+	case "BUILD", "BUILD.bazel", "WORKSPACE", "WORKSPACE.bazel":
+		return true
+	}
+	return filepath.Ext(path) == ".bzl"
+}
+
+func (bazelHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	return rewriteSubmatch(bazelImportPathRe, src, m), nil
+}
+
+// goCommands are the go subcommands whose package arguments are rewritten
+// in Makefiles and Dockerfiles.
+var goCommands = map[string]bool{
+	"build": true, "install": true, "run": true, "get": true,
+	"test": true, "vet": true, "list": true, "generate": true,
+}
+
+// rewriteGoCommands rewrites the arguments of the go commands, such as
+// go build example.com/cmd/foo, found in the lines of src.
+func rewriteGoCommands(src []byte, m Mapper) []byte {
+	var edits []textEdit
+	offset := 0
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		fields := fieldsIndex(line)
+		for i := 0; i+1 < len(fields); i++ {
+			f, sub := fields[i], fields[i+1]
+			if line[f[0]:f[1]] == "go" && goCommands[line[sub[0]:sub[1]]] {
+				edits = append(edits, rewriteArgs(line[sub[1]:], offset+sub[1], m)...)
+				break
+			}
+		}
+		offset += len(line)
+	}
+	return applyEdits(src, edits)
+}
+
+// makeHandler rewrites the go commands of Makefiles.
+type makeHandler struct{}
+
+func (makeHandler) Name() string { return "make" }
+
+func (makeHandler) Match(path string) bool {
+	switch filepath.Base(path) {
+	case "Makefile", "makefile", "GNUmakefile":
+		return true
+	}
+	return filepath.Ext(path) == ".mk"
+}
+
+func (makeHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	return rewriteGoCommands(src, m), nil
+}
+
+// dockerHandler rewrites the go commands of Dockerfiles.
+type dockerHandler struct{}
+
+func (dockerHandler) Name() string { return "docker" }
+
+func (dockerHandler) Match(path string) bool {
+	name := filepath.Base(path)
+	return name == "Dockerfile" || strings.HasPrefix(name, "Dockerfile.") || strings.HasSuffix(name, ".dockerfile")
+}
+
+func (dockerHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	return rewriteGoCommands(src, m), nil
+}
@@ -0,0 +1,173 @@
+package yolk
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the files listing the paths never rewritten, in
+// the syntax of .gitignore files. An ignore file applies to the directory
+// holding it and the directories under it, where nested ignore files take
+// precedence.
+const IgnoreFile = ".yolkignore"
+
+// ignoreRule is a pattern of an ignore file.
+type ignoreRule struct {
+	pattern string
+
+	// negate re-includes the paths matched by a !pattern, dirOnly only
+	// matches directories, as a pattern ending with a slash does, and
+	// anchored matches the pattern relative to the directory of the ignore
+	// file rather than against the last path element at any depth.
+	negate, dirOnly, anchored bool
+}
+
+// ignoreList is the rules of an ignore file.
+type ignoreList struct {
+	// file is the slash separated path of the ignore file relative to the
+	// walked directory.
+	file  string
+	rules []ignoreRule
+}
+
+// parseIgnore returns the rules of an ignore file in the .gitignore syntax.
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// match reports whether the rule matches the slash separated path name
+// relative to the directory of its ignore file.
+func (rule ignoreRule) match(name string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+
+	pattern := rule.pattern
+	if foldPaths {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	if !rule.anchored {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// ignoreLists returns the rules of the ignore files of the directory dir,
+// relative to the walked directory root, read once per run.
+func (r *Rewriter) ignoreLists(root, dir string) []ignoreList {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if lists, ok := r.ignores[dir]; ok {
+		return lists
+	}
+
+	var lists []ignoreList
+	if data, err := r.fs().ReadFile(filepath.Join(dir, IgnoreFile)); err == nil {
+		lists = append(lists, ignoreList{file: relPath(root, filepath.Join(dir, IgnoreFile)), rules: parseIgnore(data)})
+	}
+
+	if r.ignores == nil {
+		r.ignores = make(map[string][]ignoreList)
+	}
+	r.ignores[dir] = lists
+	return lists
+}
+
+// resetIgnores forgets the ignore files, build constraints and package
+// names read by a previous run, before walking dir, and lists the paths git
+// ignores under dir if it is in a git repository on disk.
+func (r *Rewriter) resetIgnores(dir string) {
+	r.ignores = nil
+	r.builds = nil
+	r.pkgName = nil
+
+	r.gitIgn = nil
+	if r.RespectGitignore && r.FS == nil && InGitRepo(dir) {
+		ignored, err := gitIgnoredPaths(dir)
+		if err != nil {
+			r.Log.Warnf("list the paths ignored by git in %s fails due to %v", dir, err)
+		}
+		r.gitIgn = ignored
+	}
+}
+
+// ignored returns the ignore file excluding path, walked from root, if any.
+// The path is excluded if git ignores it, or if it or one of its parent
+// directories under root is matched by the last matching rule of the
+// ignore files of the directories above it.
+func (r *Rewriter) ignored(root, path string, isDir bool) (string, bool) {
+	rel := relPath(root, path)
+	if rel == "." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+
+	elems := strings.Split(rel, "/")
+	for n := len(elems); n > 0 && r.gitIgn != nil; n-- {
+		if r.gitIgn[strings.Join(elems[:n], "/")] {
+			return "git", true
+		}
+	}
+	for n := 1; n <= len(elems); n++ {
+		if file, ok := r.ignoredElems(root, elems[:n], isDir || n < len(elems)); ok {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// ignoredElems returns the ignore file whose last matching rule excludes
+// the path of elems relative to root, if any.
+func (r *Rewriter) ignoredElems(root string, elems []string, isDir bool) (string, bool) {
+	var (
+		file    string
+		ignored bool
+	)
+	dir := root
+	for i := range elems {
+		name := strings.Join(elems[i:], "/")
+		for _, list := range r.ignoreLists(root, dir) {
+			for _, rule := range list.rules {
+				if rule.match(name, isDir) {
+					file, ignored = list.file, !rule.negate
+				}
+			}
+		}
+		dir = filepath.Join(dir, elems[i])
+	}
+	return file, ignored
+}
@@ -0,0 +1,128 @@
+package yolk
+
+import (
+	"os/exec"
+	"sort"
+	"testing"
+)
+
+func TestIgnoreFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignores map[string]string
+		files   []string
+		ignored []string
+	}{
+		{
+			name:    "base name",
+			ignores: map[string]string{IgnoreFile: "# generated\n*_gen.go\n"},
+			files:   []string{"a.go", "a_gen.go", "pkg/b_gen.go"},
+			ignored: []string{"a_gen.go", "pkg/b_gen.go"},
+		},
+		{
+			name:    "anchored",
+			ignores: map[string]string{IgnoreFile: "/a.go\npkg/*/c.go\n"},
+			files:   []string{"a.go", "pkg/a.go", "pkg/x/c.go", "pkg/x/y/c.go"},
+			ignored: []string{"a.go", "pkg/x/c.go"},
+		},
+		{
+			name:    "directory",
+			ignores: map[string]string{IgnoreFile: "third_party/\nb.go/\n"},
+			files:   []string{"b.go", "third_party/a.go", "pkg/third_party/a.go"},
+			ignored: []string{"third_party/a.go", "pkg/third_party/a.go"},
+		},
+		{
+			name:    "negation",
+			ignores: map[string]string{IgnoreFile: "*.go\n!keep.go\n"},
+			files:   []string{"a.go", "keep.go", "pkg/keep.go"},
+			ignored: []string{"a.go"},
+		},
+		{
+			name:    "negated directory",
+			ignores: map[string]string{IgnoreFile: "gen/\n!gen/keep.go\n"},
+			files:   []string{"gen/a.go", "gen/keep.go"},
+			ignored: []string{"gen/a.go", "gen/keep.go"},
+		},
+		{
+			name: "nested",
+			ignores: map[string]string{
+				IgnoreFile:              "*_mock.go\n",
+				"api/" + IgnoreFile:     "!api_mock.go\n/local.go\n",
+				"api/sub/" + IgnoreFile: "\\#a.go\n",
+			},
+			files:   []string{"a_mock.go", "local.go", "api/api_mock.go", "api/b_mock.go", "api/local.go", "api/sub/local.go", "api/sub/#a.go"},
+			ignored: []string{"a_mock.go", "api/b_mock.go", "api/local.go", "api/sub/#a.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string][]byte)
+			for name, data := range tt.ignores {
+				files[name] = []byte(data)
+			}
+			for _, name := range tt.files {
+				files[name] = []byte(oldSource)
+			}
+			mem := NewMemFS(files)
+			r := newMemRewriter(t)
+			r.FS = IOFS(mem)
+			if err := r.RewriteDir("."); err != nil {
+				t.Fatal(err)
+			}
+
+			var ignored []string
+			for name, data := range mem.Files() {
+				if string(data) == oldSource {
+					ignored = append(ignored, name)
+				}
+			}
+			sort.Strings(ignored)
+			sort.Strings(tt.ignored)
+			if !equalStrings(ignored, tt.ignored) {
+				t.Errorf("RewriteDir() ignores %q, want %q", ignored, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestRespectGitignore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	for _, respect := range []bool{false, true} {
+		dir := t.TempDir()
+		if _, err := git(dir, "init", "-q"); err != nil {
+			t.Fatal(err)
+		}
+		writeTree(t, dir, map[string]string{
+			".gitignore":   "/build/\n*_local.go\n",
+			"a.go":         oldSource,
+			"a_local.go":   oldSource,
+			"build/b.go":   oldSource,
+			"pkg/build.go": oldSource,
+		})
+
+		r := newMemRewriter(t)
+		r.RespectGitignore = respect
+		if err := r.RewriteDir(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		var ignored []string
+		for name, data := range readTree(t, dir) {
+			if data == oldSource {
+				ignored = append(ignored, name)
+			}
+		}
+		sort.Strings(ignored)
+		var want []string
+		if respect {
+			want = []string{"a_local.go", "build/b.go"}
+		}
+		if !equalStrings(ignored, want) {
+			t.Errorf("RewriteDir() with RespectGitignore %v ignores %q, want %q", respect, ignored, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+)
+
+// importCommentRe matches the import comment of a package clause, as in
+//
+//	package foo // import "example.com/foo"
+//	package foo /* import "example.com/foo" */
+var importCommentRe = regexp.MustCompile(`^(?://|/\*)\s*import\s+("[^"]*"|` + "`[^`]*`" + `)\s*(?:\*/)?$`)
+
+// rewriteImportComment returns the edit rewriting the canonical import path
+// annotation of the package clause of file, or dropping it in
+// DropImportComments mode.
+func (r *Rewriter) rewriteImportComment(fset *token.FileSet, file *ast.File) ([]textEdit, []*replacer) {
+	line := fset.Position(file.Name.End()).Line
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			if c.Pos() < file.Name.End() || fset.Position(c.Pos()).Line != line {
+				continue
+			}
+
+			m := importCommentRe.FindStringSubmatchIndex(c.Text)
+			if m == nil {
+				return nil, nil
+			}
+
+			old, err := strconv.Unquote(c.Text[m[2]:m[3]])
+			if err != nil {
+				return nil, nil
+			}
+
+			start, end := fset.Position(c.Pos()).Offset, fset.Position(c.End()).Offset
+			if r.DropImportComments {
+				// the blank between the package name and the comment goes too
+				name := fset.Position(file.Name.End()).Offset
+				return []textEdit{{start: name, end: end}}, nil
+			}
+
+			rule, np, ok := r.match(fset.File(file.Pos()).Name(), old)
+			if !ok || np == old {
+				return nil, nil
+			}
+
+			edit := textEdit{start: start + m[2], end: start + m[3], text: strconv.Quote(np)}
+			pos := fset.Position(c.Pos() + token.Pos(m[2]))
+			return []textEdit{edit}, []*replacer{{oldPath: old, newPath: np, rule: rule, kind: kindComment, pos: pos}}
+		}
+	}
+	return nil, nil
+}
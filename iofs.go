@@ -0,0 +1,227 @@
+package yolk
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriteFS is an fs.FS whose files can be replaced.
+type WriteFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// IOFS returns the FileSystem of fsys, such as a MemFS, an archive read with
+// archive/zip or an os.DirFS. Names given to RewriteDir are slash separated
+// paths of fsys, "." being its root. The files are written if fsys is a
+// WriteFS, writing fails otherwise: a read-only fsys is meant for DryRun.
+func IOFS(fsys fs.FS) FileSystem {
+	return ioFS{fsys}
+}
+
+type ioFS struct{ fsys fs.FS }
+
+// name returns the fs.FS path of name, joined by the rewriter.
+func (f ioFS) name(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(f.fsys, f.name(name)) }
+
+// Lstat is Stat, fs.FS has no symlinks.
+func (f ioFS) Lstat(name string) (fs.FileInfo, error) { return fs.Stat(f.fsys, f.name(name)) }
+
+func (f ioFS) ReadFile(name string) ([]byte, error) { return fs.ReadFile(f.fsys, f.name(name)) }
+
+func (f ioFS) ReadDir(name string) ([]string, error) {
+	entries, err := fs.ReadDir(f.fsys, f.name(name))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+func (f ioFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	w, ok := f.fsys.(WriteFS)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+	}
+	return w.WriteFile(f.name(name), data, perm)
+}
+
+// MemFS is a WriteFS holding its files in memory, by slash separated path
+// such as "cmd/main.go". Directories are implied by the paths of the files.
+// The zero MemFS is empty and ready to use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMemFS returns a MemFS holding a copy of files.
+func NewMemFS(files map[string][]byte) *MemFS {
+	m := new(MemFS)
+	for name, data := range files {
+		m.WriteFile(name, data, 0644)
+	}
+	return m
+}
+
+// WriteFile creates or replaces the file name.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isDir(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrExist}
+	}
+	if m.files == nil {
+		m.files = make(map[string]*memFile)
+	}
+	m.files[name] = &memFile{data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+// Files returns a copy of the files of m.
+func (m *MemFS) Files() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := make(map[string][]byte, len(m.files))
+	for name, f := range m.files {
+		files[name] = append([]byte(nil), f.data...)
+	}
+	return files
+}
+
+// isDir reports whether name is the root or holds a file.
+func (m *MemFS) isDir(name string) bool {
+	if name == "." {
+		return true
+	}
+	for file := range m.files {
+		if strings.HasPrefix(file, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Open implements fs.FS.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.files[name]; ok {
+		info := memInfo{name: path.Base(name), size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+		return &memReader{Reader: bytes.NewReader(f.data), info: info}, nil
+	}
+	if !m.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// the entries of a directory are the first path elements of the
+	// files under it
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	entries := make(map[string]memInfo)
+	for file, f := range m.files {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		elem := strings.TrimPrefix(file, prefix)
+		if i := strings.Index(elem, "/"); i >= 0 {
+			entries[elem[:i]] = memInfo{name: elem[:i], mode: fs.ModeDir | 0755}
+		} else {
+			entries[elem] = memInfo{name: elem, size: int64(len(f.data)), mode: f.mode, modTime: f.modTime}
+		}
+	}
+	dir := &memDir{info: memInfo{name: path.Base(name), mode: fs.ModeDir | 0755}}
+	for _, info := range entries {
+		dir.entries = append(dir.entries, info)
+	}
+	sort.Slice(dir.entries, func(i, j int) bool { return dir.entries[i].name < dir.entries[j].name })
+	return dir, nil
+}
+
+// memInfo is the fs.FileInfo and fs.DirEntry of a file or directory of a
+// MemFS.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string               { return i.name }
+func (i memInfo) Size() int64                { return i.size }
+func (i memInfo) Mode() fs.FileMode          { return i.mode }
+func (i memInfo) ModTime() time.Time         { return i.modTime }
+func (i memInfo) IsDir() bool                { return i.mode.IsDir() }
+func (i memInfo) Sys() interface{}           { return nil }
+func (i memInfo) Type() fs.FileMode          { return i.mode.Type() }
+func (i memInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+// memReader is an open file of a MemFS.
+type memReader struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memReader) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memReader) Close() error               { return nil }
+
+// memDir is an open directory of a MemFS.
+type memDir struct {
+	info    memInfo
+	entries []memInfo
+	off     int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.off += len(rest)
+
+	entries := make([]fs.DirEntry, len(rest))
+	for i, info := range rest {
+		entries[i] = info
+	}
+	return entries, nil
+}
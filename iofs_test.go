@@ -0,0 +1,249 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	oldSource = "package a\n\nimport \"old.corp/lib/foo\"\n\nvar _ = foo.X\n"
+	newSource = "package a\n\nimport \"new.corp/lib/foo\"\n\nvar _ = foo.X\n"
+	otherFile = "package a\n\nimport \"fmt\"\n\nvar _ = fmt.Println\n"
+	goModFile = "module old.corp/app\n\ngo 1.16\n\nrequire old.corp/lib v1.0.0\n"
+)
+
+func newMemRewriter(t *testing.T) *Rewriter {
+	t.Helper()
+	r := NewRewriter()
+	if err := r.AddRule("old.corp/lib", "new.corp/lib"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRewriteDirMemFS(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *Rewriter)
+		files map[string]string
+		want  map[string]string
+	}{
+		{
+			name: "nested packages",
+			files: map[string]string{
+				"go.mod":            goModFile,
+				"a.go":              oldSource,
+				"b.go":              otherFile,
+				"pkg/sub/c.go":      oldSource,
+				"pkg/testdata/d.go": oldSource,
+			},
+			want: map[string]string{
+				"go.mod":            goModFile,
+				"a.go":              newSource,
+				"b.go":              otherFile,
+				"pkg/sub/c.go":      newSource,
+				"pkg/testdata/d.go": newSource,
+			},
+		},
+		{
+			name: "build variants",
+			files: map[string]string{
+				"a_windows.go": oldSource,
+				"a_plan9.go":   oldSource,
+				"gen.go":       "//go:build ignore\n\n" + oldSource,
+			},
+			want: map[string]string{
+				"a_windows.go": newSource,
+				"a_plan9.go":   newSource,
+				"gen.go":       "//go:build ignore\n\n" + newSource,
+			},
+		},
+		{
+			name: "vendor directory skipped",
+			files: map[string]string{
+				"a.go":                         oldSource,
+				"vendor/old.corp/lib/foo/f.go": oldSource,
+			},
+			want: map[string]string{
+				"a.go":                         newSource,
+				"vendor/old.corp/lib/foo/f.go": oldSource,
+			},
+		},
+		{
+			name:  "excluded paths",
+			setup: func(r *Rewriter) { r.Exclude = []string{"gen/**", "*_gen.go"} },
+			files: map[string]string{
+				"a.go":       oldSource,
+				"a_gen.go":   oldSource,
+				"gen/b/b.go": oldSource,
+			},
+			want: map[string]string{
+				"a.go":       newSource,
+				"a_gen.go":   oldSource,
+				"gen/b/b.go": oldSource,
+			},
+		},
+		{
+			name: "ignore file",
+			files: map[string]string{
+				IgnoreFile:         "third_party/\n",
+				"a.go":             oldSource,
+				"third_party/b.go": oldSource,
+			},
+			want: map[string]string{
+				IgnoreFile:         "third_party/\n",
+				"a.go":             newSource,
+				"third_party/b.go": oldSource,
+			},
+		},
+		{
+			name:  "go.mod",
+			setup: func(r *Rewriter) { r.GoMod = true },
+			files: map[string]string{
+				"go.mod": goModFile,
+				"a.go":   oldSource,
+			},
+			want: map[string]string{
+				"go.mod": "module old.corp/app\n\ngo 1.16\n\nrequire new.corp/lib v1.0.0\n",
+				"a.go":   newSource,
+			},
+		},
+		{
+			name:  "dry run",
+			setup: func(r *Rewriter) { r.DryRun = true },
+			files: map[string]string{
+				"a.go":     oldSource,
+				"pkg/b.go": oldSource,
+			},
+			want: map[string]string{
+				"a.go":     oldSource,
+				"pkg/b.go": oldSource,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string][]byte)
+			for name, data := range tt.files {
+				files[name] = []byte(data)
+			}
+			mem := NewMemFS(files)
+
+			r := newMemRewriter(t)
+			r.FS = IOFS(mem)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			if err := r.RewriteDir("."); err != nil {
+				t.Fatalf("RewriteDir() fails: %v", err)
+			}
+
+			got := mem.Files()
+			if len(got) != len(tt.want) {
+				t.Errorf("RewriteDir() left %d files, want %d", len(got), len(tt.want))
+			}
+			for name, want := range tt.want {
+				if string(got[name]) != want {
+					t.Errorf("%s =\n%s\nwant\n%s", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteDirMemFSSummary(t *testing.T) {
+	mem := NewMemFS(map[string][]byte{
+		"a.go":     []byte(oldSource),
+		"b.go":     []byte(otherFile),
+		"pkg/c.go": []byte(oldSource),
+	})
+	r := newMemRewriter(t)
+	r.FS = IOFS(mem)
+	if err := r.RewriteDir("."); err != nil {
+		t.Fatalf("RewriteDir() fails: %v", err)
+	}
+
+	s := r.Summary()
+	if s.FilesScanned != 3 || s.FilesChanged != 2 || s.FilesFailed != 0 {
+		t.Errorf("RewriteDir() scanned %d, changed %d and failed %d files, want 3, 2 and 0", s.FilesScanned, s.FilesChanged, s.FilesFailed)
+	}
+}
+
+func TestRewriteDirReadOnlyFS(t *testing.T) {
+	fsys := fstest.MapFS{"a.go": &fstest.MapFile{Data: []byte(oldSource), Mode: 0644}}
+
+	r := newMemRewriter(t)
+	r.FS = IOFS(fsys)
+	r.DryRun = true
+	if err := r.RewriteDir("."); err != nil {
+		t.Fatalf("RewriteDir() fails in dry run mode: %v", err)
+	}
+	if s := r.Summary(); s.FilesChanged != 1 {
+		t.Errorf("RewriteDir() changed %d files in dry run mode, want 1", s.FilesChanged)
+	}
+
+	r = newMemRewriter(t)
+	r.FS = IOFS(fsys)
+	if err := r.RewriteDir("."); err == nil {
+		t.Errorf("RewriteDir() succeeds writing a read-only FS")
+	}
+	if got := string(fsys["a.go"].Data); got != oldSource {
+		t.Errorf("a.go =\n%s\nwant it unchanged", got)
+	}
+}
+
+func TestRewriteDirFSOptions(t *testing.T) {
+	for name, setup := range map[string]func(r *Rewriter){
+		"journal":    func(r *Rewriter) { r.Journal = true },
+		"backup dir": func(r *Rewriter) { r.BackupDir = DefaultBackupDir },
+		"typed":      func(r *Rewriter) { r.Typed = true },
+	} {
+		r := newMemRewriter(t)
+		r.FS = IOFS(NewMemFS(map[string][]byte{"a.go": []byte(oldSource)}))
+		setup(r)
+		if err := r.RewriteDir("."); err == nil {
+			t.Errorf("RewriteDir() with %s succeeds on a MemFS", name)
+		}
+	}
+}
+
+func TestRewriteDirJobs(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 64; i++ {
+		src := oldSource
+		if i%4 == 0 {
+			src = otherFile
+		}
+		files[fmt.Sprintf("pkg%d/f%d.go", i%8, i)] = []byte(src)
+	}
+
+	for _, jobs := range []int{1, 4, 0} {
+		mem := NewMemFS(files)
+		var out bytes.Buffer
+		r := newMemRewriter(t)
+		r.FS = IOFS(mem)
+		r.Jobs = jobs
+		r.Reporter = &ListReporter{W: &out}
+		if err := r.RewriteDir("."); err != nil {
+			t.Fatalf("RewriteDir() with %d jobs fails: %v", jobs, err)
+		}
+
+		if s := r.Summary(); s.FilesScanned != 64 || s.FilesChanged != 48 {
+			t.Errorf("RewriteDir() with %d jobs scans %d and changes %d files, want 64 and 48", jobs, s.FilesScanned, s.FilesChanged)
+		}
+		reported := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if !sort.StringsAreSorted(reported) {
+			t.Errorf("RewriteDir() with %d jobs reports the files out of order: %q", jobs, reported)
+		}
+		for name, data := range mem.Files() {
+			if want := files[name]; string(want) == oldSource && string(data) != newSource {
+				t.Errorf("RewriteDir() with %d jobs leaves %s unchanged", jobs, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package yolk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JournalFile is the path of the journal of the last run, relative to the
+// walked directory.
+var JournalFile = filepath.Join(".yolk", "journal.json")
+
+// Journal records the files written by a run, so it can be undone.
+type Journal struct {
+	Time    time.Time      `json:"time"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// JournalEntry is a file written by a run, along with its old content.
+type JournalEntry struct {
+	// Path is relative to the walked directory.
+	Path    string      `json:"path"`
+	Perm    os.FileMode `json:"perm"`
+	OldHash string      `json:"old_hash"`
+	NewHash string      `json:"new_hash"`
+	Rules   []string    `json:"rules"`
+	Old     []byte      `json:"old"`
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// makeIgnoredDir creates the directory dir of the files yolk keeps for
+// itself, with a .gitignore file keeping them out of git add --all.
+func makeIgnoredDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*\n"), 0644)
+}
+
+// writeJournal replaces the journal of dir with the changed files among
+// written.
+func (r *Rewriter) writeJournal(dir string, written []*fileResult) error {
+	j := Journal{Time: time.Now()}
+	for _, res := range written {
+		if res.skipped != "" || bytes.Equal(res.src, res.dst) {
+			continue
+		}
+
+		var rules []string
+		seen := make(map[int]bool)
+		for _, rp := range res.replacers {
+			if !seen[rp.rule] {
+				seen[rp.rule] = true
+				rules = append(rules, r.rules[rp.rule].String())
+			}
+		}
+
+		j.Entries = append(j.Entries, JournalEntry{
+			Path:    relPath(dir, res.path),
+			Perm:    res.perm,
+			OldHash: hashOf(res.src),
+			NewHash: hashOf(res.dst),
+			Rules:   rules,
+			Old:     res.src,
+		})
+	}
+	if len(j.Entries) == 0 {
+		return nil
+	}
+
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&j); err != nil {
+		return err
+	}
+
+	if err := makeIgnoredDir(filepath.Join(dir, filepath.Dir(JournalFile))); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, JournalFile), data.Bytes(), 0644)
+}
+
+// Undo reverts the files written by the last run in dir, as recorded by its
+// journal. Nothing is restored unless every file is still the way the run
+// left it. The journal is removed once all files are restored.
+func Undo(dir string) error {
+	path := filepath.Join(dir, JournalFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("read journal %s fails due to %v", path, err)
+	}
+
+	var errs Errors
+	current := make([][]byte, len(j.Entries))
+	for i, e := range j.Entries {
+		name := filepath.Join(dir, filepath.FromSlash(e.Path))
+		cur, err := ioutil.ReadFile(name)
+		if err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+			continue
+		}
+		if hashOf(cur) != e.NewHash {
+			errs = append(errs, &FileError{Path: name, Err: fmt.Errorf("modified since the run of %s", j.Time.Format(time.RFC3339))})
+			continue
+		}
+		if hashOf(e.Old) != e.OldHash {
+			errs = append(errs, &FileError{Path: name, Err: fmt.Errorf("journal entry is corrupted")})
+			continue
+		}
+		current[i] = cur
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	for i, e := range j.Entries {
+		name := filepath.Join(dir, filepath.FromSlash(e.Path))
+		if err := writeFile(name, current[i], e.Old, e.Perm); err != nil {
+			errs = append(errs, &FileError{Path: name, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return os.Remove(path)
+}
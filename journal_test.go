@@ -0,0 +1,65 @@
+package yolk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalUndo(t *testing.T) {
+	files := map[string]string{"a.go": oldSource, "b.go": otherFile, "pkg/c.go": oldSource}
+
+	tests := []struct {
+		name    string
+		journal bool
+		modify  bool
+		undone  bool
+	}{
+		{name: "undone", journal: true, undone: true},
+		{name: "no journal", journal: false},
+		{name: "modified since", journal: true, modify: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, files)
+
+			r := newMemRewriter(t)
+			r.Journal = tt.journal
+			if err := r.RewriteDir(dir); err != nil {
+				t.Fatalf("RewriteDir() fails: %v", err)
+			}
+			_, err := os.Stat(filepath.Join(dir, JournalFile))
+			if journaled := err == nil; journaled != tt.journal {
+				t.Errorf("RewriteDir() writes a journal: %v, want %v", journaled, tt.journal)
+			}
+			if tt.modify {
+				if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(otherFile), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = Undo(dir)
+			if undone := err == nil; undone != tt.undone {
+				t.Fatalf("Undo() succeeds: %v (%v), want %v", undone, err, tt.undone)
+			}
+			if !tt.undone {
+				if got := readTree(t, dir)["pkg/c.go"]; got != newSource {
+					t.Errorf("pkg/c.go =\n%s\nwant it left rewritten", got)
+				}
+				return
+			}
+			got := readTree(t, dir)
+			for name, want := range files {
+				if got[name] != want {
+					t.Errorf("%s =\n%s\nwant\n%s", name, got[name], want)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, JournalFile)); !os.IsNotExist(err) {
+				t.Errorf("Undo() leaves the journal")
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package yolk
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Policy forbids the golang source files it applies to from importing the
+// paths it denies, as checked by Lint: corp/internal/experimental is never
+// imported outside experimental/**.
+type Policy struct {
+	// Deny is the import path denied, matched in Mode, as a prefix by
+	// default.
+	Deny string    `yaml:"deny" json:"deny"`
+	Mode MatchMode `yaml:"mode" json:"mode"`
+	// Allow lists the import paths the policy still allows, along with the
+	// paths under them: corp denied but corp/public allowed is an
+	// allowlist of the packages of corp.
+	Allow []string `yaml:"allow" json:"allow,omitempty"`
+	// Include, if not empty, restricts the policy to the files matching
+	// any of its glob patterns, and Exclude lists the patterns of the files
+	// allowed to import the denied paths, in the syntax of the Exclude of
+	// a Rewriter.
+	Include []string `yaml:"include" json:"include,omitempty"`
+	Exclude []string `yaml:"exclude" json:"exclude,omitempty"`
+	// Reason, if not empty, tells why the paths are denied.
+	Reason string `yaml:"reason" json:"reason,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (p *Policy) validate() error {
+	if p.Deny == "" {
+		return fmt.Errorf("policy must have a denied import path")
+	}
+
+	switch p.Mode {
+	case "":
+		p.Mode = MatchPrefix
+	case MatchPrefix, MatchExact:
+	case MatchRegex:
+		re, err := regexp.Compile(p.Deny)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of policy %s: %v", p.Deny, err)
+		}
+		p.re = re
+	default:
+		return fmt.Errorf("unknown match mode %q of policy %s", p.Mode, p.Deny)
+	}
+	return nil
+}
+
+// denies reports whether the policy forbids the file of slash separated
+// path rel, relative to the walked directory, from importing path.
+func (p *Policy) denies(rel, path string) bool {
+	switch p.Mode {
+	case MatchExact:
+		if path != p.Deny {
+			return false
+		}
+	case MatchRegex:
+		if !p.re.MatchString(path) {
+			return false
+		}
+	default:
+		if !hasPathPrefix(path, p.Deny) {
+			return false
+		}
+	}
+
+	for _, a := range p.Allow {
+		if hasPathPrefix(path, a) {
+			return false
+		}
+	}
+	if len(p.Include) > 0 {
+		if _, ok := matchAny(p.Include, rel); !ok {
+			return false
+		}
+	}
+	_, excluded := matchAny(p.Exclude, rel)
+	return !excluded
+}
+
+// String returns the policy in the form of "deny path (mode)", followed by
+// the allowed paths as "but path", and the scope as "in include, except
+// exclude".
+func (p Policy) String() string {
+	s := fmt.Sprintf("deny %s (%s)", p.Deny, p.Mode)
+	if len(p.Allow) > 0 {
+		s += " but " + strings.Join(p.Allow, ", ")
+	}
+	if len(p.Include) > 0 {
+		s += " in " + strings.Join(p.Include, ", ")
+	}
+	if len(p.Exclude) > 0 {
+		s += " except " + strings.Join(p.Exclude, ", ")
+	}
+	return s
+}
+
+// AddPolicy adds a policy checked by Lint.
+func (r *Rewriter) AddPolicy(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	r.policy = append(r.policy, p)
+	return nil
+}
+
+// Violation is an import denied by a policy.
+type Violation struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Import string `json:"import"`
+	Policy string `json:"policy"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// String returns the violation in the form of "path:line:column: import
+// path denied by policy: reason".
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s:%d:%d: import %s denied by %s", v.Path, v.Line, v.Column, v.Import, v.Policy)
+	if v.Reason != "" {
+		s += ": " + v.Reason
+	}
+	return s
+}
+
+// Lint checks the imports of the golang source files walked from dir, that
+// RewriteDir would rewrite, against the policies, and returns the imports
+// they deny, by file and position. Nothing is rewritten. An import denied
+// by several policies is reported once, for the first of them.
+func (r *Rewriter) Lint(dir string) ([]Violation, error) {
+	if len(r.policy) == 0 {
+		return nil, fmt.Errorf("no policy to check the imports against")
+	}
+
+	r.findModules(dir)
+	r.resetIgnores(dir)
+	r.root = dir
+
+	var violations []Violation
+	fset := token.NewFileSet()
+	err := r.walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ok, _, err := r.handle(dir, name, info)
+		if !ok || !strings.HasSuffix(name, ".go") {
+			return err
+		}
+
+		src, rerr := r.fs().ReadFile(name)
+		if rerr != nil {
+			return rerr
+		}
+		f, perr := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+		if perr != nil {
+			r.Log.Warnf("%v", perr)
+			return nil
+		}
+
+		rel := relPath(dir, name)
+		for _, imp := range f.Imports {
+			path := importPath(imp)
+			for i := range r.policy {
+				p := &r.policy[i]
+				if !p.denies(rel, path) {
+					continue
+				}
+				pos := fset.Position(imp.Path.Pos())
+				violations = append(violations, Violation{
+					Path:   name,
+					Line:   pos.Line,
+					Column: pos.Column,
+					Import: path,
+					Policy: p.String(),
+					Reason: p.Reason,
+				})
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+	return violations, nil
+}
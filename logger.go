@@ -0,0 +1,207 @@
+package yolk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the verbosity of a Logger.
+type Level int
+
+const (
+	// LevelQuiet only logs errors.
+	LevelQuiet Level = iota
+	// LevelInfo also logs warnings and notices, the default.
+	LevelInfo
+	// LevelVerbose also logs every changed or failing file.
+	LevelVerbose
+	// LevelDebug also logs every file handled, left unchanged or skipped.
+	LevelDebug
+)
+
+// Log formats of a Logger.
+const (
+	// LogText logs human readable lines.
+	LogText = "text"
+	// LogJSON logs an Event as a JSON object per line.
+	LogJSON = "json"
+)
+
+// Events logged by a rewriter.
+const (
+	EventFileStart   = "file_start"
+	EventFileChanged = "file_changed"
+	EventFileSkipped = "file_skipped"
+	EventError       = "error"
+	EventMessage     = "message"
+)
+
+// Event is a record of a Logger.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Path  string    `json:"path,omitempty"`
+
+	// Reason is why a file is skipped.
+	Reason string `json:"reason,omitempty"`
+	// Imports lists the paths rewritten in a changed file.
+	Imports []ImportChange `json:"imports,omitempty"`
+	// Error is the error of a failing file, or the text of an error event
+	// without a path.
+	Error string `json:"error,omitempty"`
+
+	// Level and Message are those of a message event: warning, info,
+	// verbose or debug.
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportChange is an import path rewritten by a rule.
+type ImportChange struct {
+	Rule string `json:"rule"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+var levelNames = map[Level]string{
+	LevelQuiet:   "error",
+	LevelInfo:    "info",
+	LevelVerbose: "verbose",
+	LevelDebug:   "debug",
+}
+
+// text returns the event as a human readable line.
+func (ev *Event) text() string {
+	switch ev.Event {
+	case EventFileStart:
+		return "handle " + ev.Path
+	case EventFileChanged:
+		return "rewrite " + ev.Path
+	case EventFileSkipped:
+		return fmt.Sprintf("skip %s: %s", ev.Path, ev.Reason)
+	case EventError:
+		if ev.Path != "" {
+			return fmt.Sprintf("fail %s: %s", ev.Path, ev.Error)
+		}
+		return "error: " + ev.Error
+	}
+
+	if ev.Level == "warning" {
+		return "warning: " + ev.Message
+	}
+	return ev.Message
+}
+
+// Logger prints the events of a rewriter up to its level, along with the
+// progress of RewriteDir. A nil Logger prints nothing.
+type Logger struct {
+	W     io.Writer
+	Level Level
+
+	// Format is either LogText, the default, or LogJSON.
+	Format string
+
+	// Progress keeps a line of W updated with the number of files handled
+	// so far, it is meant for terminals and only shown in text format.
+	Progress bool
+
+	mu   sync.Mutex
+	line int
+}
+
+// Log prints the event if level is enabled.
+func (l *Logger) Log(level Level, ev Event) {
+	if l == nil || level > l.Level {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Format == LogJSON {
+		enc := json.NewEncoder(l.W)
+		enc.SetEscapeHTML(false)
+		enc.Encode(&ev)
+		return
+	}
+
+	l.clearLine()
+	msg := ev.text()
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	io.WriteString(l.W, msg)
+}
+
+// Logf prints the message formatted as fmt.Sprintf does if level is
+// enabled.
+func (l *Logger) Logf(level Level, format string, args ...interface{}) {
+	l.Log(level, Event{Event: EventMessage, Level: levelNames[level], Message: fmt.Sprintf(format, args...)})
+}
+
+// Errorf prints an error message, whatever the level is.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.Log(LevelQuiet, Event{Event: EventError, Error: fmt.Sprintf(format, args...)})
+}
+
+// Warnf prints a warning message, unless quiet.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.Log(LevelInfo, Event{Event: EventMessage, Level: "warning", Message: fmt.Sprintf(format, args...)})
+}
+
+// Infof prints a notice, unless quiet.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.Logf(LevelInfo, format, args...)
+}
+
+// Verbosef prints a message at the verbose level.
+func (l *Logger) Verbosef(format string, args ...interface{}) {
+	l.Logf(LevelVerbose, format, args...)
+}
+
+// Debugf prints a message at the debug level.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.Logf(LevelDebug, format, args...)
+}
+
+// progress updates the progress line with the number of files done out of
+// total, and changed.
+func (l *Logger) progress(done, total, changed int) {
+	if l == nil || !l.Progress || l.Level == LevelQuiet || l.Format == LogJSON {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clearLine()
+	line := fmt.Sprintf("%d/%d files handled, %d changed", done, total, changed)
+	io.WriteString(l.W, line)
+	l.line = len(line)
+}
+
+// endProgress erases the progress line.
+func (l *Logger) endProgress() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clearLine()
+}
+
+func (l *Logger) clearLine() {
+	if l.line > 0 {
+		io.WriteString(l.W, "\r"+strings.Repeat(" ", l.line)+"\r")
+		l.line = 0
+	}
+}
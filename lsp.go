@@ -0,0 +1,371 @@
+package yolk
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// lspMaxMessage is the size in bytes above which the messages of the client
+// are rejected, rather than buffered.
+const lspMaxMessage = 64 << 20
+
+// LSPCommand is the command of the language server rewriting the imports
+// of an open document, taking its URI as argument.
+const LSPCommand = "yolk.rewrite"
+
+// JSON-RPC error codes.
+const (
+	lspParseError     = -32700
+	lspInvalidParams  = -32602
+	lspMethodNotFound = -32601
+)
+
+type lspRequest struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspWorkspaceEdit struct {
+	Changes map[string][]lspTextEdit `json:"changes"`
+}
+
+type lspCodeAction struct {
+	Title string            `json:"title"`
+	Kind  string            `json:"kind"`
+	Edit  *lspWorkspaceEdit `json:"edit"`
+}
+
+type lspDocument struct {
+	URI     string `json:"uri"`
+	Text    string `json:"text"`
+	Version int    `json:"version"`
+}
+
+// lspServer is a minimal language server offering the rewrite of the open
+// documents as a code action and a command.
+type lspServer struct {
+	r   *Rewriter
+	in  *bufio.Reader
+	out io.Writer
+
+	mu     sync.Mutex
+	docs   map[string]string
+	nextID int
+}
+
+// ServeLSP runs a language server speaking JSON-RPC over in and out, until
+// the client asks it to exit or in is closed. The server keeps the content
+// of the open documents, fully synchronized, and offers to rewrite their
+// import paths as a source code action and as the LSPCommand command,
+// without touching any file: the edits are applied by the editor.
+func (r *Rewriter) ServeLSP(in io.Reader, out io.Writer) error {
+	s := &lspServer{r: r, in: bufio.NewReader(in), out: out, docs: make(map[string]string)}
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req lspRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.reply(nil, nil, &lspError{Code: lspParseError, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		// notifications and responses to our requests are not answered
+		if req.ID != nil && req.Method != "" {
+			if err := s.reply(req.ID, result, rerr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle returns the result of a request, or of a notification.
+func (s *lspServer) handle(req *lspRequest) (interface{}, *lspError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			RootURI          string `json:"rootUri"`
+			WorkspaceFolders []struct {
+				URI string `json:"uri"`
+			} `json:"workspaceFolders"`
+		}
+		if err := json.Unmarshal(req.Params, &p); len(req.Params) > 0 && err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		// the rules scoped to some files match their path relative to the
+		// workspace folder, as they do relative to the walked directory
+		root := p.RootURI
+		if len(p.WorkspaceFolders) > 0 {
+			root = p.WorkspaceFolders[0].URI
+		}
+		if root != "" {
+			dir, err := uriPath(root)
+			if err != nil {
+				return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+			}
+			s.r.root = dir
+		}
+
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1,
+				"codeActionProvider":     true,
+				"executeCommandProvider": map[string]interface{}{"commands": []string{LSPCommand}},
+			},
+			"serverInfo": map[string]string{"name": "yolk"},
+		}, nil
+
+	case "initialized", "shutdown", "$/cancelRequest", "textDocument/didSave":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p struct {
+			TextDocument lspDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		s.setDoc(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var p struct {
+			TextDocument   lspDocument `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		// the document is fully synchronized, the last change holds it all
+		if n := len(p.ContentChanges); n > 0 {
+			s.setDoc(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var p struct {
+			TextDocument lspDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		s.mu.Lock()
+		delete(s.docs, p.TextDocument.URI)
+		s.mu.Unlock()
+		return nil, nil
+
+	case "textDocument/codeAction":
+		var p struct {
+			TextDocument lspDocument `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+
+		actions := []lspCodeAction{}
+		edit, err := s.rewrite(p.TextDocument.URI)
+		if err != nil {
+			s.r.Log.Warnf("rewrite %s fails due to %v", p.TextDocument.URI, err)
+		} else if edit != nil {
+			actions = append(actions, lspCodeAction{Title: "Rewrite imports per yolk rules", Kind: "source.yolk", Edit: edit})
+		}
+		return actions, nil
+
+	case "workspace/executeCommand":
+		var p struct {
+			Command   string   `json:"command"`
+			Arguments []string `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil || p.Command != LSPCommand || len(p.Arguments) != 1 {
+			return nil, &lspError{Code: lspInvalidParams, Message: fmt.Sprintf("want %s with the URI of a document", LSPCommand)}
+		}
+
+		edit, err := s.rewrite(p.Arguments[0])
+		if err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		if edit != nil {
+			if err := s.request("workspace/applyEdit", map[string]interface{}{"label": "yolk", "edit": edit}); err != nil {
+				return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+			}
+		}
+		return nil, nil
+	}
+
+	return nil, &lspError{Code: lspMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func (s *lspServer) setDoc(uri, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.docs[uri] = text
+}
+
+// rewrite returns the edit rewriting the open document uri, or nil if it
+// is left unchanged.
+func (s *lspServer) rewrite(uri string) (*lspWorkspaceEdit, error) {
+	s.mu.Lock()
+	text, ok := s.docs[uri]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("document %s is not open", uri)
+	}
+
+	path, err := uriPath(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := s.r.RewriteSource(path, []byte(text))
+	if err != nil {
+		return nil, err
+	}
+	if string(dst) == text {
+		return nil, nil
+	}
+
+	// the whole document is replaced, the editor computes the minimal diff
+	edit := lspTextEdit{Range: lspRange{End: endPosition(text)}, NewText: string(dst)}
+	return &lspWorkspaceEdit{Changes: map[string][]lspTextEdit{uri: {edit}}}, nil
+}
+
+// uriPath returns the file path of a file URI. The path of a Windows URI,
+// as in file:///C:/src/a.go, starts with its drive letter.
+func uriPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("document %s is not a file", uri)
+	}
+
+	path := u.Path
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' && isDriveLetter(path[1]) {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// endPosition returns the position of the end of text, counting the
+// characters of the last line in UTF-16 code units as LSP does.
+func endPosition(text string) lspPosition {
+	line := strings.Count(text, "\n")
+	last := text[strings.LastIndexByte(text, '\n')+1:]
+	return lspPosition{Line: line, Character: len(utf16.Encode([]rune(last)))}
+}
+
+// read returns the body of the next message.
+func (s *lspServer) read() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		if i := strings.IndexByte(line, ':'); i > 0 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	if length > lspMaxMessage {
+		return nil, fmt.Errorf("message of %d bytes larger than %d bytes", length, lspMaxMessage)
+	}
+
+	body := make([]byte, length)
+	_, err := io.ReadFull(s.in, body)
+	return body, err
+}
+
+// write sends the message msg.
+func (s *lspServer) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
+
+func (s *lspServer) reply(id *json.RawMessage, result interface{}, rerr *lspError) error {
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if rerr != nil {
+		msg["error"] = rerr
+	} else {
+		msg["result"] = result
+	}
+	return s.write(msg)
+}
+
+// request sends a request to the client, whose response is ignored.
+func (s *lspServer) request(method string, params interface{}) error {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.mu.Unlock()
+
+	return s.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+}
@@ -0,0 +1,119 @@
+package yolk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestURIPath(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "file:///home/dev/src/a.go", want: "/home/dev/src/a.go"},
+		{uri: "file:///C:/src/a.go", want: "C:/src/a.go"},
+		{uri: "file:///c%3A/src/my%20app/a.go", want: "c:/src/my app/a.go"},
+		{uri: "file:///tmp/1:2/a.go", want: "/tmp/1:2/a.go"},
+	}
+	for _, tt := range tests {
+		got, err := uriPath(tt.uri)
+		if err != nil {
+			t.Errorf("uriPath(%q) fails: %v", tt.uri, err)
+			continue
+		}
+		if want := filepath.FromSlash(tt.want); got != want {
+			t.Errorf("uriPath(%q) = %q, want %q", tt.uri, got, want)
+		}
+	}
+
+	if _, err := uriPath("untitled:Untitled-1"); err == nil {
+		t.Errorf("uriPath() of an untitled document succeeds")
+	}
+}
+
+// lspMessages frames the JSON-RPC messages msgs as a client sends them.
+func lspMessages(t *testing.T, msgs ...interface{}) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		body, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return &buf
+}
+
+// lspReplies returns the replies written by the server to out, by id.
+func lspReplies(t *testing.T, out *bytes.Buffer) map[int]json.RawMessage {
+	t.Helper()
+	s := &lspServer{in: bufio.NewReader(out)}
+	replies := make(map[int]json.RawMessage)
+	for out.Len() > 0 || s.in.Buffered() > 0 {
+		body, err := s.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatal(err)
+		}
+		replies[reply.ID] = reply.Result
+	}
+	return replies
+}
+
+func TestServeLSP(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "src", "app")
+	rootURI := "file://" + filepath.ToSlash(root)
+	doc := func(name string) map[string]interface{} {
+		return map[string]interface{}{"uri": rootURI + "/" + name, "text": oldSource, "version": 1}
+	}
+	action := func(id int, name string) map[string]interface{} {
+		return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "textDocument/codeAction",
+			"params": map[string]interface{}{"textDocument": map[string]string{"uri": rootURI + "/" + name}}}
+	}
+
+	in := lspMessages(t,
+		map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]string{"rootUri": rootURI}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{"textDocument": doc("services/a.go")}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{"textDocument": doc("tools/b.go")}},
+		action(2, "services/a.go"),
+		action(3, "tools/b.go"),
+		map[string]interface{}{"jsonrpc": "2.0", "method": "exit"},
+	)
+
+	r := NewRewriter()
+	r.FS = IOFS(NewMemFS(nil))
+	if err := r.Add(Rule{Source: "old.corp/lib", Dest: "new.corp/lib", Include: []string{"services/**"}}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := r.ServeLSP(in, &out); err != nil {
+		t.Fatalf("ServeLSP() fails: %v", err)
+	}
+
+	replies := lspReplies(t, &out)
+	var actions []lspCodeAction
+	if err := json.Unmarshal(replies[2], &actions); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 {
+		t.Fatalf("code actions of services/a.go = %s, want one", replies[2])
+	}
+	edits := actions[0].Edit.Changes[rootURI+"/services/a.go"]
+	if len(edits) != 1 || edits[0].NewText != newSource {
+		t.Errorf("edits of services/a.go = %+v, want the rewritten document", edits)
+	}
+	if got := string(replies[3]); got != "[]" {
+		t.Errorf("code actions of tools/b.go = %s, want none", got)
+	}
+}
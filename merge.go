@@ -0,0 +1,132 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// mergeImports handles the replacers whose new path is already imported by
+// file, which would otherwise be imported twice. The old import is dropped
+// rather than rewritten, and the qualifiers referring to it are renamed to
+// the name of the existing import. A blank existing import is dropped in
+// favor of the rewritten one instead. A dot import is only merged with
+// another dot import, since its identifiers can't be qualified. Imports of
+// several old paths rewritten to the same new path, as packages merged into
+// one, are merged into the first one, see renameMerged, while the imports
+// of a same path under other names are all kept. The returned edits
+// apply the renames to the source.
+func mergeImports(fset *token.FileSet, file *ast.File, replacers []*replacer) []textEdit {
+	replaced := make(map[string]bool)
+	for _, rp := range replacers {
+		replaced[rp.oldPath] = !rp.removed && !rp.added
+	}
+
+	var edits []textEdit
+	rewritten := make(map[string]bool)
+	targets := make(map[string]*replacer)
+	for _, rp := range replacers {
+		if rp.removed || rp.added {
+			continue
+		}
+		if rp.name == "_" || rp.name == "." {
+			key := rp.name + " " + rp.newPath
+			if rewritten[key] {
+				rp.merged = true
+				continue
+			}
+			rewritten[key] = true
+		} else if t := targets[rp.newPath]; t != nil && t.oldPath != rp.oldPath {
+			rp.merged, rp.into = true, t
+			continue
+		} else {
+			targets[rp.newPath] = rp
+		}
+
+		// imports swapped with each other are not duplicated
+		if replaced[rp.newPath] {
+			continue
+		}
+
+		ex := findImport(file, rp.newPath)
+		if ex == nil {
+			continue
+		}
+
+		exName := importName(ex)
+		switch {
+		case rp.name == "." || exName == ".":
+			rp.merged = rp.name == exName
+		case rp.name == "_":
+			rp.merged = true
+		case exName == "_":
+			rp.dropBlank = true
+		default:
+			rp.merged = true
+
+			oldName, newName := rp.name, exName
+			if oldName == "" {
+				oldName = assumedName(rp.oldPath)
+			}
+			if newName == "" {
+				newName = assumedName(rp.newPath)
+			}
+			if oldName == newName {
+				continue
+			}
+
+			for _, id := range renameQualifier(file, oldName, newName) {
+				off := fset.Position(id.Pos()).Offset
+				edits = append(edits, textEdit{start: off, end: off + len(oldName), text: newName})
+			}
+		}
+	}
+	return edits
+}
+
+// findImport returns the first import of path in file, if any.
+func findImport(file *ast.File, path string) *ast.ImportSpec {
+	for _, imp := range file.Imports {
+		if importPath(imp) == path {
+			return imp
+		}
+	}
+	return nil
+}
+
+// renameMerged renames the qualifiers of the imports merged into an earlier
+// import rewritten to the same path to the name of the latter, once known.
+// The imports whose alias is replaced by another one are reported, since
+// the code referring to them reads differently. The returned edits apply the
+// renames to the source.
+func (r *Rewriter) renameMerged(fset *token.FileSet, file *ast.File, replacers []*replacer) []textEdit {
+	var edits []textEdit
+	for _, rp := range replacers {
+		t := rp.into
+		if t == nil {
+			continue
+		}
+
+		oldName, newName := rp.name, t.newName
+		if oldName == "" {
+			oldName = assumedName(rp.oldPath)
+		}
+		if newName == "" && r.RenameSelectors {
+			newName = assumedName(t.newPath)
+		} else if newName == "" {
+			// the qualifiers of t are left alone
+			newName = assumedName(t.oldPath)
+		}
+		if oldName == newName {
+			continue
+		}
+		if rp.name != "" {
+			r.Log.Warnf("%s: import %s %s merged into import %s of %s, renaming its qualifiers", rp.pos, rp.name, rp.oldPath, newName, t.newPath)
+		}
+
+		for _, id := range renameQualifier(file, oldName, newName) {
+			off := fset.Position(id.Pos()).Offset
+			edits = append(edits, textEdit{start: off, end: off + len(oldName), text: newName})
+		}
+	}
+	return edits
+}
@@ -0,0 +1,109 @@
+package yolk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// FixModules runs go mod edit in every module found under dir, renaming the
+// module, its requirements and replacements according to the rules, so the
+// modules stay buildable after their imports are rewritten. In dry run mode
+// the commands are logged instead of run.
+func (r *Rewriter) FixModules(dir string) error {
+	return r.walkTree(dir, func(path string, info os.FileInfo, errx error) error {
+		if errx != nil {
+			return errx
+		}
+
+		if info.IsDir() {
+			_, _, err := r.handle(dir, path, info)
+			return err
+		}
+
+		if info.Name() != "go.mod" {
+			return nil
+		}
+
+		return r.fixModule(path)
+	}, nil)
+}
+
+func (r *Rewriter) fixModule(gomod string) error {
+	data, err := ioutil.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+
+	f, err := modfile.Parse(gomod, data, nil)
+	if err != nil {
+		return err
+	}
+
+	args := r.modEditArgs(f)
+	if len(args) == 0 {
+		return nil
+	}
+
+	args = append([]string{"mod", "edit"}, args...)
+	if r.DryRun {
+		r.Log.Infof("would run in %s: go %s", filepath.Dir(gomod), strings.Join(args, " "))
+		return nil
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = filepath.Dir(gomod)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go mod edit in %s fails due to %v: %s", cmd.Dir, err, out)
+	}
+	return nil
+}
+
+// modEditArgs returns the go mod edit flags renaming the module paths of f.
+func (r *Rewriter) modEditArgs(f *modfile.File) []string {
+	var args []string
+
+	if f.Module != nil {
+		if _, np, ok := r.match(f.Syntax.Name, f.Module.Mod.Path); ok && np != f.Module.Mod.Path {
+			args = append(args, "-module="+np)
+		}
+	}
+
+	for _, req := range f.Require {
+		if _, np, ok := r.match(f.Syntax.Name, req.Mod.Path); ok && np != req.Mod.Path {
+			args = append(args, "-droprequire="+req.Mod.Path, "-require="+np+"@"+req.Mod.Version)
+		}
+	}
+
+	for _, rep := range f.Replace {
+		oldPath, newPath := rep.Old.Path, rep.New.Path
+		if _, np, ok := r.match(f.Syntax.Name, oldPath); ok {
+			oldPath = np
+		}
+		if !modfile.IsDirectoryPath(newPath) {
+			if _, np, ok := r.match(f.Syntax.Name, newPath); ok {
+				newPath = np
+			}
+		}
+		if oldPath == rep.Old.Path && newPath == rep.New.Path {
+			continue
+		}
+
+		args = append(args, "-dropreplace="+versioned(rep.Old.Path, rep.Old.Version))
+		args = append(args, "-replace="+versioned(oldPath, rep.Old.Version)+"="+versioned(newPath, rep.New.Version))
+	}
+
+	return args
+}
+
+func versioned(path, version string) string {
+	if version == "" {
+		return path
+	}
+	return path + "@" + version
+}
@@ -0,0 +1,67 @@
+package yolk
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ModCommand is a go command run in a module with changed files by
+// RunModCommands, along with its combined output.
+type ModCommand struct {
+	Dir     string `json:"dir"`
+	Command string `json:"command"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RunModCommands runs go mod tidy in Tidy mode, then go mod vendor in
+// Vendor mode, in every module with files changed so far, so that their
+// go.sum files and vendor directories follow the rewritten imports. Only
+// the modules holding a vendor/modules.txt file are vendored again. The
+// commands are recorded in the summary, and logged instead of run in dry
+// run mode. Every command is run even if some fail.
+func (r *Rewriter) RunModCommands() error {
+	r.mu.Lock()
+	modules := r.moduleSummaries()
+	r.mu.Unlock()
+
+	var failed []string
+	for _, m := range modules {
+		var cmds [][]string
+		if r.Tidy {
+			cmds = append(cmds, []string{"mod", "tidy"})
+		}
+		if _, err := r.fs().Stat(filepath.Join(m.Dir, "vendor", "modules.txt")); r.Vendor && err == nil {
+			cmds = append(cmds, []string{"mod", "vendor"})
+		}
+
+		for _, args := range cmds {
+			line := "go " + strings.Join(args, " ")
+			if r.DryRun {
+				r.Log.Infof("would run in %s: %s", m.Dir, line)
+				continue
+			}
+
+			r.Log.Verbosef("running in %s: %s", m.Dir, line)
+			cmd := exec.Command("go", args...)
+			cmd.Dir = m.Dir
+			out, err := cmd.CombinedOutput()
+			mc := ModCommand{Dir: m.Dir, Command: line, Output: strings.TrimSpace(string(out))}
+			if err != nil {
+				mc.Error = err.Error()
+				failed = append(failed, m.Dir+": "+line)
+			}
+
+			r.mu.Lock()
+			r.summary.command = append(r.summary.command, mc)
+			r.mu.Unlock()
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("go commands failing in the rewritten modules: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package yolk
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/mod/modfile"
+)
+
+// module is a golang module found by the rewriter.
+type module struct {
+	// dir is the directory holding the go.mod file, and path the module
+	// path declared by it, empty if it can't be parsed.
+	dir  string
+	path string
+}
+
+// ModuleSummary is the number of files changed in a module.
+type ModuleSummary struct {
+	Dir          string `json:"dir"`
+	Path         string `json:"path"`
+	FilesChanged int    `json:"files_changed"`
+}
+
+// findModules forgets the modules found so far, and records the module
+// enclosing the walked directory root, which might be declared by the
+// go.mod file of one of its parents, along with its workspace.
+func (r *Rewriter) findModules(root string) {
+	r.modules = make(map[string]module)
+	r.findWorkspace(root)
+
+	abs := filepath.Clean(root)
+	if r.FS == nil {
+		var err error
+		if abs, err = filepath.Abs(root); err != nil {
+			return
+		}
+	}
+
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if m, ok := readModule(r.fs(), dir); ok {
+			m.dir = filepath.Clean(root)
+			if dir != abs {
+				m.dir = dir
+			}
+			r.modules[filepath.Clean(root)] = m
+			return
+		}
+
+		if filepath.Dir(dir) == dir {
+			return
+		}
+	}
+}
+
+// addModule records the module of the walked directory dir, if it holds a
+// go.mod file.
+func (r *Rewriter) addModule(dir string) {
+	if r.modules == nil {
+		r.modules = make(map[string]module)
+	}
+
+	if m, ok := readModule(r.fs(), dir); ok {
+		m.dir = filepath.Clean(dir)
+		r.modules[m.dir] = m
+	}
+}
+
+// readModule returns the module of dir in fsys, if it holds a go.mod file.
+func readModule(fsys FileSystem, dir string) (module, bool) {
+	data, err := fsys.ReadFile(filepath.Join(dir, "go.mod"))
+	if os.IsNotExist(err) {
+		return module{}, false
+	}
+	return module{dir: dir, path: modfile.ModulePath(data)}, true
+}
+
+// moduleOf returns the walked directory holding the innermost module
+// enclosing path, and the module itself.
+func (r *Rewriter) moduleOf(path string) (string, module, bool) {
+	for dir := filepath.Dir(filepath.Clean(path)); ; dir = filepath.Dir(dir) {
+		if m, ok := r.modules[dir]; ok {
+			return dir, m, true
+		}
+
+		if filepath.Dir(dir) == dir {
+			return "", module{}, false
+		}
+	}
+}
+
+// inModules reports whether the file name walked from root belongs to one
+// of the modules selected by Modules.
+func (r *Rewriter) inModules(root, name string) bool {
+	dir, _, ok := r.moduleOf(name)
+	if !ok {
+		return false
+	}
+
+	rel := relPath(root, dir)
+	for _, m := range r.Modules {
+		if path.Clean(filepath.ToSlash(m)) == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// moduleSummaries returns the modules with changed files, sorted by
+// directory.
+func (r *Rewriter) moduleSummaries() []ModuleSummary {
+	var ms []ModuleSummary
+	for m, n := range r.summary.modules {
+		ms = append(ms, ModuleSummary{Dir: m.dir, Path: m.path, FilesChanged: n})
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Dir < ms[j].Dir })
+	return ms
+}
@@ -0,0 +1,89 @@
+package yolk
+
+import (
+	"go/ast"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// assumedName returns the package name assumed from the import path, the
+// way goimports does: the last path element, skipping a major version
+// suffix, without a go- prefix and cut at the first non identifier rune.
+func assumedName(importPath string) string {
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, notIdentifier); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+func notIdentifier(ch rune) bool {
+	return !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' ||
+		'0' <= ch && ch <= '9' ||
+		ch == '_' ||
+		ch >= utf8RuneSelf && (unicode.IsLetter(ch) || unicode.IsDigit(ch)))
+}
+
+const utf8RuneSelf = 0x80
+
+// nameInUse reports whether name is declared at file scope or in a local
+// scope, where it would shadow a qualifier, used as the name of another
+// import, or referenced as an unresolved identifier.
+func nameInUse(file *ast.File, name string) bool {
+	if file.Scope != nil && file.Scope.Lookup(name) != nil {
+		return true
+	}
+
+	for _, imp := range file.Imports {
+		if importName(imp) == name || (imp.Name == nil && assumedName(importPath(imp)) == name) {
+			return true
+		}
+	}
+
+	for _, id := range file.Unresolved {
+		if id.Name == name {
+			return true
+		}
+	}
+
+	declared := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == name && id.Obj != nil {
+			declared = true
+		}
+		return !declared
+	})
+	return declared
+}
+
+// renameQualifier renames the package qualifier of every selector
+// expression old.X in file to new.X, and returns the renamed identifiers.
+// Identifiers resolved to local declarations shadowing the package are left
+// alone.
+func renameQualifier(file *ast.File, old, new string) []*ast.Ident {
+	var renamed []*ast.Ident
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		if id, ok := sel.X.(*ast.Ident); ok && id.Name == old && id.Obj == nil {
+			id.Name = new
+			renamed = append(renamed, id)
+		}
+		return true
+	})
+	return renamed
+}
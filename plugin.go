@@ -0,0 +1,122 @@
+package yolk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// ExecHandler is a Handler running an external command for every file it
+// matches, for the file formats yolk doesn't know, or for validations of
+// their own. The command talks to yolk in JSON lines over its standard
+// input and output:
+//
+//	yolk:    {"path": "web/page.tmpl", "content": "..."}
+//	command: {"map": "github.com/old/repo/ui"}
+//	yolk:    {"path": "github.com/new/repo/ui", "ok": true}
+//	command: {"content": "..."}
+//
+// The command receives the path and content of the file, may ask for the
+// import path replacing any path by the rules as many times as needed, then
+// answers with the rewritten content, or with {"error": "..."} to fail the
+// file. The content is read as UTF-8 text.
+type ExecHandler struct {
+	// Type is the name of the handler, listed among the file types.
+	Type string `yaml:"name"`
+	// Files lists the glob patterns of the files of the handler, relative
+	// to the walked directory as in the Exclude of a Rewriter.
+	Files []string `yaml:"files"`
+	// Command is the command run for every file, followed by its
+	// arguments.
+	Command []string `yaml:"command"`
+}
+
+// execRequest is the file sent to the command of an ExecHandler.
+type execRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// execMessage is a message of the command of an ExecHandler: the path to
+// map if Map is set, its result otherwise.
+type execMessage struct {
+	Map     string  `json:"map,omitempty"`
+	Content *string `json:"content,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// execMapping is the answer to a path to map.
+type execMapping struct {
+	Path string `json:"path"`
+	OK   bool   `json:"ok"`
+}
+
+func (h *ExecHandler) Name() string { return h.Type }
+
+func (h *ExecHandler) Match(path string) bool {
+	_, ok := matchAny(h.Files, path)
+	return ok
+}
+
+func (h *ExecHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	if len(h.Command) == 0 {
+		return nil, fmt.Errorf("handler %s has no command", h.Type)
+	}
+
+	cmd := exec.Command(h.Command[0], h.Command[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start handler %s fails: %v", h.Type, err)
+	}
+
+	dst, err := h.converse(stdin, stdout, path, src, m)
+	stdin.Close()
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		err = fmt.Errorf("handler %s fails due to %v: %s", h.Type, werr, strings.TrimSpace(stderr.String()))
+	}
+	return dst, err
+}
+
+// converse sends the file to the command, answers the paths it asks to map
+// and returns the content it answers with.
+func (h *ExecHandler) converse(w io.Writer, r io.Reader, path string, src []byte, m Mapper) ([]byte, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(execRequest{Path: path, Content: string(src)}); err != nil {
+		return nil, fmt.Errorf("send %s to handler %s fails: %v", path, h.Type, err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var msg execMessage
+		if err := dec.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("read the answer of handler %s fails: %v", h.Type, err)
+		}
+
+		switch {
+		case msg.Map != "":
+			np, ok := m(msg.Map)
+			if err := enc.Encode(execMapping{Path: np, OK: ok}); err != nil {
+				return nil, fmt.Errorf("answer handler %s fails: %v", h.Type, err)
+			}
+		case msg.Error != "":
+			return nil, fmt.Errorf("handler %s: %s", h.Type, msg.Error)
+		case msg.Content != nil:
+			return []byte(*msg.Content), nil
+		default:
+			return nil, fmt.Errorf("handler %s answers neither a path to map nor a content", h.Type)
+		}
+	}
+}
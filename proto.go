@@ -0,0 +1,108 @@
+package yolk
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// protoHandler rewrites the go_package options of .proto files.
+type protoHandler struct{}
+
+func (protoHandler) Name() string { return "proto" }
+
+func (protoHandler) Match(path string) bool { return filepath.Ext(path) == ".proto" }
+
+// Rewrite replaces the import path of the go_package options, keeping the
+// package name following a semicolon, as in "example.com/foo;foopb".
+func (protoHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	var edits []textEdit
+
+	toks := scanProto(src)
+	for i := 0; i+4 < len(toks); i++ {
+		if toks[i].text != "option" || toks[i+1].text != "go_package" || toks[i+2].text != "=" {
+			continue
+		}
+
+		str := toks[i+3]
+		if str.text[0] != '"' && str.text[0] != '\'' || toks[i+4].text != ";" {
+			continue
+		}
+
+		// escapes are not worth supporting in an import path
+		value := str.text[1 : len(str.text)-1]
+		if strings.IndexByte(value, '\\') >= 0 {
+			continue
+		}
+
+		importPath := value
+		if j := strings.IndexByte(value, ';'); j >= 0 {
+			importPath = value[:j]
+		}
+		if np, ok := m(importPath); ok {
+			start := str.offset + 1
+			edits = append(edits, textEdit{start: start, end: start + len(importPath), text: np})
+		}
+	}
+
+	return applyEdits(src, edits), nil
+}
+
+// protoToken is a token of a .proto file, a string literal keeping its
+// quotes.
+type protoToken struct {
+	text   string
+	offset int
+}
+
+// scanProto splits src into the tokens of the protobuf language, dropping
+// comments and white space. It is only accurate enough to find options: the
+// identifiers and numbers are tokens of their own, as is every other byte.
+func scanProto(src []byte) []protoToken {
+	var toks []protoToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				return toks
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != c {
+				// unterminated string
+				return toks
+			}
+			toks = append(toks, protoToken{text: string(src[i : j+1]), offset: i})
+			i = j + 1
+		case isProtoIdent(c):
+			j := i
+			for j < len(src) && isProtoIdent(src[j]) {
+				j++
+			}
+			toks = append(toks, protoToken{text: string(src[i:j]), offset: i})
+			i = j
+		default:
+			toks = append(toks, protoToken{text: string(c), offset: i})
+			i++
+		}
+	}
+	return toks
+}
+
+func isProtoIdent(c byte) bool {
+	return c == '_' || c == '.' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
@@ -0,0 +1,212 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	modpath "golang.org/x/mod/module"
+)
+
+// DefaultUpstream is the module proxy a Proxy fetches the modules from by
+// default.
+const DefaultUpstream = "https://proxy.golang.org"
+
+// Proxy is a module proxy serving the modules of an upstream proxy with
+// their import paths and go.mod files rewritten, set as GOPROXY:
+//
+//	GET /{module}/@v/list             lists the versions of the module
+//	GET /{module}/@v/{version}.info   returns the metadata of a version
+//	GET /{module}/@v/{version}.mod    returns the rewritten go.mod file
+//	GET /{module}/@v/{version}.zip    returns the rewritten module zip
+//	GET /{module}/@latest             returns the metadata of the latest version
+//
+// A module requested by the path the rules rewrite the path of an upstream
+// module to, such as the path of a fork, is fetched as the upstream module
+// and served under the requested path: the fork is consumed without being
+// hosted anywhere. Its content differs from the upstream one, so the
+// rewritten paths are to be listed in GONOSUMDB.
+type Proxy struct {
+	// Upstream is the URL of the module proxy the modules are fetched from,
+	// DefaultUpstream if empty.
+	Upstream string
+
+	// Client fetches the modules, http.DefaultClient if nil.
+	Client *http.Client
+
+	// NewRewriter returns the rewriter of a module version, along with its
+	// options and rules. NewRewriter by default. The go.mod files are
+	// always rewritten.
+	NewRewriter func() *Rewriter
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, fmt.Sprintf("%s is not allowed", req.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	escMod, file, ok := splitProxyPath(strings.TrimPrefix(req.URL.Path, "/"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown path %s", req.URL.Path), http.StatusNotFound)
+		return
+	}
+	mod, err := modpath.UnescapePath(escMod)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	rw := p.newRewriter()
+	up := upstreamPath(rw, mod)
+	escUp, err := modpath.EscapePath(up)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if up != mod {
+		rw.Log.Verbosef("fetching %s as %s", mod, up)
+	}
+
+	upFile := escUp + "/@v/" + file
+	if file == "@latest" {
+		upFile = escUp + "/@latest"
+	}
+	data, status, err := p.fetch(upFile)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(file, ".mod"):
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		data, err = rewriteProxyMod(rw, data)
+	case strings.HasSuffix(file, ".zip"):
+		w.Header().Set("Content-Type", "application/zip")
+		data, err = rewriteProxyZip(rw, data, up, mod, strings.TrimSuffix(file, ".zip"))
+	case file == "list":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("rewrite %s/@v/%s fails due to %v", mod, file, err), http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+func (p *Proxy) newRewriter() *Rewriter {
+	var rw *Rewriter
+	if p.NewRewriter != nil {
+		rw = p.NewRewriter()
+	} else {
+		rw = NewRewriter()
+	}
+	rw.GoMod = true
+	return rw
+}
+
+// fetch returns the file of the upstream proxy, or the status to answer
+// with if it can't be fetched. Modules missing upstream are missing from
+// the proxy too.
+func (p *Proxy) fetch(file string) ([]byte, int, error) {
+	upstream := p.Upstream
+	if upstream == "" {
+		upstream = DefaultUpstream
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(strings.TrimSuffix(upstream, "/") + "/" + file)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	switch {
+	case err != nil:
+		return nil, http.StatusBadGateway, err
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return nil, resp.StatusCode, fmt.Errorf("%s", bytes.TrimSpace(data))
+	case resp.StatusCode != http.StatusOK:
+		return nil, http.StatusBadGateway, fmt.Errorf("upstream %s answers %s", file, resp.Status)
+	}
+	return data, http.StatusOK, nil
+}
+
+// splitProxyPath splits the path of a proxy request into the escaped
+// module path and the file requested, @latest for the latest version.
+func splitProxyPath(path string) (string, string, bool) {
+	if mod := strings.TrimSuffix(path, "/@latest"); mod != path {
+		return mod, "@latest", mod != ""
+	}
+	i := strings.Index(path, "/@v/")
+	if i <= 0 {
+		return "", "", false
+	}
+	file := path[i+len("/@v/"):]
+	switch {
+	case file == "list", strings.HasSuffix(file, ".info"), strings.HasSuffix(file, ".mod"), strings.HasSuffix(file, ".zip"):
+		return path[:i], file, !strings.Contains(file, "/")
+	}
+	return "", "", false
+}
+
+// upstreamPath returns the path of the module fetched upstream when mod is
+// requested: the path the rules of rw rewrite to mod if any, mod otherwise.
+func upstreamPath(rw *Rewriter, mod string) string {
+	rev := NewRewriter()
+	rev.rules = rw.Rules()
+	if rev.Reverse() != nil {
+		return mod
+	}
+	if _, up, ok := rev.match("", mod); ok {
+		if _, np, ok := rw.match("", up); ok && np == mod {
+			return up
+		}
+	}
+	return mod
+}
+
+// rewriteProxyMod returns the go.mod file data rewritten by rw.
+func rewriteProxyMod(rw *Rewriter, data []byte) ([]byte, error) {
+	mem := NewMemFS(map[string][]byte{"go.mod": data})
+	rw.FS = IOFS(mem)
+	if err := rw.RewriteDir("."); err != nil {
+		return nil, err
+	}
+	return mem.Files()["go.mod"], nil
+}
+
+// rewriteProxyZip returns the module zip data of the upstream module up
+// rewritten by rw, its files moved to the root of the module mod and the
+// other entries dropped. Files failing to be rewritten are kept as they are.
+func rewriteProxyZip(rw *Rewriter, data []byte, up, mod, escVersion string) ([]byte, error) {
+	version, err := modpath.UnescapeVersion(escVersion)
+	if err != nil {
+		return nil, err
+	}
+	oldRoot, newRoot := up+"@"+version+"/", mod+"@"+version+"/"
+	rename := func(name string) string {
+		if strings.HasPrefix(name, oldRoot) {
+			return newRoot + strings.TrimPrefix(name, oldRoot)
+		}
+		return ""
+	}
+
+	var buf bytes.Buffer
+	err = rw.rewriteZip(&buf, bytes.NewReader(data), int64(len(data)), rename)
+	if errs, ok := err.(Errors); ok {
+		rw.Log.Warnf("%s@%s: %v", mod, version, errs)
+	} else if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,125 @@
+package yolk
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	proxyMod    = "module old.corp/lib\n\ngo 1.16\n"
+	proxySource = "package lib\n\nimport _ \"old.corp/lib/internal\"\n"
+)
+
+// newUpstream returns a module proxy serving old.corp/lib v1.0.0.
+func newUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string]string{
+		"old.corp/lib@v1.0.0/go.mod": proxyMod,
+		"old.corp/lib@v1.0.0/lib.go": proxySource,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"/old.corp/lib/@v/list":        []byte("v1.0.0\n"),
+		"/old.corp/lib/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0"}`),
+		"/old.corp/lib/@v/v1.0.0.mod":  []byte(proxyMod),
+		"/old.corp/lib/@v/v1.0.0.zip":  buf.Bytes(),
+		"/old.corp/lib/@latest":        []byte(`{"Version":"v1.0.0"}`),
+	}
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := files[req.URL.Path]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(up.Close)
+	return up
+}
+
+func TestProxy(t *testing.T) {
+	up := newUpstream(t)
+	p := &Proxy{Upstream: up.URL, NewRewriter: func() *Rewriter { return newMemRewriter(t) }}
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		want   string
+	}{
+		{http.MethodGet, "/new.corp/lib/@v/list", http.StatusOK, "v1.0.0\n"},
+		{http.MethodGet, "/new.corp/lib/@v/v1.0.0.info", http.StatusOK, `{"Version":"v1.0.0"}`},
+		{http.MethodGet, "/new.corp/lib/@latest", http.StatusOK, `{"Version":"v1.0.0"}`},
+		{http.MethodGet, "/new.corp/lib/@v/v1.0.0.mod", http.StatusOK, "module new.corp/lib\n\ngo 1.16\n"},
+		{http.MethodGet, "/old.corp/lib/@v/v1.0.0.mod", http.StatusOK, "module new.corp/lib\n\ngo 1.16\n"},
+		{http.MethodGet, "/new.corp/lib/@v/v2.0.0.mod", http.StatusNotFound, ""},
+		{http.MethodGet, "/new.corp/lib/@v/v1.0.0.txt", http.StatusNotFound, ""},
+		{http.MethodGet, "/new.corp/lib", http.StatusNotFound, ""},
+		{http.MethodPost, "/new.corp/lib/@v/list", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s %s answers %d, want %d", tt.method, tt.path, w.Code, tt.status)
+			continue
+		}
+		if got := w.Body.String(); tt.status == http.StatusOK && got != tt.want {
+			t.Errorf("%s %s = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestProxyZip(t *testing.T) {
+	up := newUpstream(t)
+	p := &Proxy{Upstream: up.URL, NewRewriter: func() *Rewriter { return newMemRewriter(t) }}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/new.corp/lib/@v/v1.0.0.zip", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET zip answers %d: %s", w.Code, w.Body)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"new.corp/lib@v1.0.0/go.mod": "module new.corp/lib\n\ngo 1.16\n",
+		"new.corp/lib@v1.0.0/lib.go": "package lib\n\nimport _ \"new.corp/lib/internal\"\n",
+	}
+	if len(zr.File) != len(want) {
+		t.Errorf("zip holds %d files, want %d", len(zr.File), len(want))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want[f.Name] {
+			t.Errorf("%s =\n%s\nwant\n%s", f.Name, data, want[f.Name])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// pruneUnused deletes the imports of the rewritten golang source file which
+// no selector refers to anymore, once its imports are rewritten, and returns
+// their paths. Nothing is loaded: the package name of an unnamed import is
+// assumed from its path, and the unnamed imports are kept when some
+// qualifiers of the file match none of the names of its imports, the
+// assumed names being likely wrong. Blank, dot and cgo imports are kept.
+func pruneUnused(fset *token.FileSet, file *ast.File) []string {
+	qualifiers, trusted := fileQualifiers(file)
+
+	var unused []*ast.ImportSpec
+	for _, imp := range file.Imports {
+		name, path := importName(imp), importPath(imp)
+		if name == "_" || name == "." || path == cgoPath {
+			continue
+		}
+		if name == "" {
+			if !trusted {
+				continue
+			}
+			name = assumedName(path)
+		}
+		if !qualifiers[name] {
+			unused = append(unused, imp)
+		}
+	}
+
+	var pruned []string
+	for _, imp := range unused {
+		if astutil.DeleteNamedImport(fset, file, importName(imp), importPath(imp)) {
+			pruned = append(pruned, importPath(imp))
+		}
+	}
+	return pruned
+}
+
+// fileQualifiers returns the names qualifying the selectors of file, other
+// than local declarations, and whether they all match the name of an
+// import, the package names of unnamed imports being assumed from their
+// paths.
+func fileQualifiers(file *ast.File) (map[string]bool, bool) {
+	names := make(map[string]bool)
+	for _, imp := range file.Imports {
+		names[importName(imp)] = true
+		if imp.Name == nil {
+			names[assumedName(importPath(imp))] = true
+		}
+	}
+
+	qualifiers := make(map[string]bool)
+	trusted := true
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+			qualifiers[id.Name] = true
+			if !names[id.Name] {
+				trusted = false
+			}
+		}
+		return true
+	})
+	return qualifiers, trusted
+}
@@ -0,0 +1,107 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"regexp"
+)
+
+// kindRemoved is the kind of the replacers of the imports deleted by remove
+// rules, whose new path is empty.
+const kindRemoved = "removed import"
+
+// validateRemove checks a remove rule, matching the removed path exactly by
+// default.
+func (r *Rule) validateRemove() error {
+	if r.Source != "" || r.Dest != "" || r.Transform != "" || r.Alias != "" {
+		return fmt.Errorf("remove rule %s can't have a source, destination, transform or alias", r.Remove)
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = MatchExact
+	case MatchPrefix, MatchExact:
+	case MatchRegex:
+		re, err := regexp.Compile(r.Remove)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of remove rule %s: %v", r.Remove, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown match mode %q of remove rule %s", r.Mode, r.Remove)
+	}
+	return nil
+}
+
+// matchPattern reports whether the pattern of a remove or add rule, which
+// replaces no path, matches path in the mode of the rule, unless path is one
+// of its exceptions.
+func (r *Rule) matchPattern(pattern, path string) bool {
+	if r.excepts(path) {
+		return false
+	}
+	switch r.Mode {
+	case MatchExact:
+		return path == pattern
+	case MatchRegex:
+		return r.re.MatchString(path)
+	default:
+		return hasPathPrefix(path, pattern)
+	}
+}
+
+// removal returns the index of the first remove rule matching the import
+// spec of the golang source file, if the package it imports is unused by
+// file. Blank imports are always unused, and dot imports never are. The
+// name of an unnamed import is resolved as goimports does, and the import
+// is kept when some qualifiers of file match no import, the name being
+// possibly wrong.
+func (r *Rewriter) removal(path string, file *ast.File, spec *ast.ImportSpec) (int, bool) {
+	impPath, name := importPath(spec), importName(spec)
+
+	rel := ""
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Remove == "" || !rule.matchPattern(rule.Remove, impPath) || !r.appliesTo(rule, path, &rel) {
+			continue
+		}
+
+		if name == "_" {
+			return i, true
+		}
+		if name == "." {
+			r.Log.Warnf("%s: %s is not removed, it is still used", path, impPath)
+			return -1, false
+		}
+
+		qualifiers, trusted := fileQualifiers(file)
+		if name == "" {
+			name = r.packageName(path, impPath)
+			if !qualifiers[name] && !trusted {
+				r.Log.Warnf("%s: %s is not removed, its package name is unknown and it may still be used", path, impPath)
+				return -1, false
+			}
+		}
+		if qualifiers[name] {
+			r.Log.Warnf("%s: %s is not removed, it is still used", path, impPath)
+			return -1, false
+		}
+		return i, true
+	}
+	return -1, false
+}
+
+// qualifierUsed reports whether a selector expression of file is qualified by
+// the package name, rather than by a local declaration shadowing it.
+func qualifierUsed(file *ast.File, name string) bool {
+	used := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Name == name && id.Obj == nil {
+				used = true
+			}
+		}
+		return !used
+	})
+	return used
+}
@@ -0,0 +1,138 @@
+package yolk
+
+import (
+	"testing"
+)
+
+func TestRemoveRule(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "unused import",
+			src: `package a
+
+import (
+	"fmt"
+
+	"example.com/app/olddriver"
+)
+
+var _ = fmt.Println
+`,
+			want: `package a
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Println
+`,
+		},
+		{
+			name: "blank import",
+			src: `package a
+
+import _ "example.com/app/olddriver"
+
+var _ = 1
+`,
+			want: `package a
+
+var _ = 1
+`,
+		},
+		{
+			name: "used import",
+			src: `package a
+
+import "example.com/app/olddriver"
+
+var _ = olddriver.Open
+`,
+			want: `package a
+
+import "example.com/app/olddriver"
+
+var _ = olddriver.Open
+`,
+		},
+		{
+			name: "package name unknown",
+			src: `package a
+
+import "example.com/app/olddriver"
+
+var _ = driver.Open
+`,
+			want: `package a
+
+import "example.com/app/olddriver"
+
+var _ = driver.Open
+`,
+		},
+		{
+			name: "dot import",
+			src: `package a
+
+import . "example.com/app/olddriver"
+
+var _ = Open
+`,
+			want: `package a
+
+import . "example.com/app/olddriver"
+
+var _ = Open
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRewriter()
+			r.FS = IOFS(NewMemFS(nil))
+			if err := r.Add(Rule{Remove: "example.com/app/olddriver"}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := r.RewriteSource("a.go", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveRulePackageName(t *testing.T) {
+	const used = "package main\n\nimport \"example.com/app/olddriver\"\n\nfunc main() { driver.Open() }\n"
+	mem := NewMemFS(map[string][]byte{
+		"go.mod":         []byte("module example.com/app\n\ngo 1.16\n"),
+		"olddriver/d.go": []byte("package driver\n\nfunc Open() {}\n"),
+		"main.go":        []byte(used),
+		"other.go":       []byte("package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/olddriver\"\n)\n\nvar _ = fmt.Println\n"),
+	})
+
+	r := NewRewriter()
+	r.FS = IOFS(mem)
+	if err := r.Add(Rule{Remove: "example.com/app/olddriver"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RewriteDir("."); err != nil {
+		t.Fatalf("RewriteDir() fails: %v", err)
+	}
+
+	files := mem.Files()
+	if got := string(files["main.go"]); got != used {
+		t.Errorf("main.go =\n%s\nwant it unchanged", got)
+	}
+	if want := "package main\n\nimport (\n\t\"fmt\"\n)\n\nvar _ = fmt.Println\n"; string(files["other.go"]) != want {
+		t.Errorf("other.go =\n%s\nwant\n%s", files["other.go"], want)
+	}
+}
@@ -0,0 +1,245 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// kindPackage is the kind of the replacers renaming a package clause.
+const kindPackage = "package clause"
+
+// packageRename is the package renamed by RenamePackage or MovePackage.
+type packageRename struct {
+	oldPath, newPath string
+
+	// dir is the directory of the package, and oldName and newName the
+	// names of its package clause.
+	dir              string
+	oldName, newName string
+
+	// rule is the index of the rule of the rename.
+	rule int
+}
+
+// RenamePackage changes the import path of the package oldPath to newPath
+// in the directory dir, as RewriteDir does with an exact rule, and renames
+// the package clause of its files after the last element of newPath, along
+// with the qualifiers referring to it in the files importing it. A main
+// package keeps its clause, so that its command stays one. The files
+// of the package are looked up in the modules of dir, under newPath if they
+// are already moved there, or oldPath otherwise.
+func (r *Rewriter) RenamePackage(dir, oldPath, newPath string) error {
+	return r.renamePackage(dir, Rule{Source: oldPath, Dest: newPath, Mode: MatchExact})
+}
+
+// MovePackage moves the directory of the package oldPath, along with the
+// packages under it, to the directory of newPath in the same module or
+// another module of dir, with git mv if it is tracked by git. It then
+// rewrites dir as RenamePackage does, with a prefix rule so that the
+// imports of the packages under it follow. The directory of a command is
+// moved without renaming its main package. Nothing is moved in DryRun mode,
+// and the directory is moved back if the rewrite fails.
+func (r *Rewriter) MovePackage(dir, oldPath, newPath string) error {
+	oldDir, ok := r.packageDir(dir, oldPath)
+	if !ok {
+		return fmt.Errorf("package %s is not in the modules of %s", oldPath, dir)
+	}
+	newDir, ok := r.pathDir(dir, newPath)
+	if !ok {
+		return fmt.Errorf("%s is not in the modules of %s", newPath, dir)
+	}
+	if _, err := os.Stat(newDir); !os.IsNotExist(err) {
+		return fmt.Errorf("%s already exists", newDir)
+	}
+
+	rule := Rule{Source: oldPath, Dest: newPath, Mode: MatchPrefix}
+	if r.DryRun {
+		r.Log.Infof("would move %s to %s", oldDir, newDir)
+		return r.renamePackage(dir, rule)
+	}
+
+	if err := movePackageDir(oldDir, newDir); err != nil {
+		return err
+	}
+	r.Log.Infof("moved %s to %s", oldDir, newDir)
+
+	err := r.renamePackage(dir, rule)
+	if err != nil {
+		if merr := movePackageDir(newDir, oldDir); merr != nil {
+			return fmt.Errorf("%v, and moving %s back to %s fails: %v", err, newDir, oldDir, merr)
+		}
+		r.Log.Infof("moved %s back to %s", newDir, oldDir)
+	}
+	return err
+}
+
+// movePackageDir moves the directory from to to, with git mv if from is
+// tracked by git so that its history follows.
+func movePackageDir(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+
+	if _, err := git(from, "ls-files", "--error-unmatch", "."); err == nil {
+		abs, err := filepath.Abs(to)
+		if err != nil {
+			return err
+		}
+		_, err = git(filepath.Dir(from), "mv", filepath.Base(from), abs)
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// renamePackage rewrites dir with rule, renaming the package clause of the
+// package of its source. The rule and the options of the rename only last
+// for the run, the rewriter being left as it was.
+func (r *Rewriter) renamePackage(dir string, rule Rule) error {
+	if r.FS != nil {
+		return fmt.Errorf("renaming a package requires the files to be on disk, not in FS")
+	}
+	rules, selectors := r.rules, r.RenameSelectors
+	if err := r.Add(rule); err != nil {
+		return err
+	}
+	defer r.retire(rules, selectors)
+
+	pkgDir, ok := r.packageDir(dir, rule.Dest)
+	if !ok {
+		pkgDir, ok = r.packageDir(dir, rule.Source)
+	}
+	if !ok {
+		return fmt.Errorf("package %s is not in the modules of %s", rule.Source, dir)
+	}
+
+	oldName, err := packageName(pkgDir)
+	if err != nil {
+		return err
+	}
+	newName := assumedName(rule.Dest)
+	if oldName == "main" {
+		newName = oldName
+	}
+
+	r.renamed = &packageRename{
+		oldPath: rule.Source,
+		newPath: rule.Dest,
+		dir:     filepath.Clean(pkgDir),
+		oldName: oldName,
+		newName: newName,
+		rule:    len(r.rules) - 1,
+	}
+
+	if !r.AliasPreserve {
+		r.RenameSelectors = true
+	}
+	return r.RewriteDir(dir)
+}
+
+// retire restores the rules and the RenameSelectors option of the rewriter
+// once a package is renamed, the summary keeping the rule of the rename.
+func (r *Rewriter) retire(rules []Rule, selectors bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := len(r.rules) - 1
+	r.summary.retired = append(r.summary.retired, RuleSummary{Rule: r.rules[i], Imports: r.summary.imports[i]})
+	delete(r.summary.imports, i)
+	r.rules, r.RenameSelectors, r.renamed = rules, selectors, nil
+}
+
+// packageDir returns the directory of the package importPath in the modules
+// found in dir, if it exists.
+func (r *Rewriter) packageDir(dir, importPath string) (string, bool) {
+	pkgDir, ok := r.pathDir(dir, importPath)
+	if !ok {
+		return "", false
+	}
+	if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	return pkgDir, true
+}
+
+// pathDir returns the directory the package importPath has in the innermost
+// module found in dir holding it, whether it exists or not.
+func (r *Rewriter) pathDir(dir, importPath string) (string, bool) {
+	r.findModules(dir)
+	r.walkTree(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if path != dir && (info.Name() == "vendor" || info.Name() == "testdata" || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		r.addModule(path)
+		return nil
+	}, nil)
+
+	var best module
+	for _, m := range r.modules {
+		if m.path == "" || len(m.path) <= len(best.path) {
+			continue
+		}
+		if importPath == m.path || strings.HasPrefix(importPath, m.path+"/") {
+			best = m
+		}
+	}
+	if best.path == "" {
+		return "", false
+	}
+	return filepath.Join(best.dir, filepath.FromSlash(strings.TrimPrefix(importPath, best.path))), true
+}
+
+// packageName returns the name of the package whose files are in dir,
+// ignoring external test packages.
+func packageName(dir string) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	fset := token.NewFileSet()
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, info.Name()), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		if name := f.Name.Name; !strings.HasSuffix(name, "_test") {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no golang source file of a package in %s", dir)
+}
+
+// rewritePackageClause returns the edit renaming the package clause of the
+// file path, if it belongs to the package renamed by RenamePackage. The
+// external test package of the package is renamed too.
+func (r *Rewriter) rewritePackageClause(fset *token.FileSet, file *ast.File, path string) ([]textEdit, []*replacer) {
+	rn := r.renamed
+	if rn == nil || rn.oldName == rn.newName || filepath.Dir(filepath.Clean(path)) != rn.dir {
+		return nil, nil
+	}
+
+	name := file.Name.Name
+	suffix := ""
+	if name == rn.oldName+"_test" {
+		suffix = "_test"
+	} else if name != rn.oldName {
+		return nil, nil
+	}
+
+	start := fset.Position(file.Name.Pos())
+	edit := textEdit{start: start.Offset, end: start.Offset + len(name), text: rn.newName + suffix}
+	hit := &replacer{oldPath: name, newPath: rn.newName + suffix, rule: rn.rule, kind: kindPackage, pos: start}
+	return []textEdit{edit}, []*replacer{hit}
+}
@@ -0,0 +1,188 @@
+package yolk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree writes files, by slash separated path, under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the files, by slash separated path, under dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+const (
+	renameGoMod = "module example.com/m\n\ngo 1.16\n"
+	renameUtil  = "package util\n\nfunc X() {}\n"
+	renameMain  = "package main\n\nimport \"example.com/m/util\"\n\nfunc main() { util.X() }\n"
+)
+
+func TestRenamePackage(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		from, to string
+		want     map[string]string
+	}{
+		{
+			name:  "package clause and qualifiers",
+			files: map[string]string{"go.mod": renameGoMod, "util/u.go": renameUtil, "main.go": renameMain},
+			from:  "example.com/m/util",
+			to:    "example.com/m/strutil",
+			want: map[string]string{
+				"go.mod":    renameGoMod,
+				"util/u.go": "package strutil\n\nfunc X() {}\n",
+				"main.go":   "package main\n\nimport \"example.com/m/strutil\"\n\nfunc main() { strutil.X() }\n",
+			},
+		},
+		{
+			name: "main package",
+			files: map[string]string{
+				"go.mod":        renameGoMod,
+				"cmd/tool/t.go": "package main\n\nfunc main() {}\n",
+			},
+			from: "example.com/m/cmd/tool",
+			to:   "example.com/m/cmd/newtool",
+			want: map[string]string{
+				"go.mod":        renameGoMod,
+				"cmd/tool/t.go": "package main\n\nfunc main() {}\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+
+			r := NewRewriter()
+			if err := r.RenamePackage(dir, tt.from, tt.to); err != nil {
+				t.Fatalf("RenamePackage() fails: %v", err)
+			}
+			got := readTree(t, dir)
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s =\n%s\nwant\n%s", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenamePackageRestoresRewriter(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"go.mod": renameGoMod, "util/u.go": renameUtil, "main.go": renameMain})
+
+	r := NewRewriter()
+	if err := r.AddRule("old.corp/lib", "new.corp/lib"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RenamePackage(dir, "example.com/m/util", "example.com/m/strutil"); err != nil {
+		t.Fatalf("RenamePackage() fails: %v", err)
+	}
+	if n := len(r.Rules()); n != 1 {
+		t.Errorf("rewriter has %d rules after RenamePackage(), want 1", n)
+	}
+	if r.RenameSelectors {
+		t.Errorf("RenameSelectors is set after RenamePackage()")
+	}
+	if s := r.Summary(); len(s.Rules) != 2 || s.Rules[1].Imports != 2 {
+		t.Errorf("Summary() rules = %+v, want the rule of the rename with 2 paths", s.Rules)
+	}
+
+	other := t.TempDir()
+	writeTree(t, other, map[string]string{"go.mod": renameGoMod, "main.go": renameMain})
+	if err := r.RewriteDir(other); err != nil {
+		t.Fatalf("RewriteDir() fails: %v", err)
+	}
+	if got := readTree(t, other)["main.go"]; got != renameMain {
+		t.Errorf("main.go =\n%s\nwant it unchanged", got)
+	}
+}
+
+// failingHandler fails to rewrite the text files.
+type failingHandler struct{}
+
+func (failingHandler) Name() string { return "failing" }
+
+func (failingHandler) Match(path string) bool { return filepath.Ext(path) == ".txt" }
+
+func (failingHandler) Rewrite(path string, src []byte, m Mapper) ([]byte, error) {
+	return nil, fmt.Errorf("%s can't be rewritten", path)
+}
+
+func TestMovePackage(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"go.mod": renameGoMod, "util/u.go": renameUtil, "main.go": renameMain})
+
+	r := NewRewriter()
+	if err := r.MovePackage(dir, "example.com/m/util", "example.com/m/text/strutil"); err != nil {
+		t.Fatalf("MovePackage() fails: %v", err)
+	}
+	want := map[string]string{
+		"go.mod":            renameGoMod,
+		"text/strutil/u.go": "package strutil\n\nfunc X() {}\n",
+		"main.go":           "package main\n\nimport \"example.com/m/text/strutil\"\n\nfunc main() { strutil.X() }\n",
+	}
+	got := readTree(t, dir)
+	if len(got) != len(want) {
+		t.Errorf("MovePackage() leaves %d files, want %d", len(got), len(want))
+	}
+	for name, want := range want {
+		if got[name] != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got[name], want)
+		}
+	}
+}
+
+func TestMovePackageFailure(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"go.mod": renameGoMod, "util/u.go": renameUtil, "main.go": renameMain, "notes.txt": "example.com/m/util\n"}
+	writeTree(t, dir, files)
+
+	r := NewRewriter()
+	r.AddHandler(failingHandler{})
+	r.Atomic = true
+	if err := r.MovePackage(dir, "example.com/m/util", "example.com/m/strutil"); err == nil {
+		t.Fatalf("MovePackage() succeeds with a file failing to be rewritten")
+	}
+	got := readTree(t, dir)
+	if len(got) != len(files) {
+		t.Errorf("MovePackage() leaves %d files, want %d", len(got), len(files))
+	}
+	for name, want := range files {
+		if got[name] != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, got[name], want)
+		}
+	}
+}
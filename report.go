@@ -0,0 +1,68 @@
+package yolk
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Reporter receives every file whose content is changed by a rewrite.
+type Reporter interface {
+	// Report is called with the original and the rewritten content of path.
+	Report(path string, src, dst []byte) error
+}
+
+// DiffReporter writes the unified diff of every changed file to W.
+type DiffReporter struct {
+	W io.Writer
+}
+
+// Report implements Reporter.
+func (d *DiffReporter) Report(path string, src, dst []byte) error {
+	_, err := d.W.Write(Diff(path, src, dst))
+	return err
+}
+
+// Explain implements Explainer, writing the changes as comment lines ahead
+// of the diff of the file.
+func (d *DiffReporter) Explain(path string, changes []Explanation) error {
+	return writeExplanations(d.W, path, changes)
+}
+
+// ListReporter writes the name of every changed file to W, one per line.
+type ListReporter struct {
+	W io.Writer
+}
+
+// Report implements Reporter.
+func (l *ListReporter) Report(path string, src, dst []byte) error {
+	_, err := fmt.Fprintln(l.W, path)
+	return err
+}
+
+// PatchReporter writes the changes of every file to W as a patch which can
+// be applied by git apply, with the file names relative to Root.
+type PatchReporter struct {
+	W    io.Writer
+	Root string
+}
+
+// Report implements Reporter.
+func (p *PatchReporter) Report(path string, src, dst []byte) error {
+	name := filepath.ToSlash(path)
+	if rel, err := filepath.Rel(p.Root, path); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+
+	if _, err := fmt.Fprintf(p.W, "diff --git a/%s b/%s\n", name, name); err != nil {
+		return err
+	}
+	_, err := p.W.Write(Diff(name, src, dst))
+	return err
+}
+
+// Explain implements Explainer, writing the changes as comment lines ahead
+// of the patch of the file, which git apply skips.
+func (p *PatchReporter) Explain(path string, changes []Explanation) error {
+	return writeExplanations(p.W, path, changes)
+}
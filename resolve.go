@@ -0,0 +1,93 @@
+package yolk
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// packageName returns the name of the package of the import path, as
+// goimports resolves it: from the package clauses of its directory if it
+// belongs to a module walked, or else as go list tells in the module of the
+// golang source file, which sees the module graph. The name is assumed from
+// the path if the package is found nowhere. Names are looked up once per
+// run.
+func (r *Rewriter) packageName(file, path string) string {
+	r.mu.Lock()
+	name, ok := r.pkgName[path]
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	name, ok = r.localPackageName(path)
+	if !ok && r.FS == nil {
+		dir := r.root
+		if _, m, found := r.moduleOf(file); found {
+			dir = m.dir
+		}
+		name, ok = listPackageName(dir, path)
+	}
+	if !ok {
+		name = assumedName(path)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pkgName == nil {
+		r.pkgName = make(map[string]string)
+	}
+	r.pkgName[path] = name
+	return name
+}
+
+// localPackageName returns the name of the package of the import path from
+// the package clause of its first non test file, if its directory belongs
+// to the innermost module walked enclosing it.
+func (r *Rewriter) localPackageName(path string) (string, bool) {
+	var mod module
+	for _, m := range r.modules {
+		if m.path != "" && hasPathPrefix(path, m.path) && len(m.path) > len(mod.path) {
+			mod = m
+		}
+	}
+	if mod.path == "" {
+		return "", false
+	}
+
+	dir := filepath.Join(mod.dir, filepath.FromSlash(strings.TrimPrefix(path, mod.path)))
+	names, err := r.fs().ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := r.fs().ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if f, err := parser.ParseFile(fset, name, src, parser.PackageClauseOnly); err == nil {
+			return f.Name.Name, true
+		}
+	}
+	return "", false
+}
+
+// listPackageName returns the name of the package of the import path, as
+// go list run in dir tells.
+func listPackageName(dir, path string) (string, bool) {
+	cmd := exec.Command("go", "list", "-e", "-f", "{{.Name}}", path)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	name := string(bytes.TrimSpace(out))
+	return name, name != ""
+}
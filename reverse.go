@@ -0,0 +1,205 @@
+package yolk
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+// Reverse returns the rule replacing the destination of r with its source,
+// undoing r. A regular expression rule can only be reversed if it is
+// anchored at both ends, made of literal text and capture groups only, and
+// if its destination references every group exactly once. A transform is
+// reversed by the transform undoing it. The reverse keeps the scope of r,
+// but not its alias, the names the imports had being unknown.
+func (r Rule) Reverse() (Rule, error) {
+	if err := r.validate(); err != nil {
+		return Rule{}, err
+	}
+
+	var (
+		rev Rule
+		err error
+	)
+	switch {
+	case r.Remove != "":
+		return Rule{}, fmt.Errorf("rule %s can't be reversed, the imports it deletes are gone", r)
+	case r.Add != "":
+		return Rule{}, fmt.Errorf("rule %s can't be reversed, the imports it adds can't be told apart", r)
+	case r.Unalias != "":
+		return Rule{}, fmt.Errorf("rule %s can't be reversed, the names it drops are gone", r)
+	case r.Transform != "":
+		rev = Rule{Transform: transforms[r.Transform].reverse}
+	case r.Mode == MatchRegex:
+		rev, err = r.reverseRegex()
+	default:
+		rev = Rule{Source: r.Dest, Dest: r.Source, Mode: r.Mode}
+	}
+	rev.Include, rev.Exclude, rev.Build, rev.Embed = r.Include, r.Exclude, r.Build, r.Embed
+	for _, e := range r.Except {
+		// the paths the exceptions would have been moved to are left alone
+		if np, ok := r.replace(e); ok {
+			e = np
+		}
+		rev.Except = append(rev.Except, e)
+	}
+	if r.Symbol != "" {
+		rev.Symbol = r.newSymbol()
+		if r.Rename != "" {
+			rev.Rename = r.Symbol
+		}
+	}
+	return rev, err
+}
+
+// regexPart is a piece of a regular expression or of a replacement
+// template: a literal text, or a reference to a capture group.
+type regexPart struct {
+	lit string
+	cap int
+}
+
+func (r Rule) reverseRegex() (Rule, error) {
+	fail := func(reason string) (Rule, error) {
+		return Rule{}, fmt.Errorf("rule %s can't be reversed, %s", r, reason)
+	}
+
+	re, err := syntax.Parse(r.Source, syntax.Perl)
+	if err != nil {
+		return Rule{}, err
+	}
+	re = re.Simplify()
+
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText || re.Sub[len(re.Sub)-1].Op != syntax.OpEndText {
+		return fail("its source is not anchored with ^ and $")
+	}
+
+	var (
+		src  []regexPart
+		caps = make(map[int]*syntax.Regexp)
+	)
+	for _, sub := range re.Sub[1 : len(re.Sub)-1] {
+		switch {
+		case sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0:
+			src = append(src, regexPart{lit: string(sub.Rune)})
+		case sub.Op == syntax.OpCapture:
+			src = append(src, regexPart{cap: sub.Cap})
+			caps[sub.Cap] = sub.Sub[0]
+		default:
+			return fail("its source holds " + sub.String() + " outside of capture groups")
+		}
+	}
+
+	dst, err := parseTemplate(r.Dest, r.re)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	// the groups of the reversed rule are numbered in the order of dst
+	order := make(map[int]int)
+	var source strings.Builder
+	source.WriteString("^")
+	for _, p := range dst {
+		if p.cap == 0 {
+			source.WriteString(regexp.QuoteMeta(p.lit))
+			continue
+		}
+		if _, ok := order[p.cap]; ok {
+			return fail("its destination references a group twice")
+		}
+		order[p.cap] = len(order) + 1
+		source.WriteString("(" + caps[p.cap].String() + ")")
+	}
+	source.WriteString("$")
+
+	if len(order) != len(caps) {
+		return fail("its destination drops a group")
+	}
+
+	var dest strings.Builder
+	for _, p := range src {
+		if p.cap == 0 {
+			dest.WriteString(strings.Replace(p.lit, "$", "$$", -1))
+			continue
+		}
+		dest.WriteString("${" + strconv.Itoa(order[p.cap]) + "}")
+	}
+
+	return Rule{Source: source.String(), Dest: dest.String(), Mode: MatchRegex}, nil
+}
+
+// parseTemplate splits the replacement template of re, in the syntax of
+// regexp.Regexp.Expand, into literal texts and group references.
+func parseTemplate(tmpl string, re *regexp.Regexp) ([]regexPart, error) {
+	var (
+		parts []regexPart
+		lit   strings.Builder
+	)
+	for len(tmpl) > 0 {
+		i := strings.IndexByte(tmpl, '$')
+		if i < 0 {
+			lit.WriteString(tmpl)
+			break
+		}
+		lit.WriteString(tmpl[:i])
+		tmpl = tmpl[i+1:]
+
+		if strings.HasPrefix(tmpl, "$") {
+			lit.WriteByte('$')
+			tmpl = tmpl[1:]
+			continue
+		}
+
+		var name string
+		if strings.HasPrefix(tmpl, "{") {
+			end := strings.IndexByte(tmpl, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("its destination has an unterminated ${")
+			}
+			name, tmpl = tmpl[1:end], tmpl[end+1:]
+		} else {
+			end := 0
+			for end < len(tmpl) && isTemplateNameByte(tmpl[end]) {
+				end++
+			}
+			name, tmpl = tmpl[:end], tmpl[end:]
+		}
+
+		n, ok := groupIndex(re, name)
+		if !ok {
+			return nil, fmt.Errorf("its destination references the unknown group %q", name)
+		}
+
+		if lit.Len() > 0 {
+			parts = append(parts, regexPart{lit: lit.String()})
+			lit.Reset()
+		}
+		parts = append(parts, regexPart{cap: n})
+	}
+
+	if lit.Len() > 0 {
+		parts = append(parts, regexPart{lit: lit.String()})
+	}
+	return parts, nil
+}
+
+func isTemplateNameByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// groupIndex returns the index of the capture group of re referenced by
+// name, either its number or its name.
+func groupIndex(re *regexp.Regexp, name string) (int, bool) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n, n > 0 && n <= re.NumSubexp()
+	}
+
+	for i, sub := range re.SubexpNames() {
+		if sub != "" && sub == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
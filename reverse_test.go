@@ -0,0 +1,85 @@
+package yolk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleReverse(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		tests []matchTest
+	}{
+		{
+			name: "prefix",
+			rule: Rule{Source: "old.corp/lib", Dest: "new.corp/lib"},
+			tests: []matchTest{
+				{"new.corp/lib", "old.corp/lib"},
+				{"new.corp/lib/sub", "old.corp/lib/sub"},
+				{"old.corp/lib", ""},
+			},
+		},
+		{
+			name: "exact",
+			rule: Rule{Source: "old.corp/lib", Dest: "new.corp/lib", Mode: MatchExact},
+			tests: []matchTest{
+				{"new.corp/lib", "old.corp/lib"},
+				{"new.corp/lib/sub", ""},
+			},
+		},
+		{
+			name: "except",
+			rule: Rule{Source: "old.corp/lib", Dest: "new.corp/lib", Except: []string{"old.corp/lib/keep"}},
+			tests: []matchTest{
+				{"new.corp/lib/sub", "old.corp/lib/sub"},
+				{"new.corp/lib/keep", ""},
+			},
+		},
+		{
+			name: "regex",
+			rule: Rule{Source: `^corp/libs/([a-z]+)/(v[0-9]+)$`, Dest: "corp.example.com/$2/go-$1", Mode: MatchRegex},
+			tests: []matchTest{
+				{"corp.example.com/v2/go-yaml", "corp/libs/yaml/v2"},
+				{"corp.example.com/go-yaml", ""},
+			},
+		},
+		{
+			name: "transform",
+			rule: Rule{Transform: "gopkg.in-to-github"},
+			tests: []matchTest{
+				{"github.com/go-yaml/yaml/v3", "gopkg.in/yaml.v3"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rev, err := tt.rule.Reverse()
+			if err != nil {
+				t.Fatalf("Reverse() fails: %v", err)
+			}
+			runMatchTests(t, newRuleRewriter(t, rev), tt.tests)
+		})
+	}
+}
+
+func TestRuleReverseErrors(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{Remove: "old.corp/lib"}, "deletes"},
+		{Rule{Source: `old\.corp/(.*)`, Dest: "new.corp/$1", Mode: MatchRegex}, "anchored"},
+		{Rule{Source: `^old\.corp/[a-z]+$`, Dest: "new.corp/lib", Mode: MatchRegex}, "outside of capture groups"},
+		{Rule{Source: `^old\.corp/(.*)$`, Dest: "new.corp/$1/$1", Mode: MatchRegex}, "twice"},
+		{Rule{Source: `^old\.corp/(.*)/(.*)$`, Dest: "new.corp/$1", Mode: MatchRegex}, "drops a group"},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.rule.Reverse()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Reverse() of %s fails with %v, want an error about %q", tt.rule, err, tt.want)
+		}
+	}
+}
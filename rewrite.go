@@ -0,0 +1,520 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// SkipParseError is the reason why the golang source files which fail to be
+// parsed are skipped, unless FailOnParseError is set. They are listed in the
+// ParseErrors of the summary.
+const SkipParseError = "parse error"
+
+// Kinds of the replacers which are not imports, naming what they rewrite.
+const (
+	kindImport    = "import"
+	kindString    = "string"
+	kindComment   = "import comment"
+	kindDirective = "go:generate"
+	kindModFile   = "go.mod"
+	kindVendor    = "modules.txt"
+)
+
+type replacer struct {
+	// spec is the rewritten import, if it is one.
+	spec *ast.ImportSpec
+
+	name    string
+	oldPath string
+	newPath string
+	rule    int
+
+	// kind tells what is rewritten, and pos where if known.
+	kind string
+	pos  token.Position
+
+	// newName is the name of the new import, which differs from name when
+	// an alias is added to keep the package identifier of the old path, or
+	// set by the rule, aliased telling the latter.
+	newName string
+	aliased bool
+
+	// merged tells the new path is already imported, so the old import is
+	// only dropped, into being the rewritten import it is merged into if
+	// any, dropBlank that a blank import of the new path is dropped in favor
+	// of the rewritten one, removed that the import is deleted by a remove
+	// rule, added that it is added by an add rule, and unaliased that its
+	// name is dropped by an unalias rule.
+	merged    bool
+	into      *replacer
+	dropBlank bool
+	removed   bool
+	added     bool
+	unaliased bool
+}
+
+func importPath(s *ast.ImportSpec) string {
+	t, err := strconv.Unquote(s.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+func importName(s *ast.ImportSpec) string {
+	if s.Name == nil {
+		return ""
+	}
+	return s.Name.Name
+}
+
+// fileResult is the outcome of rewriting a single file in memory.
+type fileResult struct {
+	path      string
+	perm      os.FileMode
+	modTime   time.Time
+	src       []byte
+	dst       []byte
+	replacers []*replacer
+	err       error
+
+	// skipped is the reason why the file is left alone, if it is, and
+	// detail tells more about it.
+	skipped string
+	detail  string
+}
+
+// RewriteFile rewrites the import statements of the golang source file path
+// in place, or the module paths if path is a go.mod file. The original
+// content is restored if the file can't be written.
+func (r *Rewriter) RewriteFile(path string) error {
+	return r.commit(r.process(path))
+}
+
+// process reads the file path and rewrites its content in memory. It is safe
+// to be called concurrently.
+func (r *Rewriter) process(path string) *fileResult {
+	res := &fileResult{path: path}
+	r.Log.Log(LevelDebug, Event{Event: EventFileStart, Path: path})
+
+	fi, err := r.fs().Stat(path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.perm = fi.Mode().Perm()
+	res.modTime = fi.ModTime()
+	if res.perm&0200 == 0 {
+		// read-only files fail to be written, on Windows notably
+		res.skipped = "read-only"
+		return res
+	}
+
+	res.src, err = r.fs().ReadFile(path)
+	if err != nil {
+		res.err = err
+		return res
+	}
+
+	if r.cache.clean(path, res.src) {
+		res.dst = res.src
+		return res
+	}
+	r.rewrite(res)
+	r.cache.record(res)
+	return res
+}
+
+// RewriteSource returns src, the content of the file path, with its import
+// paths rewritten, without touching any file nor recording anything in the
+// summary. src is returned as is if the file is not handled by RewriteDir.
+func (r *Rewriter) RewriteSource(path string, src []byte) ([]byte, error) {
+	if _, ok := r.handlerFor(path); !ok || (filepath.Base(path) == "go.mod" || isWorkFile(filepath.Base(path))) && !r.GoMod {
+		return src, nil
+	}
+
+	res := &fileResult{path: path, src: src}
+	r.rewrite(res)
+	if res.err != nil {
+		return nil, res.err
+	}
+	if res.skipped != "" {
+		return src, nil
+	}
+	return res.dst, nil
+}
+
+// rewrite rewrites the content of res in memory, according to its kind of
+// file, keeping its byte order mark and CRLF line endings.
+func (r *Rewriter) rewrite(res *fileResult) {
+	src := res.src
+	format, text := stripFormat(src)
+	res.src = text
+	defer func() {
+		res.src = src
+		if res.dst != nil {
+			res.dst = format.restore(res.dst)
+		}
+	}()
+
+	path := res.path
+	if h, _ := r.handlerFor(path); h != nil {
+		res.dst, res.err = h.Rewrite(relPath(r.root, path), res.src, r.mapper(path, h.Name(), &res.replacers))
+		return
+	}
+
+	switch {
+	case filepath.Base(path) == "go.mod":
+		res.dst, res.replacers, res.err = r.rewriteModFile(path, res.src)
+	case filepath.Base(path) == "go.work":
+		res.dst, res.replacers = r.rewriteWorkFile(path, res.src)
+	case filepath.Base(path) == "go.work.sum":
+		res.dst, res.replacers = r.rewriteWorkSum(path, res.src)
+	case isModulesTxt(path):
+		res.dst, res.replacers = r.rewriteModulesTxt(path, res.src)
+	case !r.RewriteGenerated && isGenerated(res.src):
+		res.skipped = "generated"
+	default:
+		r.noteBuild(path, res.src)
+		res.dst, res.replacers, res.err = r.rewriteSource(path, res.src)
+		// testdata often holds deliberately invalid code
+		if _, ok := res.err.(scanner.ErrorList); ok && (!r.FailOnParseError || inTestdata(path)) {
+			res.skipped, res.detail = SkipParseError, res.err.Error()
+			res.dst, res.replacers, res.err = nil, nil, nil
+		}
+	}
+}
+
+// commit reports and writes the result of process, and records it in the
+// summary.
+func (r *Rewriter) commit(res *fileResult) error {
+	if err := r.confirm(res); err != nil {
+		if err != ErrStop {
+			r.record(res, err)
+		}
+		return err
+	}
+
+	err := r.apply(res)
+	r.record(res, err)
+	return err
+}
+
+func (r *Rewriter) apply(res *fileResult) error {
+	if err := r.report(res); err != nil {
+		return err
+	}
+
+	// a file left byte-identical is never touched, so runs are idempotent
+	if r.DryRun || res.skipped != "" || bytes.Equal(res.src, res.dst) {
+		return nil
+	}
+
+	if err := r.writeFile(res.path, res.src, res.dst, res.perm); err != nil {
+		return err
+	}
+	return r.keepTime(res)
+}
+
+// keepTime sets the modification time of the file written for res back to
+// the one it had before, in PreserveTimes mode.
+func (r *Rewriter) keepTime(res *fileResult) error {
+	if !r.PreserveTimes || res.modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(res.path, time.Now(), res.modTime)
+}
+
+// confirm asks Confirm whether the file of res should be written, if it
+// changes, marking it skipped otherwise.
+func (r *Rewriter) confirm(res *fileResult) error {
+	if r.Confirm == nil || r.DryRun || res.err != nil || res.skipped != "" || bytes.Equal(res.src, res.dst) {
+		return nil
+	}
+
+	ok, err := r.Confirm(res.path, res.src, res.dst)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		res.skipped = "declined"
+	}
+	return nil
+}
+
+// report hands the result of process to the reporter, if it changes the
+// file.
+func (r *Rewriter) report(res *fileResult) error {
+	if res.err != nil {
+		return res.err
+	}
+
+	if r.Reporter != nil && res.skipped == "" && !bytes.Equal(res.src, res.dst) {
+		if r.Explain {
+			if err := r.explain(res); err != nil {
+				return err
+			}
+		}
+		return r.Reporter.Report(res.path, res.src, res.dst)
+	}
+	return nil
+}
+
+// rewriteSource returns the content of src with its import statements
+// rewritten. The filename is only used for position information. Only the
+// import declarations are regenerated, along with the renamed package
+// qualifiers, every other byte of src is kept as it is.
+func (r *Rewriter) rewriteSource(path string, src []byte) ([]byte, []*replacer, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the symbols moved to other packages are qualified by their new
+	// package first, dropping the imports left unused
+	symEdits, symHits, moves := r.moveSymbols(fset, path, file)
+	dropped := make(map[*ast.ImportSpec]bool)
+	for _, imp := range moves.drop {
+		dropped[imp] = true
+	}
+
+	// every import is rewritten on its own, whatever declaration it is in
+	// and however many times its path is imported under other names; an
+	// import already migrated is left alone, and so is the one of cgo,
+	// whatever the rules
+	replacers := make([]*replacer, 0)
+	for _, imp := range file.Imports {
+		impPath := importPath(imp)
+		if dropped[imp] || impPath == cgoPath {
+			continue
+		}
+		if i, ok := r.removal(path, file, imp); ok {
+			replacers = append(replacers, &replacer{
+				spec:    imp,
+				oldPath: impPath,
+				name:    importName(imp),
+				rule:    i,
+				kind:    kindRemoved,
+				pos:     fset.Position(imp.Path.Pos()),
+				removed: true,
+			})
+			continue
+		}
+		i, np, ok := r.match(path, impPath)
+		if ok && (np != impPath || r.rules[i].realiases(imp)) && r.typed.moves(&r.rules[i], impPath) {
+			name := importName(imp)
+			replacers = append(replacers, &replacer{
+				spec:    imp,
+				oldPath: impPath,
+				newPath: np,
+				name:    name,
+				newName: name,
+				rule:    i,
+				kind:    kindImport,
+				pos:     fset.Position(imp.Path.Pos()),
+			})
+		}
+	}
+
+	replacers = append(replacers, r.additions(fset, path, file, replacers)...)
+	replacers = append(replacers, r.unaliases(fset, path, file, replacers, dropped)...)
+
+	edits, hits := r.rewriteImportComment(fset, file)
+	edits, hits = append(edits, symEdits...), append(hits, symHits...)
+	if r.renamed != nil {
+		e, h := r.rewritePackageClause(fset, file, path)
+		edits, hits = append(edits, e...), append(hits, h...)
+	}
+	if r.GenerateDirectives {
+		e, h := r.rewriteGenerateDirectives(fset, file)
+		edits, hits = append(edits, e...), append(hits, h...)
+	}
+	if r.Strings {
+		e, h := r.rewriteStrings(fset, file)
+		edits, hits = append(edits, e...), append(hits, h...)
+	}
+	e, h := r.rewriteEmbedDirectives(fset, file, path)
+	edits, hits = append(edits, e...), append(hits, h...)
+	if len(replacers) == 0 && len(moves.drop) == 0 && len(moves.add) == 0 {
+		return applyEdits(src, edits), hits, nil
+	}
+
+	// the declarations are taken before they are modified
+	decls := importDecls(fset, file)
+
+	edits = append(edits, mergeImports(fset, file, replacers)...)
+	edits = append(edits, r.applyAliases(fset, file, replacers)...)
+	edits = append(edits, r.dropAliases(fset, file, replacers)...)
+	if r.RenameSelectors || r.AliasPreserve {
+		edits = append(edits, r.keepPackageNames(fset, file, replacers)...)
+	}
+	edits = append(edits, r.renameMerged(fset, file, replacers)...)
+
+	// the imports are rewritten in place, keeping their declaration, group
+	// and comments, before the merged ones are deleted
+	for _, rp := range replacers {
+		if !rp.merged && !rp.removed && !rp.added {
+			rewriteSpec(rp)
+		}
+	}
+	for _, rp := range replacers {
+		if rp.dropBlank {
+			astutil.DeleteNamedImport(fset, file, "_", rp.newPath)
+		}
+		if (rp.merged || rp.removed) && !astutil.DeleteNamedImport(fset, file, rp.name, rp.oldPath) {
+			return nil, nil, fmt.Errorf("delete old path fails")
+		}
+	}
+	for _, imp := range moves.drop {
+		if !astutil.DeleteNamedImport(fset, file, importName(imp), importPath(imp)) {
+			return nil, nil, fmt.Errorf("delete old path fails")
+		}
+	}
+	if r.PruneUnused {
+		for _, p := range pruneUnused(fset, file) {
+			r.Log.Verbosef("%s: unused import %s pruned", path, p)
+		}
+	}
+
+	// the added imports go in the first import declaration, or in
+	// declarations of their own without one
+	var added []newImport
+	for _, rp := range replacers {
+		if rp.added {
+			added = append(added, newImport{name: "_", path: rp.newPath})
+		}
+	}
+	added = append(added, moves.add...)
+	if len(added) > 0 && (r.MinimalDiff || !hasImportDecl(file)) {
+		edits = append(edits, addImportsEdit(fset, file, src, added))
+	} else {
+		for _, imp := range added {
+			astutil.AddNamedImport(fset, file, imp.name, imp.path)
+		}
+	}
+
+	// only the modified declarations are formatted, every other byte of
+	// the file is spliced as it is
+	for _, d := range decls {
+		e, ok, err := r.formatDecl(path, fset, file, src, d)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			edits = append(edits, e)
+		}
+	}
+
+	return applyEdits(src, edits), append(replacers, hits...), nil
+}
+
+// rewriteSpec replaces the path of the import of rp, and its name with the
+// new name. The blank and dot designators are never changed.
+func rewriteSpec(rp *replacer) {
+	rp.spec.Path.Value = strconv.Quote(rp.newPath)
+	switch {
+	case rp.newName == rp.name:
+	case rp.newName == "":
+		rp.spec.Name = nil
+	default:
+		rp.spec.Name = &ast.Ident{NamePos: rp.spec.Path.Pos(), Name: rp.newName}
+	}
+}
+
+// writeFile replaces the content src of path with data, keeping a backup of
+// src until the write succeeds.
+func writeFile(path string, src, data []byte, perm os.FileMode) error {
+	// backup first
+	backname, err := backupFile(path+".", src, perm)
+	if err != nil {
+		return err
+	}
+
+	// write content to file
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		os.Rename(backname, path)
+		return err
+	}
+
+	// delete backup file
+	return os.Remove(backname)
+}
+
+func backupFile(filename string, data []byte, perm os.FileMode) (string, error) {
+	backfile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return "", err
+	}
+
+	backname := backfile.Name()
+
+	if chmodSupported {
+		err = backfile.Chmod(perm)
+		if err != nil {
+			backfile.Close()
+			os.Remove(backname)
+			return backname, err
+		}
+	}
+
+	if _, err := backfile.Write(data); err != nil {
+		return backname, err
+	}
+
+	if err := backfile.Close(); err != nil {
+		return backname, err
+	}
+
+	return backname, nil
+}
+
+// keepPackageNames keeps the code compiling for unnamed imports whose
+// package name changes with the rewrite: the new import is aliased with the
+// old name in alias preserving mode, or if the new name is already in use in
+// the file; otherwise the qualifiers referring to the package are renamed.
+// The returned edits apply the renames to the source.
+func (r *Rewriter) keepPackageNames(fset *token.FileSet, file *ast.File, replacers []*replacer) []textEdit {
+	type rename struct{ old, new string }
+
+	var renames []rename
+	for _, rp := range replacers {
+		if rp.name != "" || rp.merged || rp.aliased || rp.removed || rp.added {
+			continue
+		}
+
+		oldName, newName := assumedName(rp.oldPath), assumedName(rp.newPath)
+		if rn := r.renamed; rn != nil && rp.oldPath == rn.oldPath {
+			oldName = rn.oldName
+		}
+		if oldName == newName {
+			continue
+		}
+
+		if r.AliasPreserve || nameInUse(file, newName) {
+			rp.newName = oldName
+			continue
+		}
+		renames = append(renames, rename{oldName, newName})
+	}
+
+	var edits []textEdit
+	for _, rn := range renames {
+		for _, id := range renameQualifier(file, rn.old, rn.new) {
+			off := fset.Position(id.Pos()).Offset
+			edits = append(edits, textEdit{start: off, end: off + len(rn.old), text: rn.new})
+		}
+	}
+	return edits
+}
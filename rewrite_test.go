@@ -0,0 +1,310 @@
+package yolk
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rewriteTest is a golang source file rewritten by RewriteSource with the
+// rules of -s old.corp/lib -r new.corp/lib.
+type rewriteTest struct {
+	name string
+	src  string
+	want string
+}
+
+func runRewriteTests(t *testing.T, tests []rewriteTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRewriter()
+			if err := r.AddRule("old.corp/lib", "new.corp/lib"); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := r.RewriteSource("a.go", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// runGoldenTests rewrites the files of testdata/dir, each named
+// name.input.go, with the rules of runRewriteTests and the options set by
+// setup, if not nil, and compares them with name.golden.go, then calls
+// check, if not nil, with the source and its rewrite.
+func runGoldenTests(t *testing.T, dir string, setup func(r *Rewriter), check func(t *testing.T, src, got []byte)) {
+	t.Helper()
+	inputs, err := filepath.Glob(filepath.Join("testdata", dir, "*.input.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no fixture found in testdata/%s", dir)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".input.go")
+		t.Run(name, func(t *testing.T) {
+			src, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ioutil.ReadFile(filepath.Join("testdata", dir, name+".golden.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewRewriter()
+			if setup != nil {
+				setup(r)
+			}
+			if err := r.AddRule("old.corp/lib", "new.corp/lib"); err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.RewriteSource(input, src)
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, want)
+			}
+			if check != nil {
+				check(t, src, got)
+			}
+		})
+	}
+}
+
+func TestRewriteSourceGroups(t *testing.T) {
+	runRewriteTests(t, []rewriteTest{
+		{
+			name: "every group",
+			src: `package a
+
+import (
+	"fmt"
+
+	"old.corp/lib/bar"
+	"old.corp/other"
+
+	"old.corp/lib/foo"
+)
+
+var _, _, _, _ = fmt.Println, bar.X, other.X, foo.X
+`,
+			want: `package a
+
+import (
+	"fmt"
+
+	"new.corp/lib/bar"
+	"old.corp/other"
+
+	"new.corp/lib/foo"
+)
+
+var _, _, _, _ = fmt.Println, bar.X, other.X, foo.X
+`,
+		},
+		{
+			name: "several declarations",
+			src: `package a
+
+import "old.corp/lib/foo"
+
+import (
+	"fmt"
+
+	"old.corp/lib/bar"
+)
+
+var _, _, _ = fmt.Println, bar.X, foo.X
+`,
+			want: `package a
+
+import "new.corp/lib/foo"
+
+import (
+	"fmt"
+
+	"new.corp/lib/bar"
+)
+
+var _, _, _ = fmt.Println, bar.X, foo.X
+`,
+		},
+		{
+			name: "repeated path under other names",
+			src: `package a
+
+import (
+	foo "old.corp/lib/foo"
+
+	gen "old.corp/lib/foo"
+)
+
+var _, _ = foo.X, gen.X
+`,
+			want: `package a
+
+import (
+	foo "new.corp/lib/foo"
+
+	gen "new.corp/lib/foo"
+)
+
+var _, _ = foo.X, gen.X
+`,
+		},
+		{
+			name: "unmatched imports left alone",
+			src: `package a
+
+import (
+	"old.corp/lib/zz"
+	"old.corp/x"
+
+	"old.corp/lib/aa"
+	"old.corp/y"
+)
+
+var _, _, _, _ = zz.X, x.X, aa.X, y.X
+`,
+			want: `package a
+
+import (
+	"new.corp/lib/zz"
+	"old.corp/x"
+
+	"new.corp/lib/aa"
+	"old.corp/y"
+)
+
+var _, _, _, _ = zz.X, x.X, aa.X, y.X
+`,
+		},
+	})
+}
+
+func TestRewriteSourceDesignators(t *testing.T) {
+	runRewriteTests(t, []rewriteTest{
+		{
+			name: "blank import",
+			src: `package a
+
+import _ "old.corp/lib/driver"
+`,
+			want: `package a
+
+import _ "new.corp/lib/driver"
+`,
+		},
+		{
+			name: "dot import",
+			src: `package a
+
+import . "old.corp/lib/dsl"
+
+var _ = Rule
+`,
+			want: `package a
+
+import . "new.corp/lib/dsl"
+
+var _ = Rule
+`,
+		},
+		{
+			name: "blank and dot imports of a same path",
+			src: `package a
+
+import (
+	. "old.corp/lib/dsl"
+	_ "old.corp/lib/dsl"
+	_ "old.corp/lib/driver"
+)
+
+var _ = Rule
+`,
+			want: `package a
+
+import (
+	_ "new.corp/lib/driver"
+	. "new.corp/lib/dsl"
+	_ "new.corp/lib/dsl"
+)
+
+var _ = Rule
+`,
+		},
+		{
+			name: "dot imports merged together",
+			src: `package a
+
+import (
+	. "new.corp/lib/dsl"
+	. "old.corp/lib/dsl"
+)
+
+var _ = Rule
+`,
+			want: `package a
+
+import (
+	. "new.corp/lib/dsl"
+)
+
+var _ = Rule
+`,
+		},
+	})
+}
+
+func TestRewriteSourceFormat(t *testing.T) {
+	runRewriteTests(t, []rewriteTest{
+		{
+			name: "CRLF line endings",
+			src:  "package a\r\n\r\nimport (\r\n\t\"fmt\"\r\n\r\n\t\"old.corp/lib/foo\"\r\n)\r\n\r\nvar _, _ = fmt.Println, foo.X\r\n",
+			want: "package a\r\n\r\nimport (\r\n\t\"fmt\"\r\n\r\n\t\"new.corp/lib/foo\"\r\n)\r\n\r\nvar _, _ = fmt.Println, foo.X\r\n",
+		},
+		{
+			name: "byte order mark",
+			src:  "\ufeffpackage a\n\nimport \"old.corp/lib/foo\"\n\nvar _ = foo.X\n",
+			want: "\ufeffpackage a\n\nimport \"new.corp/lib/foo\"\n\nvar _ = foo.X\n",
+		},
+		{
+			name: "mixed line endings",
+			src:  "package a\r\n\nimport \"old.corp/lib/foo\"\n\nvar _ = foo.X\r\n",
+			want: "package a\r\n\nimport \"new.corp/lib/foo\"\n\nvar _ = foo.X\r\n",
+		},
+	})
+}
+
+// TestRewriteSourceBuild rewrites the files of testdata/build, checking
+// their build constraint lines are left exactly as they were.
+func TestRewriteSourceBuild(t *testing.T) {
+	runGoldenTests(t, "build", nil, func(t *testing.T, src, got []byte) {
+		if before, after := constraintLines(src), constraintLines(got); after != before {
+			t.Errorf("build constraints = %q, want %q", after, before)
+		}
+	})
+}
+
+// constraintLines returns the lines of the golang source src which hold
+// build constraints.
+func constraintLines(src []byte) string {
+	var lines []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, "//go:build") || strings.HasPrefix(line, "// +build") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
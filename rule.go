@@ -0,0 +1,348 @@
+package yolk
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// MatchMode decides how the source of a rule is matched against an import
+// path.
+type MatchMode string
+
+const (
+	// MatchPrefix matches the import path equal to the source and every
+	// import path under it, i.e. the source followed by a slash. The source
+	// github.com/foo/bar matches github.com/foo/bar/baz but not
+	// github.com/foo/barbaz.
+	MatchPrefix MatchMode = "prefix"
+	// MatchExact only matches the import path equal to the source.
+	MatchExact MatchMode = "exact"
+	// MatchRegex treats the source as a regular expression, whose capture
+	// groups can be referenced in the destination as $1 or ${name}.
+	MatchRegex MatchMode = "regex"
+)
+
+// Rule replaces the import paths matching Source with Dest. The source of a
+// prefix or exact rule may hold placeholders such as {pkg} or {version},
+// each one matching the text of a single path element, which are resolved
+// in the destination: corp/libs/{pkg} => corp.example.com/go-{pkg}/v2.
+// A rule may instead name a built-in Transform, such as gopkg.in-to-github,
+// rewriting the paths following a common convention.
+//
+// Include, if not empty, restricts the rule to the files matching any of its
+// glob patterns, and Exclude keeps it off the files matching any of its
+// patterns, in the syntax of the Exclude of a Rewriter:
+// services/payments/** scopes a rule to the packages under that directory.
+// Rules holding to tests only are scoped by the include pattern *_test.go.
+//
+// Build, if not empty, restricts the rule to the golang source files which
+// may be built with tags satisfying the build constraint expression, such
+// as integration or linux && !cgo. A file is built as its //go:build line
+// and the GOOS and GOARCH of its name, as in foo_linux_amd64.go, require,
+// the tags they don't name being unset: !cgo holds for the files without
+// constraints, but not for those of //go:build cgo.
+//
+// Alias, if not empty, is the name the imports rewritten by the rule are
+// given, their qualifiers being renamed along. A rule without Dest only sets
+// the alias of the imports of Source, matched exactly by default:
+// corp/logging as log enforces the name of its imports across a codebase.
+//
+// A rule setting Remove instead of a source deletes the imports of the path
+// matched by Remove, exactly by default, from the golang source files which
+// don't use the package: blank imports of deprecated drivers are always
+// deleted, other imports only once no code refers to them.
+//
+// A rule setting Add instead of a destination adds a blank import of the
+// path Add to the golang source files importing Source, matched exactly by
+// default, once rewritten: every file importing corp/sqldriver also imports
+// _ "corp/sqltelemetry".
+//
+// A rule setting Symbol moves the exported identifier of that name from the
+// package Source to the package Dest, for packages split into several: the
+// qualifiers of corp/util.TrimX become those of corp/strutil.TrimX, which
+// is imported if needed, and the import of corp/util is dropped once none
+// of its identifiers are left in the file. Rename, if not empty, is the new
+// name of the identifier, such as for old/http.Client becoming
+// new/http.Transport, Dest defaulting to Source when it keeps its package.
+//
+// Except lists the import paths the rule leaves alone, along with the paths
+// under them, a trailing /... being allowed: corp => corp.example.com
+// except corp/legacy carves the legacy packages out of the migration. The
+// exceptions of a rule always win over it, the paths they hold being left
+// to the rules after it.
+//
+// A rule setting Unalias drops the names the imports of Source are given,
+// their qualifiers being renamed after the package, for the conventions of
+// code reviews: github.com/pkg/errors is never aliased, and versioned
+// imports are named after their path without the version, as yaml for
+// gopkg.in/yaml.v3. An empty source stands for every import path. Source is
+// matched exactly by default, as a prefix in the versioned mode. The rules
+// only setting an alias enforce the converse.
+//
+// Name, if not empty, names the rule in the explanations of Explain mode.
+//
+// A rule setting Embed maps the directory or file Source of embedded files,
+// relative to the walked directory, to Dest, for reorganizations moving
+// assets along with code: the //go:embed patterns under assets/templates
+// follow them to web/templates. Its paths are matched as a prefix by
+// default, and no import path is rewritten.
+type Rule struct {
+	Source    string    `yaml:"source" json:"source"`
+	Dest      string    `yaml:"dest" json:"dest"`
+	Mode      MatchMode `yaml:"mode" json:"mode"`
+	Transform string    `yaml:"transform" json:"transform,omitempty"`
+	Include   []string  `yaml:"include" json:"include,omitempty"`
+	Exclude   []string  `yaml:"exclude" json:"exclude,omitempty"`
+	Build     string    `yaml:"build" json:"build,omitempty"`
+	Alias     string    `yaml:"alias" json:"alias,omitempty"`
+	Remove    string    `yaml:"remove" json:"remove,omitempty"`
+	Add       string    `yaml:"add" json:"add,omitempty"`
+	Symbol    string    `yaml:"symbol" json:"symbol,omitempty"`
+	Rename    string    `yaml:"rename" json:"rename,omitempty"`
+	Embed     bool      `yaml:"embed" json:"embed,omitempty"`
+	Name      string    `yaml:"name" json:"name,omitempty"`
+	Except    []string  `yaml:"except" json:"except,omitempty"`
+	Unalias   string    `yaml:"unalias" json:"unalias,omitempty"`
+
+	// origin is the position of the rule in its rules file, as
+	// rules.yaml:12, if it comes from one.
+	origin string
+
+	re    *regexp.Regexp
+	tmpl  *pathTemplate
+	build constraint.Expr
+}
+
+func (r *Rule) validate() error {
+	if err := r.compileBuild(); err != nil {
+		return fmt.Errorf("invalid build constraint %q of rule %s: %v", r.Build, r, err)
+	}
+	if r.Alias != "" && (!token.IsIdentifier(r.Alias) || r.Alias == "_") {
+		return fmt.Errorf("invalid alias %q of rule %s", r.Alias, r)
+	}
+	// the exceptions may be shared with other rules, by the caller
+	excepts := make([]string, len(r.Except))
+	for i, e := range r.Except {
+		excepts[i] = strings.TrimSuffix(e, "/...")
+		if excepts[i] == "" {
+			return fmt.Errorf("empty exception of rule %s", r)
+		}
+	}
+	if r.Except != nil {
+		r.Except = excepts
+	}
+	if r.Unalias != "" {
+		return r.validateUnalias()
+	}
+	if r.Embed {
+		return r.validateEmbed()
+	}
+	if r.Remove != "" {
+		return r.validateRemove()
+	}
+	if r.Add != "" {
+		return r.validateAdd()
+	}
+	if r.Symbol != "" {
+		return r.validateSymbol()
+	}
+	if r.Transform != "" {
+		return r.validateTransform()
+	}
+	if r.Alias != "" && r.Source != "" && r.Dest == "" {
+		// the path is kept as it is
+		r.Dest = r.Source
+		if r.Mode == "" {
+			r.Mode = MatchExact
+		}
+		if r.Mode == MatchRegex {
+			r.Dest = "$0"
+		}
+	}
+	if r.Source == "" || r.Dest == "" {
+		return fmt.Errorf("you must specify a source or destination import path to handle")
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = MatchPrefix
+	case MatchPrefix, MatchExact:
+	case MatchRegex:
+		re, err := regexp.Compile(r.Source)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of rule %s: %v", r.Source, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown match mode %q of rule %s", r.Mode, r.Source)
+	}
+
+	if r.Mode != MatchRegex {
+		tmpl, err := compileTemplate(r.Source, r.Dest, r.Mode)
+		if err != nil {
+			return fmt.Errorf("invalid template of rule %s: %v", r.Source, err)
+		}
+		r.tmpl = tmpl
+	}
+
+	return nil
+}
+
+// apply returns the import path replaced by the rule, and whether the rule
+// matches path at all, which it doesn't if path is one of its exceptions.
+func (r *Rule) apply(path string) (string, bool) {
+	if r.excepts(path) {
+		return "", false
+	}
+	return r.replace(path)
+}
+
+// excepts reports whether path is one of the exceptions of the rule, or lies
+// under one.
+func (r *Rule) excepts(path string) bool {
+	for _, e := range r.Except {
+		if hasPathPrefix(path, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// replace returns the import path replaced by the rule, regardless of its
+// exceptions.
+func (r *Rule) replace(path string) (string, bool) {
+	if r.Transform != "" {
+		return transforms[r.Transform].apply(path)
+	}
+	if r.tmpl != nil {
+		return r.tmpl.apply(path, r.Dest)
+	}
+
+	switch r.Mode {
+	case MatchExact:
+		if path == r.Source {
+			return r.Dest, true
+		}
+	case MatchRegex:
+		if r.re.MatchString(path) {
+			return r.re.ReplaceAllString(path, r.Dest), true
+		}
+	default:
+		if hasPathPrefix(path, r.Source) {
+			return r.Dest + strings.TrimPrefix(path, r.Source), true
+		}
+	}
+
+	return "", false
+}
+
+// rewrites reports whether the rule replaces the paths it matches, unlike
+// the remove, add, symbol and embed rules.
+func (r *Rule) rewrites() bool {
+	return r.Remove == "" && r.Add == "" && r.Symbol == "" && !r.Embed && r.Unalias == ""
+}
+
+// scoped reports whether the rule only applies to some files.
+func (r *Rule) scoped() bool {
+	return len(r.Include) > 0 || len(r.Exclude) > 0 || r.Build != ""
+}
+
+// inScope reports whether the rule applies to the file of slash separated
+// path rel, relative to the walked directory.
+func (r *Rule) inScope(rel string) bool {
+	if len(r.Include) > 0 {
+		if _, ok := matchAny(r.Include, rel); !ok {
+			return false
+		}
+	}
+	_, excluded := matchAny(r.Exclude, rel)
+	return !excluded
+}
+
+// shadows reports whether r matches every import path matched by o, so o
+// never applies when it comes after r. Regular expressions, templates,
+// transforms and the rules which don't rewrite import paths are not
+// compared, and a scoped rule shadows none.
+func (r *Rule) shadows(o *Rule) bool {
+	switch {
+	case r.scoped():
+		return false
+	case r.exceptsAny(o.Source):
+		return false
+	case r.Transform != "" || o.Transform != "", !r.rewrites() || !o.rewrites():
+		return false
+	case r.Mode == MatchRegex || o.Mode == MatchRegex || r.tmpl != nil || o.tmpl != nil:
+		return false
+	case r.Mode == MatchExact:
+		return o.Mode == MatchExact && o.Source == r.Source
+	default:
+		return hasPathPrefix(o.Source, r.Source)
+	}
+}
+
+// hasPathPrefix reports whether path is prefix or lies under it, honoring
+// the path element boundary.
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// exceptsAny reports whether some paths under source, or source itself, are
+// exceptions of the rule.
+func (r *Rule) exceptsAny(source string) bool {
+	for _, e := range r.Except {
+		if hasPathPrefix(e, source) || hasPathPrefix(source, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the rule in the form of "source => dest (mode)",
+// "source.Symbol => dest.Symbol (mode)", "name (transform)", "remove path
+// (mode)", "source adds path (mode)", "embed source => dest (mode)" or
+// "unalias mode source (mode)",
+// followed by the exceptions as "but path", the alias as "as alias" and the
+// scope as "in include, except exclude, if build".
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s => %s (%s)", r.Source, r.Dest, r.Mode)
+	switch {
+	case r.Transform != "":
+		s = fmt.Sprintf("%s (transform)", r.Transform)
+	case r.Remove != "":
+		s = fmt.Sprintf("remove %s (%s)", r.Remove, r.Mode)
+	case r.Add != "":
+		s = fmt.Sprintf("%s adds %s (%s)", r.Source, r.Add, r.Mode)
+	case r.Symbol != "":
+		s = fmt.Sprintf("%s.%s => %s.%s (%s)", r.Source, r.Symbol, r.Dest, r.newSymbol(), r.Mode)
+	case r.Embed:
+		s = "embed " + s
+	case r.Unalias != "":
+		s = fmt.Sprintf("unalias %s %s (%s)", r.Unalias, r.Source, r.Mode)
+		if r.Source == "" {
+			s = fmt.Sprintf("unalias %s imports", r.Unalias)
+		}
+	}
+	if len(r.Except) > 0 {
+		s += " but " + strings.Join(r.Except, ", ")
+	}
+	if r.Alias != "" {
+		s += " as " + r.Alias
+	}
+	if len(r.Include) > 0 {
+		s += " in " + strings.Join(r.Include, ", ")
+	}
+	if len(r.Exclude) > 0 {
+		s += " except " + strings.Join(r.Exclude, ", ")
+	}
+	if r.Build != "" {
+		s += " if " + r.Build
+	}
+	return s
+}
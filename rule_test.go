@@ -0,0 +1,154 @@
+package yolk
+
+import (
+	"testing"
+)
+
+// matchTest is an import path matched by the rules of a rewriter, want
+// being empty if it is left alone.
+type matchTest struct {
+	path string
+	want string
+}
+
+func runMatchTests(t *testing.T, r *Rewriter, tests []matchTest) {
+	t.Helper()
+	for _, tt := range tests {
+		_, got, ok := r.match("a.go", tt.path)
+		if !ok {
+			got = ""
+		}
+		if got != tt.want {
+			t.Errorf("match(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// newRuleRewriter returns a rewriter with rules.
+func newRuleRewriter(t *testing.T, rules ...Rule) *Rewriter {
+	t.Helper()
+	r := NewRewriter()
+	for _, rule := range rules {
+		if err := r.Add(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestRuleExcept(t *testing.T) {
+	excepts := []string{"old.corp/lib/keep/...", "old.corp/other/keep"}
+	r := NewRewriter()
+	for _, rule := range []Rule{
+		{Source: "old.corp/lib", Dest: "new.corp/lib", Except: excepts},
+		{Source: "old.corp/other", Dest: "new.corp/other", Except: excepts},
+	} {
+		if err := r.Add(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if excepts[0] != "old.corp/lib/keep/..." {
+		t.Errorf("Add() changes the exceptions of the caller to %q", excepts)
+	}
+
+	runMatchTests(t, r, []matchTest{
+		{path: "old.corp/lib/foo", want: "new.corp/lib/foo"},
+		{path: "old.corp/lib/keep", want: ""},
+		{path: "old.corp/lib/keep/sub", want: ""},
+		{path: "old.corp/lib/keeper", want: "new.corp/lib/keeper"},
+		{path: "old.corp/other/keep", want: ""},
+		{path: "old.corp/other/x", want: "new.corp/other/x"},
+	})
+
+	if err := r.Add(Rule{Source: "old.corp/x", Dest: "new.corp/x", Except: []string{"/..."}}); err == nil {
+		t.Errorf("Add() of an empty exception succeeds")
+	}
+}
+
+func TestRules(t *testing.T) {
+	r := newRuleRewriter(t,
+		Rule{Source: "old.corp/lib", Dest: "new.corp/lib"},
+		Rule{Source: "github.com/old/repo", Dest: "github.com/new/repo"},
+		Rule{Source: "old.corp", Dest: "corp.example.com"},
+	)
+	runMatchTests(t, r, []matchTest{
+		{path: "old.corp/lib/foo", want: "new.corp/lib/foo"},
+		{path: "github.com/old/repo", want: "github.com/new/repo"},
+		{path: "github.com/old/repo/sub", want: "github.com/new/repo/sub"},
+		{path: "github.com/old/repository", want: ""},
+		{path: "old.corp/other", want: "corp.example.com/other"},
+		{path: "fmt", want: ""},
+	})
+
+	src := `package a
+
+import (
+	"github.com/old/repo"
+	"old.corp/lib/foo"
+	"old.corp/other"
+)
+
+var _, _, _ = repo.X, foo.X, other.X
+`
+	want := `package a
+
+import (
+	"corp.example.com/other"
+	"github.com/new/repo"
+	"new.corp/lib/foo"
+)
+
+var _, _, _ = repo.X, foo.X, other.X
+`
+	got, err := r.RewriteSource("a.go", []byte(src))
+	if err != nil {
+		t.Fatalf("RewriteSource() fails: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRuleRegex(t *testing.T) {
+	r := newRuleRewriter(t,
+		Rule{Source: `^github\.com/old/([a-z]+)-go$`, Dest: "corp.example.com/go/$1", Mode: MatchRegex},
+		Rule{Source: `^old\.corp/(?P<team>[a-z]+)/lib(/.*)?$`, Dest: "new.corp/${team}${2}", Mode: MatchRegex},
+	)
+	runMatchTests(t, r, []matchTest{
+		{path: "github.com/old/yaml-go", want: "corp.example.com/go/yaml"},
+		{path: "github.com/old/yaml-go/sub", want: ""},
+		{path: "github.com/old/Yaml-go", want: ""},
+		{path: "old.corp/infra/lib", want: "new.corp/infra"},
+		{path: "old.corp/infra/lib/x/y", want: "new.corp/infra/x/y"},
+		{path: "old.corp/infra/library", want: ""},
+	})
+
+	if err := NewRewriter().Add(Rule{Source: "old(", Dest: "new", Mode: MatchRegex}); err == nil {
+		t.Errorf("Add() of an invalid regular expression succeeds")
+	}
+}
+
+func TestRuleExact(t *testing.T) {
+	r := newRuleRewriter(t,
+		Rule{Source: "github.com/foo/bar", Dest: "github.com/foo/baz", Mode: MatchExact},
+		Rule{Source: "github.com/foo", Dest: "corp.example.com/foo"},
+	)
+	runMatchTests(t, r, []matchTest{
+		{path: "github.com/foo/bar", want: "github.com/foo/baz"},
+		{path: "github.com/foo/bar/sub", want: "corp.example.com/foo/bar/sub"},
+		{path: "github.com/foo/barbaz", want: "corp.example.com/foo/barbaz"},
+		{path: "github.com/foobar", want: ""},
+	})
+
+	// an exact rule only shadows the same exact rule, and a prefix rule
+	// every rule under its source
+	if err := r.Add(Rule{Source: "github.com/foo/bar", Dest: "x", Mode: MatchExact}); err == nil {
+		t.Errorf("Add() of a rule shadowed by an exact rule succeeds")
+	}
+	if err := r.Add(Rule{Source: "github.com/foo/qux", Dest: "x"}); err == nil {
+		t.Errorf("Add() of a rule shadowed by a prefix rule succeeds")
+	}
+	if err := NewRewriter().Add(Rule{Source: "a", Dest: "b", Mode: "glob"}); err == nil {
+		t.Errorf("Add() of a rule of an unknown mode succeeds")
+	}
+}
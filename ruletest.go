@@ -0,0 +1,87 @@
+package yolk
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RuleTest is a case of the tests of a rules file, checking the import path
+// its rules replace a path with, before they touch any file.
+type RuleTest struct {
+	// Path is the import path given to the rules.
+	Path string `yaml:"path"`
+	// Want is the import path expected, Path itself if empty: the rules
+	// must leave it alone.
+	Want string `yaml:"want"`
+	// File, if not empty, is the path of the file importing Path relative
+	// to the walked directory, for the rules scoped to some files.
+	File string `yaml:"file"`
+}
+
+// RuleTestResult is the outcome of a RuleTest.
+type RuleTestResult struct {
+	RuleTest
+	// Profile is the profile of the test, empty for the tests run against
+	// the rules applied without profile.
+	Profile string
+	// Got is the import path the rules replace Path with, and Rule the
+	// rule replacing it, empty if none does.
+	Got  string
+	Rule string
+}
+
+// Failed reports whether the rules didn't replace the path as expected.
+func (t RuleTestResult) Failed() bool {
+	return t.Got != t.Want
+}
+
+// TestRules runs the tests of the config against its rules, and the tests
+// of every profile against the rules of the config with that profile.
+func (c *Config) TestRules() ([]RuleTestResult, error) {
+	r := NewRewriter()
+	if err := c.Apply(r); err != nil {
+		return nil, err
+	}
+	results, err := r.testRules("", c.Tests)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r := NewRewriter()
+		if err := c.ApplyProfile(r, name); err != nil {
+			return nil, err
+		}
+		res, err := r.testRules(name, c.Profiles[name].Tests)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+	}
+	return results, nil
+}
+
+// testRules runs the tests of the profile against the rules of r.
+func (r *Rewriter) testRules(profile string, tests []RuleTest) ([]RuleTestResult, error) {
+	var results []RuleTestResult
+	for _, t := range tests {
+		if t.Path == "" {
+			return nil, fmt.Errorf("test of the rules without path, want %q", t.Want)
+		}
+		if t.Want == "" {
+			t.Want = t.Path
+		}
+
+		res := RuleTestResult{RuleTest: t, Profile: profile, Got: t.Path}
+		if i, np, ok := r.match(t.File, t.Path); ok {
+			res.Got, res.Rule = np, r.rules[i].String()
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
@@ -0,0 +1,114 @@
+package yolk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// sarifSchema is the schema of the SARIF 2.1.0 logs written by WriteSARIF.
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes the paths rewritten by the run, or to be rewritten by a
+// dry run, as the results of a SARIF 2.1.0 log to w, so code scanning tools
+// can show the stale imports. The files are located relative to root.
+func (s *Summary) WriteSARIF(w io.Writer, root string) error {
+	driver := sarifDriver{
+		Name:           "yolk",
+		InformationURI: "https://github.com/barryz/yolk",
+		Rules:          make([]sarifRule, 0, len(s.Rules)),
+	}
+	for i, rs := range s.Rules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:               sarifRuleID(i),
+			ShortDescription: sarifMessage{Text: rs.Rule.String()},
+		})
+	}
+
+	results := make([]sarifResult, 0, len(s.Edits))
+	for _, e := range s.Edits {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: relPath(root, e.Path)}}
+		if e.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: e.Line, StartColumn: e.Column}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    sarifRuleID(e.Rule),
+			RuleIndex: e.Rule,
+			Level:     "warning",
+			Message:   sarifMessage{Text: fmt.Sprintf("%s path %s should be %s", e.Kind, e.Old, e.New)},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&log)
+}
+
+func sarifRuleID(i int) string {
+	return fmt.Sprintf("yolk%03d", i+1)
+}
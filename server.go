@@ -0,0 +1,450 @@
+package yolk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Statuses of a Job.
+const (
+	JobPlanning    = "planning"
+	JobPlanned     = "planned"
+	JobApplying    = "applying"
+	JobApplied     = "applied"
+	JobRollingBack = "rolling_back"
+	JobRolledBack  = "rolled_back"
+	JobFailed      = "failed"
+)
+
+// Job is a rewrite of a directory run by a Server: it is planned as a dry
+// run first, and only written once applied.
+type Job struct {
+	ID      string   `json:"id"`
+	Dir     string   `json:"dir"`
+	Rules   []Rule   `json:"rules"`
+	Status  string   `json:"status"`
+	Error   string   `json:"error,omitempty"`
+	Summary *Summary `json:"summary,omitempty"`
+
+	patch []byte
+	files []plannedFile
+}
+
+// plannedFile is a file changed by a job, with the checksums of its content
+// when the job was planned and once applied. The content to write is kept
+// until the job is applied, and the content to restore until it is rolled
+// back.
+type plannedFile struct {
+	path   string
+	src    []byte
+	dst    []byte
+	srcSum [sha256.Size]byte
+	dstSum [sha256.Size]byte
+}
+
+// planReporter records the files changed by a job being planned, along
+// with their patch.
+type planReporter struct {
+	PatchReporter
+	files []plannedFile
+}
+
+// Report implements Reporter.
+func (p *planReporter) Report(path string, src, dst []byte) error {
+	p.files = append(p.files, plannedFile{
+		path:   path,
+		src:    src,
+		dst:    dst,
+		srcSum: sha256.Sum256(src),
+		dstSum: sha256.Sum256(dst),
+	})
+	return p.PatchReporter.Report(path, src, dst)
+}
+
+// Server is an HTTP API running rewrite jobs, so migrations can be
+// orchestrated across many repositories by a central service:
+//
+//	POST /jobs                 plans a job given {"dir": ..., "rules": [...]}
+//	GET  /jobs                 lists the jobs
+//	GET  /jobs/{id}            returns a job, along with its summary
+//	GET  /jobs/{id}/diff       returns the patch of a planned job
+//	POST /jobs/{id}/apply      writes the planned job
+//	POST /jobs/{id}/rollback   reverts an applied job
+//
+// Jobs run in the background, their status is polled. A job writes the
+// very files of its patch once applied, failing if any of them changed
+// since it was planned, and only reverts them when rolled back. The
+// requests must carry the token of the server, and those with a body must
+// be JSON, which browsers don't send across sites without asking.
+type Server struct {
+	// NewRewriter returns the rewriter of a job, along with its options and
+	// the rules applied before those of the job. NewRewriter by default.
+	NewRewriter func() *Rewriter
+
+	// Token is the bearer token every request must carry in its
+	// Authorization header.
+	Token string
+
+	// Roots lists the directories which jobs may rewrite, along with their
+	// subdirectories.
+	Roots []string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+	next int
+}
+
+// ListenAndServe serves the API on the TCP network address addr, failing
+// unless the token and the roots of the server are set.
+func (s *Server) ListenAndServe(addr string) error {
+	if err := s.check(); err != nil {
+		return err
+	}
+	return http.ListenAndServe(addr, s)
+}
+
+// check returns an error unless the token and the roots of the server are
+// set, any local process being able to reach the server otherwise.
+func (s *Server) check() error {
+	if s.Token == "" {
+		return errors.New("the server requires a token")
+	}
+	if len(s.Roots) == 0 {
+		return errors.New("the server requires the roots which jobs may rewrite")
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := s.check(); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	auth := []byte(req.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(auth, []byte("Bearer "+s.Token)) != 1 {
+		httpError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+		return
+	}
+	if req.Method == http.MethodPost {
+		if typ, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || typ != "application/json" {
+			httpError(w, http.StatusUnsupportedMediaType, fmt.Errorf("requests must be application/json"))
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		httpError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", req.URL.Path))
+		return
+	}
+
+	if len(parts) == 1 {
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.list())
+		case http.MethodPost:
+			s.create(w, req)
+		default:
+			httpError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s /jobs is not allowed", req.Method))
+		}
+		return
+	}
+
+	job, ok := s.job(parts[1])
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Errorf("unknown job %s", parts[1]))
+		return
+	}
+
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+
+	switch {
+	case action == "" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, job)
+	case action == "diff" && req.Method == http.MethodGet:
+		s.mu.Lock()
+		patch := s.jobs[job.ID].patch
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "text/x-diff")
+		w.Write(patch)
+	case action == "apply" && req.Method == http.MethodPost:
+		s.transition(w, job.ID, JobPlanned, JobApplying, s.apply)
+	case action == "rollback" && req.Method == http.MethodPost:
+		s.transition(w, job.ID, JobApplied, JobRollingBack, s.rollback)
+	default:
+		httpError(w, http.StatusNotFound, fmt.Errorf("unknown action %s %s", req.Method, req.URL.Path))
+	}
+}
+
+// create plans a new job.
+func (s *Server) create(w http.ResponseWriter, req *http.Request) {
+	var job Job
+	if err := json.NewDecoder(req.Body).Decode(&job); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if job.Dir == "" {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("you must specify a directory to handle"))
+		return
+	}
+	if !s.allowed(job.Dir) {
+		httpError(w, http.StatusForbidden, fmt.Errorf("directory %s is outside of the allowed roots", job.Dir))
+		return
+	}
+
+	// the rules are checked before the job is accepted
+	rw, err := s.rewriter(&job)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]*Job)
+	}
+	s.next++
+	job.ID = strconv.Itoa(s.next)
+	job.Status = JobPlanning
+	s.jobs[job.ID] = &job
+	snapshot := job
+	s.mu.Unlock()
+
+	go s.plan(job.ID, rw)
+	writeJSON(w, http.StatusAccepted, &snapshot)
+}
+
+// allowed reports whether jobs may rewrite dir, which lies under one of the
+// roots once their symlinks are resolved.
+func (s *Server) allowed(dir string) bool {
+	real, err := realPath(dir)
+	if err != nil {
+		return false
+	}
+	for _, root := range s.Roots {
+		if r, err := realPath(root); err == nil && hasPathPrefix(filepath.ToSlash(real), filepath.ToSlash(r)) {
+			return true
+		}
+	}
+	return false
+}
+
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// rewriter returns the rewriter of the job, with its rules added.
+func (s *Server) rewriter(job *Job) (*Rewriter, error) {
+	newRewriter := s.NewRewriter
+	if newRewriter == nil {
+		newRewriter = NewRewriter
+	}
+
+	rw := newRewriter()
+	for _, rule := range job.Rules {
+		if err := rw.Add(rule); err != nil {
+			return nil, err
+		}
+	}
+	if len(rw.rules) == 0 {
+		return nil, fmt.Errorf("you must specify the rules of the job")
+	}
+	return rw, nil
+}
+
+// plan runs the job as a dry run, keeping its patch and the files to write.
+func (s *Server) plan(id string, rw *Rewriter) {
+	s.mu.Lock()
+	dir := s.jobs[id].Dir
+	s.mu.Unlock()
+
+	var patch bytes.Buffer
+	rep := &planReporter{PatchReporter: PatchReporter{W: &patch, Root: dir}}
+	rw.DryRun = true
+	rw.Confirm = nil
+	rw.Reporter = rep
+	err := rw.RewriteDir(dir)
+
+	s.finish(id, rw, err, JobPlanned, func(job *Job) {
+		job.patch = patch.Bytes()
+		job.files = rep.files
+	})
+}
+
+// apply writes the files of the job as planned.
+func (s *Server) apply(id string) {
+	s.mu.Lock()
+	job := *s.jobs[id]
+	s.mu.Unlock()
+
+	rw, err := s.rewriter(&job)
+	if err == nil {
+		err = swapFiles(rw, job.files, false)
+	}
+	// only the content to restore is kept
+	s.finish(id, nil, err, JobApplied, func(job *Job) {
+		for i := range job.files {
+			job.files[i].dst = nil
+		}
+	})
+}
+
+// rollback reverts the files written by the job.
+func (s *Server) rollback(id string) {
+	s.mu.Lock()
+	job := *s.jobs[id]
+	s.mu.Unlock()
+
+	rw, err := s.rewriter(&job)
+	if err == nil {
+		err = swapFiles(rw, job.files, true)
+	}
+	s.finish(id, nil, err, JobRolledBack, func(job *Job) {
+		job.files = nil
+	})
+}
+
+// swapFiles writes the planned content of the files of a job, or their old
+// content back when rolling back. Nothing is written unless every file is
+// still the way the job found it, and the files written are restored if a
+// write fails.
+func swapFiles(rw *Rewriter, files []plannedFile, rollback bool) error {
+	type swap struct {
+		path     string
+		from, to []byte
+		perm     os.FileMode
+	}
+
+	swaps := make([]swap, 0, len(files))
+	for _, f := range files {
+		sum, to, stage := f.srcSum, f.dst, "planned"
+		if rollback {
+			sum, to, stage = f.dstSum, f.src, "applied"
+		}
+
+		info, err := rw.fs().Stat(f.path)
+		if err != nil {
+			return err
+		}
+		cur, err := rw.fs().ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		if sha256.Sum256(cur) != sum {
+			return fmt.Errorf("%s changed since the job was %s", f.path, stage)
+		}
+		swaps = append(swaps, swap{path: f.path, from: cur, to: to, perm: info.Mode().Perm()})
+	}
+
+	for i, sw := range swaps {
+		if err := rw.writeFile(sw.path, sw.from, sw.to, sw.perm); err != nil {
+			for _, done := range swaps[:i] {
+				rw.writeFile(done.path, done.to, done.from, done.perm)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// finish records the outcome of a stage of the job.
+func (s *Server) finish(id string, rw *Rewriter, err error, status string, update func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	job.Status = status
+	if update != nil {
+		update(job)
+	}
+	if err != nil {
+		// a failed job goes no further
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.files = nil
+	}
+	if rw != nil {
+		summary := rw.Summary()
+		job.Summary = &summary
+	}
+}
+
+// transition moves the job from status from to to and runs the next stage
+// of the job in the background.
+func (s *Server) transition(w http.ResponseWriter, id, from, to string, stage func(string)) {
+	s.mu.Lock()
+	job := s.jobs[id]
+	if job.Status != from {
+		status := job.Status
+		s.mu.Unlock()
+		httpError(w, http.StatusConflict, fmt.Errorf("job %s is %s, not %s", id, status, from))
+		return
+	}
+	job.Status = to
+	snapshot := *job
+	s.mu.Unlock()
+
+	go stage(id)
+	writeJSON(w, http.StatusAccepted, &snapshot)
+}
+
+// job returns a copy of the job id.
+func (s *Server) job(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// list returns a copy of all jobs, in the order they were created.
+func (s *Server) list() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		a, _ := strconv.Atoi(jobs[i].ID)
+		b, _ := strconv.Atoi(jobs[j].ID)
+		return a < b
+	})
+	return jobs
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
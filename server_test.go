@@ -0,0 +1,187 @@
+package yolk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const serverToken = "secret"
+
+// newTestServer returns a server allowed to rewrite a temporary directory
+// holding a.go, along with that directory.
+func newTestServer(t *testing.T) (*httptest.Server, *Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(oldSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &Server{Token: serverToken, Roots: []string{dir}}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return ts, srv, dir
+}
+
+func serverRequest(t *testing.T, ts *httptest.Server, method, path, contentType, body string) (int, Job) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+serverToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	return resp.StatusCode, job
+}
+
+// waitJob polls the job id until it leaves the transient status.
+func waitJob(t *testing.T, ts *httptest.Server, id, transient string) Job {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		_, job := serverRequest(t, ts, http.MethodGet, "/jobs/"+id, "", "")
+		if job.Status != transient {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s is still %s", id, transient)
+	return Job{}
+}
+
+func jobBody(dir string) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"dir":   dir,
+		"rules": []map[string]string{{"source": "old.corp/lib", "dest": "new.corp/lib"}},
+	})
+	return string(b)
+}
+
+func TestServerRefusedRequests(t *testing.T) {
+	ts, _, dir := newTestServer(t)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/jobs", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /jobs without a token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		dir         string
+		want        int
+	}{
+		{name: "form", contentType: "application/x-www-form-urlencoded", dir: dir, want: http.StatusUnsupportedMediaType},
+		{name: "text", contentType: "text/plain", dir: dir, want: http.StatusUnsupportedMediaType},
+		{name: "no content type", dir: dir, want: http.StatusUnsupportedMediaType},
+		{name: "outside of the roots", contentType: "application/json", dir: filepath.Dir(dir), want: http.StatusForbidden},
+		{name: "allowed", contentType: "application/json; charset=utf-8", dir: dir, want: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := serverRequest(t, ts, http.MethodPost, "/jobs", tt.contentType, jobBody(tt.dir)); code != tt.want {
+				t.Errorf("POST /jobs = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerUnconfigured(t *testing.T) {
+	for name, srv := range map[string]*Server{
+		"no token": {Roots: []string{"."}},
+		"no roots": {Token: serverToken},
+	} {
+		if err := srv.ListenAndServe("localhost:0"); err == nil {
+			t.Errorf("ListenAndServe() with %s succeeds", name)
+		}
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		srv.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("GET /jobs with %s = %d, want %d", name, w.Code, http.StatusInternalServerError)
+		}
+	}
+}
+
+func TestServerJob(t *testing.T) {
+	ts, srv, dir := newTestServer(t)
+	path := filepath.Join(dir, "a.go")
+
+	code, job := serverRequest(t, ts, http.MethodPost, "/jobs", "application/json", jobBody(dir))
+	if code != http.StatusAccepted {
+		t.Fatalf("POST /jobs = %d, want %d", code, http.StatusAccepted)
+	}
+	if job = waitJob(t, ts, job.ID, JobPlanning); job.Status != JobPlanned {
+		t.Fatalf("job is %s (%s), want %s", job.Status, job.Error, JobPlanned)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != oldSource {
+		t.Errorf("a.go is written by the plan of the job")
+	}
+
+	serverRequest(t, ts, http.MethodPost, "/jobs/"+job.ID+"/apply", "application/json", "")
+	if job = waitJob(t, ts, job.ID, JobApplying); job.Status != JobApplied {
+		t.Fatalf("job is %s (%s), want %s", job.Status, job.Error, JobApplied)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != newSource {
+		t.Errorf("a.go =\n%s\nwant\n%s", data, newSource)
+	}
+	srv.mu.Lock()
+	for _, f := range srv.jobs[job.ID].files {
+		if f.dst != nil {
+			t.Errorf("applied job keeps the content written to %s", f.path)
+		}
+	}
+	srv.mu.Unlock()
+
+	serverRequest(t, ts, http.MethodPost, "/jobs/"+job.ID+"/rollback", "application/json", "")
+	if job = waitJob(t, ts, job.ID, JobRollingBack); job.Status != JobRolledBack {
+		t.Fatalf("job is %s (%s), want %s", job.Status, job.Error, JobRolledBack)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != oldSource {
+		t.Errorf("a.go =\n%s\nwant\n%s", data, oldSource)
+	}
+	srv.mu.Lock()
+	if files := srv.jobs[job.ID].files; files != nil {
+		t.Errorf("rolled back job keeps %d files", len(files))
+	}
+	srv.mu.Unlock()
+}
+
+func TestServerJobChangedFile(t *testing.T) {
+	ts, _, dir := newTestServer(t)
+	path := filepath.Join(dir, "a.go")
+
+	_, job := serverRequest(t, ts, http.MethodPost, "/jobs", "application/json", jobBody(dir))
+	waitJob(t, ts, job.ID, JobPlanning)
+	if err := ioutil.WriteFile(path, []byte(otherFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	serverRequest(t, ts, http.MethodPost, "/jobs/"+job.ID+"/apply", "application/json", "")
+	if job = waitJob(t, ts, job.ID, JobApplying); job.Status != JobFailed {
+		t.Errorf("job is %s, want %s", job.Status, JobFailed)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != otherFile {
+		t.Errorf("a.go =\n%s\nwant it unchanged", data)
+	}
+}
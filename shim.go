@@ -0,0 +1,249 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ShimFile is the name of the file of the forwarding packages written by
+// Shim.
+const ShimFile = "shim.go"
+
+// Shim writes a forwarding package at the directory the import path oldPath
+// has in the modules of dir, for the package moved to newPath, so that the
+// code importing oldPath keeps compiling during a gradual migration. The
+// exported API of newPath is loaded with go/types: its types become type
+// aliases, its constants and variables are copied, and its functions are
+// wrapped, each of them documented as deprecated. Generic types and
+// functions can't be forwarded without type parameters, and are left out
+// with a warning. In DryRun mode the package is reported to Reporter
+// instead.
+func (r *Rewriter) Shim(dir, oldPath, newPath string) error {
+	if r.FS != nil {
+		return fmt.Errorf("shims require the files to be on disk, not in FS")
+	}
+	shimDir, ok := r.pathDir(dir, oldPath)
+	if !ok {
+		return fmt.Errorf("%s is not in the modules of %s", oldPath, dir)
+	}
+	if files, _ := filepath.Glob(filepath.Join(shimDir, "*.go")); len(files) > 0 {
+		return fmt.Errorf("%s already holds the golang source files of a package", shimDir)
+	}
+
+	pkg, err := loadTypes(dir, newPath)
+	if err != nil {
+		return err
+	}
+
+	src, skipped, err := shimSource(assumedName(oldPath), pkg, r.LocalPrefixes)
+	if err != nil {
+		return err
+	}
+	for _, name := range skipped {
+		r.Log.Warnf("%s.%s is generic and not forwarded by the shim", newPath, name)
+	}
+
+	path := filepath.Join(shimDir, ShimFile)
+	if r.DryRun {
+		r.Log.Infof("would write %s", path)
+		if r.Reporter != nil {
+			return r.Reporter.Report(path, nil, src)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(shimDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		return err
+	}
+	r.Log.Infof("wrote %s", path)
+	return nil
+}
+
+// loadTypes loads the package path from the modules of dir and type checks
+// it, its dependencies being imported from source.
+func loadTypes(dir, path string) (*types.Package, error) {
+	cfg := &packages.Config{Dir: dir, Mode: packages.NeedName | packages.NeedFiles}
+	pkgs, err := packages.Load(cfg, path)
+	if err != nil {
+		return nil, fmt.Errorf("load package %s fails: %v", path, err)
+	}
+	if len(pkgs) != 1 || len(pkgs[0].GoFiles) == 0 {
+		return nil, fmt.Errorf("package %s is not found", path)
+	}
+	if len(pkgs[0].Errors) > 0 {
+		return nil, fmt.Errorf("load package %s fails: %v", path, pkgs[0].Errors[0])
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range pkgs[0].GoFiles {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Sizes:    types.SizesFor("gc", runtime.GOARCH),
+	}
+	pkg, err := conf.Check(pkgs[0].PkgPath, fset, files, nil)
+	if err != nil {
+		return nil, fmt.Errorf("type check package %s fails: %v", path, err)
+	}
+	return pkg, nil
+}
+
+// shimSource returns the source of the package name forwarding to the
+// exported API of pkg, and the names of the generic declarations left out.
+// Its imports are grouped as goimports does for the local prefixes.
+func shimSource(name string, pkg *types.Package, locals []string) ([]byte, []string, error) {
+	imports := map[*types.Package]string{pkg: pkg.Name()}
+	used := map[string]bool{pkg.Name(): true}
+	qualifier := func(p *types.Package) string {
+		if n, ok := imports[p]; ok {
+			return n
+		}
+		n := p.Name()
+		for i := 2; used[n]; i++ {
+			n = p.Name() + strconv.Itoa(i)
+		}
+		imports[p], used[n] = n, true
+		return n
+	}
+	self := qualifier(pkg)
+	// the generic declarations are told apart without importing the
+	// packages of their types, since they are left out
+	nameOf := func(p *types.Package) string { return p.Name() }
+
+	var (
+		decls   bytes.Buffer
+		skipped []string
+	)
+	scope := pkg.Scope()
+	for _, id := range scope.Names() {
+		obj := scope.Lookup(id)
+		if !obj.Exported() {
+			continue
+		}
+		target := self + "." + id
+
+		var decl string
+		switch obj := obj.(type) {
+		case *types.TypeName:
+			if strings.Contains(types.TypeString(obj.Type(), nameOf), "[") {
+				skipped = append(skipped, id)
+				continue
+			}
+			decl = fmt.Sprintf("// %s is an alias of %s.\n//\n// Deprecated: use %[2]s instead.\ntype %[1]s = %[2]s\n", id, target)
+		case *types.Const:
+			decl = fmt.Sprintf("// %s is %s.\n//\n// Deprecated: use %[2]s instead.\nconst %[1]s = %[2]s\n", id, target)
+		case *types.Var:
+			decl = fmt.Sprintf("// %s is a copy of %s, not updated along with it.\n//\n// Deprecated: use %[2]s instead.\nvar %[1]s = %[2]s\n", id, target)
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+			if strings.HasPrefix(types.TypeString(sig, nameOf), "func[") {
+				skipped = append(skipped, id)
+				continue
+			}
+			decl = fmt.Sprintf("// %s calls %s.\n//\n// Deprecated: use %[2]s instead.\n%s\n", id, target, shimFunc(id, target, sig, qualifier, used))
+		default:
+			continue
+		}
+		decls.WriteString("\n" + decl)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by yolk shim. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "// Package %s forwards to %s, where it moved.\n//\n// Deprecated: use %[2]s instead.\n", name, pkg.Path())
+	fmt.Fprintf(&b, "package %s\n\nimport (\n", name)
+	pkgs := make([]*types.Package, 0, len(imports))
+	for p := range imports {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		ci, cj := importClass(pkgs[i].Path(), locals), importClass(pkgs[j].Path(), locals)
+		if ci != cj {
+			return ci < cj
+		}
+		return pkgs[i].Path() < pkgs[j].Path()
+	})
+	for i, p := range pkgs {
+		if i > 0 && importClass(p.Path(), locals) != importClass(pkgs[i-1].Path(), locals) {
+			b.WriteString("\n")
+		}
+		b.WriteString("\t")
+		if imports[p] != p.Name() {
+			b.WriteString(imports[p] + " ")
+		}
+		b.WriteString(strconv.Quote(p.Path()) + "\n")
+	}
+	b.WriteString(")\n")
+	b.Write(decls.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("format shim of %s fails: %v", pkg.Path(), err)
+	}
+	return src, skipped, nil
+}
+
+// shimFunc returns the declaration of the function id with the signature
+// sig, calling target. Its parameters are renamed when unnamed or named
+// after an imported package.
+func shimFunc(id, target string, sig *types.Signature, qualifier types.Qualifier, imported map[string]bool) string {
+	var results []string
+	for i := 0; i < sig.Results().Len(); i++ {
+		results = append(results, types.TypeString(sig.Results().At(i).Type(), qualifier))
+	}
+
+	params := sig.Params()
+	var decl, args []string
+	for i := 0; i < params.Len(); i++ {
+		v := params.At(i)
+		typ := types.TypeString(v.Type(), qualifier)
+		variadic := sig.Variadic() && i == params.Len()-1
+		if variadic {
+			typ = "..." + types.TypeString(v.Type().(*types.Slice).Elem(), qualifier)
+		}
+
+		// the packages of the types are imported by now
+		name := v.Name()
+		if name == "" || name == "_" || imported[name] {
+			name = "p" + strconv.Itoa(i)
+		}
+		decl = append(decl, name+" "+typ)
+		if variadic {
+			name += "..."
+		}
+		args = append(args, name)
+	}
+
+	s := fmt.Sprintf("func %s(%s)", id, strings.Join(decl, ", "))
+	call := fmt.Sprintf("%s(%s)", target, strings.Join(args, ", "))
+	switch len(results) {
+	case 0:
+		return fmt.Sprintf("%s {\n\t%s\n}", s, call)
+	case 1:
+		return fmt.Sprintf("%s %s {\n\treturn %s\n}", s, results[0], call)
+	default:
+		return fmt.Sprintf("%s (%s) {\n\treturn %s\n}", s, strings.Join(results, ", "), call)
+	}
+}
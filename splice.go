@@ -0,0 +1,393 @@
+package yolk
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// textEdit replaces the bytes [start, end) of a source with text.
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// applyEdits returns src with the non overlapping edits applied.
+func applyEdits(src []byte, edits []textEdit) []byte {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+
+	out := make([]byte, 0, len(src))
+	last := 0
+	for _, e := range edits {
+		out = append(out, src[last:e.start]...)
+		out = append(out, e.text...)
+		last = e.end
+	}
+	return append(out, src[last:]...)
+}
+
+// importDecl is an import declaration of a file, along with the byte
+// range and the imports it had before the file was rewritten.
+type importDecl struct {
+	gen        *ast.GenDecl
+	start, end int
+	specs      string
+	imports    []declImport
+
+	// ownLines tells whether every import of a parenthesized declaration
+	// stands on lines of its own.
+	ownLines bool
+}
+
+// declImport is an import of an importDecl as it was before the file was
+// rewritten, along with the byte range of its lines and of the comment
+// group right above it.
+type declImport struct {
+	spec       *ast.ImportSpec
+	name       string
+	namePos    token.Pos
+	pathValue  string
+	start, end int
+
+	// line is the byte range of the line of the import, and alone tells
+	// whether the line holds nothing else than the import and its
+	// comments, or its whole unparenthesized declaration.
+	line  textEdit
+	alone bool
+}
+
+// importDecls returns the import declarations of file.
+func importDecls(fset *token.FileSet, file *ast.File) []*importDecl {
+	var decls []*importDecl
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		d := &importDecl{
+			gen:   gen,
+			start: fset.Position(gen.Pos()).Offset,
+			end:   fset.Position(gen.End()).Offset,
+			specs: specsOf(gen),
+		}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			di := declImport{spec: imp, pathValue: imp.Path.Value}
+			if imp.Name != nil {
+				di.name, di.namePos = imp.Name.Name, imp.Name.Pos()
+			}
+			di.line, di.alone = specLine(fset, gen, imp)
+			d.imports = append(d.imports, di)
+		}
+		if gen.Lparen.IsValid() {
+			d.ownLines = importLines(fset, file, d)
+		}
+		decls = append(decls, d)
+	}
+	return decls
+}
+
+// importLines sets the line ranges of the imports of the parenthesized
+// declaration d, and reports whether they all stand on lines of their own.
+// The lines of the file change as imports are deleted, they are taken
+// before.
+func importLines(fset *token.FileSet, file *ast.File, d *importDecl) bool {
+	tf := fset.File(d.gen.Pos())
+	lineStart := func(line int) int { return tf.Offset(tf.LineStart(line)) }
+
+	prev := tf.Line(d.gen.Lparen)
+	for i := range d.imports {
+		di := &d.imports[i]
+		line := tf.Line(di.spec.Pos())
+		if line <= prev || tf.Line(di.spec.End()) != line {
+			return false
+		}
+
+		first := line
+		for _, g := range file.Comments {
+			if g.Pos() > d.gen.Lparen && g.End() < di.spec.Pos() && tf.Line(g.End()) == first-1 && tf.Line(g.Pos()) > prev {
+				first = tf.Line(g.Pos())
+			}
+		}
+		di.start, di.end = lineStart(first), lineStart(line+1)
+		prev = line
+	}
+	return len(d.imports) > 0 && prev < tf.Line(d.gen.Rparen)
+}
+
+// specLine returns the byte range of the line of the import spec of gen,
+// and whether it holds no other import nor parenthesis of gen.
+func specLine(fset *token.FileSet, gen *ast.GenDecl, spec *ast.ImportSpec) (textEdit, bool) {
+	tf := fset.File(spec.Pos())
+	line := tf.Line(spec.Pos())
+	r := textEdit{start: tf.Offset(tf.LineStart(line)), end: tf.Size()}
+	if line < tf.LineCount() {
+		r.end = tf.Offset(tf.LineStart(line + 1))
+	}
+
+	if !gen.Lparen.IsValid() {
+		return r, tf.Line(gen.Pos()) == line
+	}
+	alone := tf.Line(gen.Lparen) < line && tf.Line(gen.Rparen) > line
+	for _, other := range gen.Specs {
+		if other != spec && (tf.Line(other.Pos()) == line || tf.Line(other.End()) == line) {
+			alone = false
+		}
+	}
+	return r, alone
+}
+
+// specsOf returns the names and paths of the imports of gen.
+func specsOf(gen *ast.GenDecl) string {
+	var b strings.Builder
+	for _, spec := range gen.Specs {
+		imp := spec.(*ast.ImportSpec)
+		b.WriteString(importName(imp) + " " + imp.Path.Value + "\n")
+	}
+	return b.String()
+}
+
+// formatDecl returns the edit replacing the import declaration d of src
+// with its rewritten imports, formatted on their own, or deleting it if
+// none of its imports are left. Declarations left alone are not edited,
+// nor is any byte around the declarations.
+func (r *Rewriter) formatDecl(path string, fset *token.FileSet, file *ast.File, src []byte, d *importDecl) (textEdit, bool, error) {
+	// the declaration importing cgo is edited in place, as its preamble
+	// must stay right above the import of C
+	if r.MinimalDiff || importsC(d.gen) {
+		e, ok := minimalDecl(fset, src, d)
+		return e, ok, nil
+	}
+
+	kept := false
+	for _, decl := range file.Decls {
+		kept = kept || decl == d.gen
+	}
+	if !kept {
+		// the line of the declaration goes with it
+		end := d.end
+		if end < len(src) && src[end] == '\n' {
+			end++
+		}
+		if end < len(src) && src[end] == '\n' && d.start >= 2 && string(src[d.start-2:d.start]) == "\n\n" {
+			end++
+		}
+		return textEdit{start: d.start, end: end}, true, nil
+	}
+	if specsOf(d.gen) == d.specs {
+		return textEdit{}, false, nil
+	}
+
+	// the names and paths are replaced in place, so that no comment moves,
+	// unless some imports share a line
+	if text, ok := spliceDecl(fset, src, d, r.LocalPrefixes); ok {
+		bs, err := r.formatImports(path, []byte("package p\n\n"+text+"\n"))
+		if err == nil {
+			text, err = importBlock(bs)
+		}
+		if err == nil {
+			return textEdit{start: d.start, end: d.end, text: text}, true, nil
+		}
+	}
+
+	// the declaration is printed alone in a file holding its comments
+	decl := *file
+	decl.Decls = []ast.Decl{d.gen}
+	decl.Comments = nil
+	for _, c := range file.Comments {
+		if c.Pos() >= d.gen.Pos() && c.End() <= d.gen.End() {
+			decl.Comments = append(decl.Comments, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printerMode, Tabwidth: tabWidth}
+	if err := cfg.Fprint(&buf, fset, &decl); err != nil {
+		return textEdit{}, false, err
+	}
+	bs, err := r.formatImports(path, buf.Bytes())
+	if err != nil {
+		return textEdit{}, false, err
+	}
+	block, err := importBlock(bs)
+	if err != nil {
+		return textEdit{}, false, err
+	}
+	return textEdit{start: d.start, end: d.end, text: block}, true, nil
+}
+
+// minimalDecl returns the edit replacing the names and paths of the imports
+// of the declaration d of src in place and deleting the lines of the deleted
+// imports, without touching any other line.
+func minimalDecl(fset *token.FileSet, src []byte, d *importDecl) (textEdit, bool) {
+	kept := make(map[*ast.ImportSpec]bool)
+	for _, spec := range d.gen.Specs {
+		kept[spec.(*ast.ImportSpec)] = true
+	}
+
+	var edits []textEdit
+	for _, di := range d.imports {
+		switch {
+		case kept[di.spec]:
+			edits = append(edits, specEdits(fset, di, 0)...)
+		case di.alone:
+			// the blank line above goes too if no import follows, so that
+			// no blank lines pile up
+			e := textEdit{start: di.line.start, end: di.line.end}
+			next := bytes.TrimLeft(src[e.end:], " \t")
+			if e.start >= 2 && string(src[e.start-2:e.start]) == "\n\n" && (bytes.HasPrefix(next, []byte(")")) || bytes.HasPrefix(next, []byte("\n"))) {
+				e.start--
+			}
+			edits = append(edits, e)
+		default:
+			start := fset.Position(di.spec.Path.Pos()).Offset
+			if di.name != "" {
+				start = fset.Position(di.namePos).Offset
+			}
+			edits = append(edits, textEdit{start: start, end: fset.Position(di.spec.Path.Pos()).Offset + len(di.pathValue)})
+		}
+	}
+	if len(edits) == 0 {
+		return textEdit{}, false
+	}
+
+	// the deleted lines may span more than the declaration
+	start, end := d.start, d.end
+	for _, e := range edits {
+		if e.start < start {
+			start = e.start
+		}
+		if e.end > end {
+			end = e.end
+		}
+	}
+	for i := range edits {
+		edits[i].start -= start
+		edits[i].end -= start
+	}
+	return textEdit{start: start, end: end, text: string(applyEdits(src[start:end], edits))}, true
+}
+
+// spliceDecl returns the text of the declaration d of src with the names and
+// paths of its imports replaced in place, and the deleted imports removed
+// along with their doc comments. The lines of the imports of every group are
+// sorted again in the order of goimports for the local prefixes, each with
+// its doc comment, and split into its groups, so that formatting them moves
+// nothing. It fails
+// if imports were added, or unless every import of a parenthesized
+// declaration stands on lines of its own.
+func spliceDecl(fset *token.FileSet, src []byte, d *importDecl, locals []string) (string, bool) {
+	known := make(map[*ast.ImportSpec]bool)
+	for _, di := range d.imports {
+		known[di.spec] = true
+	}
+	kept := make(map[*ast.ImportSpec]bool)
+	for _, spec := range d.gen.Specs {
+		imp := spec.(*ast.ImportSpec)
+		if !known[imp] {
+			// an added import has no text to splice
+			return "", false
+		}
+		kept[imp] = true
+	}
+
+	if !d.gen.Lparen.IsValid() {
+		if len(d.imports) != 1 || !kept[d.imports[0].spec] {
+			return "", false
+		}
+		return string(applyEdits(src[d.start:d.end], specEdits(fset, d.imports[0], d.start))), true
+	}
+	if !d.ownLines {
+		return "", false
+	}
+
+	var b strings.Builder
+	imports := d.imports
+	b.Write(src[d.start:imports[0].start])
+	for i := 0; i < len(imports); {
+		// a group is made of imports on consecutive lines
+		j := i + 1
+		for j < len(imports) && imports[j].start == imports[j-1].end {
+			j++
+		}
+		group := append([]declImport(nil), imports[i:j]...)
+		sort.SliceStable(group, func(a, b int) bool {
+			pa, pb := importPath(group[a].spec), importPath(group[b].spec)
+			if ca, cb := importClass(pa, locals), importClass(pb, locals); ca != cb {
+				return ca < cb
+			}
+			if pa != pb {
+				return pa < pb
+			}
+			return importName(group[a].spec) < importName(group[b].spec)
+		})
+		class := -1
+		for _, di := range group {
+			if !kept[di.spec] {
+				continue
+			}
+			// as goimports does, the groups are split by a blank line unless
+			// the doc comment of the import already splits them
+			c := importClass(importPath(di.spec), locals)
+			if class >= 0 && c != class && di.start == di.line.start {
+				b.WriteString("\n")
+			}
+			class = c
+			b.Write(applyEdits(src[di.start:di.end], specEdits(fset, di, di.start)))
+		}
+
+		next := d.end
+		if j < len(imports) {
+			next = imports[j].start
+		}
+		b.Write(src[imports[j-1].end:next])
+		i = j
+	}
+	return b.String(), true
+}
+
+// specEdits returns the edits replacing the name and path of the import old
+// with its rewritten ones, relative to the offset base.
+func specEdits(fset *token.FileSet, old declImport, base int) []textEdit {
+	imp := old.spec
+	off := func(pos token.Pos) int { return fset.Position(pos).Offset - base }
+	path, name := off(imp.Path.Pos()), importName(imp)
+	pathEnd := path + len(old.pathValue)
+
+	switch {
+	case name == old.name && imp.Path.Value == old.pathValue:
+		return nil
+	case name == old.name:
+		return []textEdit{{start: path, end: pathEnd, text: imp.Path.Value}}
+	case old.name == "":
+		return []textEdit{{start: path, end: pathEnd, text: name + " " + imp.Path.Value}}
+	case name == "":
+		return []textEdit{{start: off(old.namePos), end: pathEnd, text: imp.Path.Value}}
+	default:
+		return []textEdit{
+			{start: off(old.namePos), end: off(old.namePos) + len(old.name), text: name},
+			{start: path, end: pathEnd, text: imp.Path.Value},
+		}
+	}
+}
+
+// importBlock returns the text of all import declarations of the golang
+// source src.
+func importBlock(src []byte) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+
+	decls := importDecls(fset, file)
+	if len(decls) == 0 {
+		return "", nil
+	}
+	return string(src[decls[0].start:decls[len(decls)-1].end]), nil
+}
@@ -0,0 +1,52 @@
+package yolk
+
+import (
+	"go/parser"
+	"go/token"
+	"sort"
+	"testing"
+)
+
+// TestRewriteSourceComments rewrites the files of testdata/comments, and
+// those of testdata/comments/local with new.corp as a local prefix, checking
+// no comment is lost.
+func TestRewriteSourceComments(t *testing.T) {
+	check := func(t *testing.T, src, got []byte) {
+		if before, after := comments(t, src), comments(t, got); !equalStrings(after, before) {
+			t.Errorf("comments = %q, want %q", after, before)
+		}
+	}
+
+	runGoldenTests(t, "comments", nil, check)
+	runGoldenTests(t, "comments/local", func(r *Rewriter) { r.LocalPrefixes = []string{"new.corp"} }, check)
+}
+
+// comments returns the sorted comments of the golang source src.
+func comments(t *testing.T, src []byte) []string {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var texts []string
+	for _, g := range file.Comments {
+		for _, c := range g.List {
+			texts = append(texts, c.Text)
+		}
+	}
+	sort.Strings(texts)
+	return texts
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package yolk
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// rewriteStrings returns the edits rewriting the string literals of file
+// which hold an import path matched by the rules as a whole, outside of the
+// import declarations. Raw string literals stay raw.
+func (r *Rewriter) rewriteStrings(fset *token.FileSet, file *ast.File) ([]textEdit, []*replacer) {
+	var (
+		edits []textEdit
+		hits  []*replacer
+	)
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.BasicLit:
+			if n.Kind != token.STRING {
+				return true
+			}
+
+			old, err := strconv.Unquote(n.Value)
+			if err != nil {
+				return true
+			}
+
+			rule, np, ok := r.match(fset.File(file.Pos()).Name(), old)
+			if !ok || np == old {
+				return true
+			}
+
+			lit := strconv.Quote(np)
+			if strings.HasPrefix(n.Value, "`") && !strings.Contains(np, "`") {
+				lit = "`" + np + "`"
+			}
+
+			pos := fset.Position(n.Pos())
+			edits = append(edits, textEdit{start: pos.Offset, end: pos.Offset + len(n.Value), text: lit})
+			hits = append(hits, &replacer{oldPath: old, newPath: np, rule: rule, kind: kindString, pos: pos})
+		}
+		return true
+	})
+	return edits, hits
+}
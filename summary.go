@@ -0,0 +1,337 @@
+package yolk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Summary is the statistics of the files handled by a rewriter.
+type Summary struct {
+	FilesScanned int             `json:"files_scanned"`
+	FilesChanged int             `json:"files_changed"`
+	FilesFailed  int             `json:"files_failed"`
+	Rules        []RuleSummary   `json:"rules"`
+	Modules      []ModuleSummary `json:"modules,omitempty"`
+	Skipped      []SkippedFile   `json:"skipped"`
+	Errors       []FailedFile    `json:"errors"`
+	ParseErrors  []FailedFile    `json:"parse_errors,omitempty"`
+	Strings      []StringEdit    `json:"strings,omitempty"`
+	Edits        []PathEdit      `json:"edits,omitempty"`
+	Merges       []PathEdit      `json:"merges,omitempty"`
+	Commands     []ModCommand    `json:"commands,omitempty"`
+}
+
+// PathEdit is a path rewritten in a changed file, located by its line and
+// column if known.
+type PathEdit struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Kind   string `json:"kind"`
+	Rule   int    `json:"rule"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// StringEdit is a string literal rewritten in Strings mode.
+type StringEdit struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// RuleSummary is the number of imports rewritten by a rule.
+type RuleSummary struct {
+	Rule
+	Imports int `json:"imports"`
+}
+
+// SkippedFile is a file or directory which was not rewritten, and the reason
+// why.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// FailedFile is a file which failed to be rewritten, and the error.
+type FailedFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// summary accumulates the statistics behind Summary.
+type summary struct {
+	scanned int
+	changed int
+	imports map[int]int
+	retired []RuleSummary
+	modules map[module]int
+	skipped []SkippedFile
+	errors  []FailedFile
+	parse   []FailedFile
+	strings []StringEdit
+	edits   []PathEdit
+	merges  []PathEdit
+	command []ModCommand
+}
+
+// Summary returns the statistics of all files handled by the rewriter so far.
+func (r *Rewriter) Summary() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Summary{
+		FilesScanned: r.summary.scanned,
+		FilesChanged: r.summary.changed,
+		FilesFailed:  len(r.summary.errors),
+		Rules:        make([]RuleSummary, 0, len(r.rules)),
+		Skipped:      append([]SkippedFile{}, r.summary.skipped...),
+		Errors:       append([]FailedFile{}, r.summary.errors...),
+		ParseErrors:  append([]FailedFile(nil), r.summary.parse...),
+		Strings:      append([]StringEdit(nil), r.summary.strings...),
+		Edits:        append([]PathEdit(nil), r.summary.edits...),
+		Merges:       append([]PathEdit(nil), r.summary.merges...),
+		Modules:      r.moduleSummaries(),
+		Commands:     append([]ModCommand(nil), r.summary.command...),
+	}
+	for i, rule := range r.rules {
+		s.Rules = append(s.Rules, RuleSummary{Rule: rule, Imports: r.summary.imports[i]})
+	}
+	s.Rules = append(s.Rules, r.summary.retired...)
+	return s
+}
+
+func (r *Rewriter) skip(path, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Log.Log(LevelDebug, Event{Event: EventFileSkipped, Path: path, Reason: reason})
+
+	r.summary.skipped = append(r.summary.skipped, SkippedFile{Path: path, Reason: reason})
+}
+
+// fail records the errors found once the files are rewritten, such as a
+// verification failure.
+func (r *Rewriter) fail(errs Errors) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range errs {
+		r.Log.Log(LevelVerbose, Event{Event: EventError, Path: e.Path, Error: e.Err.Error()})
+		r.summary.errors = append(r.summary.errors, FailedFile{Path: e.Path, Error: e.Err.Error()})
+	}
+}
+
+// progress updates the progress of the run, done files out of total.
+func (r *Rewriter) progress(done, total int) {
+	r.mu.Lock()
+	changed := r.summary.changed
+	r.mu.Unlock()
+
+	r.Log.progress(done, total, changed)
+}
+
+// record adds the result of a committed file to the summary.
+func (r *Rewriter) record(res *fileResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if res.skipped == SkipParseError && err == nil {
+		r.Log.Log(LevelVerbose, Event{Event: EventFileSkipped, Path: res.path, Reason: res.skipped + ": " + res.detail})
+		r.summary.parse = append(r.summary.parse, FailedFile{Path: res.path, Error: res.detail})
+		return
+	}
+	if res.skipped != "" && err == nil {
+		r.Log.Log(LevelDebug, Event{Event: EventFileSkipped, Path: res.path, Reason: res.skipped})
+		r.summary.skipped = append(r.summary.skipped, SkippedFile{Path: res.path, Reason: res.skipped})
+		return
+	}
+
+	r.summary.scanned++
+	if err != nil {
+		r.Log.Log(LevelVerbose, Event{Event: EventError, Path: res.path, Error: err.Error()})
+		r.summary.errors = append(r.summary.errors, FailedFile{Path: res.path, Error: err.Error()})
+		return
+	}
+
+	if bytes.Equal(res.src, res.dst) {
+		r.Log.Debugf("unchanged %s", res.path)
+		return
+	}
+
+	if r.Log != nil {
+		ev := Event{Event: EventFileChanged, Path: res.path}
+		for _, rp := range res.replacers {
+			ev.Imports = append(ev.Imports, ImportChange{Rule: r.rules[rp.rule].String(), Old: rp.oldPath, New: rp.newPath})
+		}
+		r.Log.Log(LevelVerbose, ev)
+	}
+	r.summary.changed++
+	if _, m, ok := r.moduleOf(res.path); ok {
+		if r.summary.modules == nil {
+			r.summary.modules = make(map[module]int)
+		}
+		r.summary.modules[m]++
+	}
+	if r.summary.imports == nil {
+		r.summary.imports = make(map[int]int)
+	}
+	locate(res.src, res.replacers)
+	for _, rp := range res.replacers {
+		r.summary.imports[rp.rule]++
+		edit := PathEdit{
+			Path:   res.path,
+			Line:   rp.pos.Line,
+			Column: rp.pos.Column,
+			Kind:   rp.kind,
+			Rule:   rp.rule,
+			Old:    rp.oldPath,
+			New:    rp.newPath,
+		}
+		r.summary.edits = append(r.summary.edits, edit)
+		if rp.merged || rp.dropBlank {
+			r.summary.merges = append(r.summary.merges, edit)
+		}
+		if rp.kind == kindString {
+			r.summary.strings = append(r.summary.strings, StringEdit{
+				Path:   res.path,
+				Line:   rp.pos.Line,
+				Column: rp.pos.Column,
+				Old:    rp.oldPath,
+				New:    rp.newPath,
+			})
+		}
+	}
+}
+
+// locate sets the position of the replacers without one to the first
+// occurrence of their old path in src, following the previous replacer.
+func locate(src []byte, replacers []*replacer) {
+	from := 0
+	for _, rp := range replacers {
+		if rp.pos.Line > 0 {
+			continue
+		}
+
+		i := bytes.Index(src[from:], []byte(rp.oldPath))
+		if i < 0 {
+			from = 0
+			if i = bytes.Index(src, []byte(rp.oldPath)); i < 0 {
+				continue
+			}
+		}
+		off := from + i
+
+		rp.pos.Offset = off
+		rp.pos.Line = bytes.Count(src[:off], []byte("\n")) + 1
+		rp.pos.Column = off - bytes.LastIndexByte(src[:off], '\n')
+		from = off + len(rp.oldPath)
+	}
+}
+
+// UnusedRules returns the rules which matched no path, such as the rules
+// whose source is misspelled.
+func (s *Summary) UnusedRules() []Rule {
+	var unused []Rule
+	for _, rs := range s.Rules {
+		if rs.Imports == 0 {
+			unused = append(unused, rs.Rule)
+		}
+	}
+	return unused
+}
+
+// WriteText writes the summary in a human readable form to w.
+func (s *Summary) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d files scanned, %d files changed, %d files failed\n", s.FilesScanned, s.FilesChanged, s.FilesFailed)
+	for _, rs := range s.Rules {
+		fmt.Fprintf(&buf, "  %s: %d paths rewritten\n", rs.Rule, rs.Imports)
+	}
+	if len(s.Modules) > 0 {
+		fmt.Fprintf(&buf, "%d modules touched:\n", len(s.Modules))
+		for _, m := range s.Modules {
+			fmt.Fprintf(&buf, "  %s (%s): %d files changed\n", m.Dir, m.Path, m.FilesChanged)
+		}
+	}
+	if len(s.Commands) > 0 {
+		fmt.Fprintf(&buf, "%d go commands run:\n", len(s.Commands))
+		for _, c := range s.Commands {
+			status := "ok"
+			if c.Error != "" {
+				status = "failed: " + c.Error
+			}
+			fmt.Fprintf(&buf, "  %s: %s: %s\n", c.Dir, c.Command, status)
+			if c.Output != "" {
+				fmt.Fprintf(&buf, "    %s\n", strings.ReplaceAll(c.Output, "\n", "\n    "))
+			}
+		}
+	}
+	if len(s.Merges) > 0 {
+		fmt.Fprintf(&buf, "%d imports merged with an existing import of their new path:\n", len(s.Merges))
+		for _, m := range s.Merges {
+			fmt.Fprintf(&buf, "  %s:%d: %s => %s\n", m.Path, m.Line, m.Old, m.New)
+		}
+	}
+	if len(s.Strings) > 0 {
+		fmt.Fprintf(&buf, "%d string literals rewritten:\n", len(s.Strings))
+		for _, se := range s.Strings {
+			fmt.Fprintf(&buf, "  %s:%d:%d: %q => %q\n", se.Path, se.Line, se.Column, se.Old, se.New)
+		}
+	}
+	if len(s.Skipped) > 0 {
+		fmt.Fprintf(&buf, "%d paths skipped:\n", len(s.Skipped))
+		for _, sk := range s.Skipped {
+			fmt.Fprintf(&buf, "  %s: %s\n", sk.Path, sk.Reason)
+		}
+	}
+	if len(s.ParseErrors) > 0 {
+		fmt.Fprintf(&buf, "%d files skipped (parse error):\n", len(s.ParseErrors))
+		for _, pe := range s.ParseErrors {
+			fmt.Fprintf(&buf, "  %s: %s\n", pe.Path, pe.Error)
+		}
+	}
+	if len(s.Errors) > 0 {
+		fmt.Fprintf(&buf, "%d files failed:\n", len(s.Errors))
+		for _, fe := range s.Errors {
+			fmt.Fprintf(&buf, "  %s: %s\n", fe.Path, fe.Error)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteEdits writes the paths rewritten, or to be in DryRun mode, grouped
+// by rule, each one located as file:line:column, as an inventory of the
+// stale paths.
+func (s *Summary) WriteEdits(w io.Writer) error {
+	var buf bytes.Buffer
+	for i, rs := range s.Rules {
+		var edits []PathEdit
+		for _, e := range s.Edits {
+			if e.Rule == i {
+				edits = append(edits, e)
+			}
+		}
+		fmt.Fprintf(&buf, "%s: %d paths\n", rs.Rule, len(edits))
+		for _, e := range edits {
+			fmt.Fprintf(&buf, "  %s:%d:%d: %s: %s => %s\n", e.Path, e.Line, e.Column, e.Kind, e.Old, e.New)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteJSON writes the summary as an indented JSON object to w.
+func (s *Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,213 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// kindSymbol is the kind of the replacers of the qualified identifiers moved
+// to another package by symbol rules, whose paths are followed by the name
+// of the identifier, as in corp/util.TrimX.
+const kindSymbol = "symbol"
+
+// validateSymbol checks a symbol rule, whose source and destination are the
+// exact paths of the packages the symbol moves between, the same package if
+// it is only renamed.
+func (r *Rule) validateSymbol() error {
+	if r.Rename != "" && r.Dest == "" {
+		// the symbol is renamed within its package
+		r.Dest = r.Source
+	}
+
+	switch {
+	case !isExportedName(r.Symbol):
+		return fmt.Errorf("invalid symbol %q of rule %s, want an exported identifier", r.Symbol, r.Source)
+	case r.Rename != "" && !isExportedName(r.Rename):
+		return fmt.Errorf("invalid new name %q of symbol %s, want an exported identifier", r.Rename, r.Symbol)
+	case r.Source == "" || r.Dest == "":
+		return fmt.Errorf("symbol rule %s must have a source and a destination", r.Symbol)
+	case r.Transform != "" || r.Alias != "":
+		return fmt.Errorf("symbol rule %s can't have a transform or alias", r)
+	case r.Mode != "" && r.Mode != MatchExact:
+		return fmt.Errorf("symbol rule %s only matches exact paths", r)
+	}
+	r.Mode = MatchExact
+	return nil
+}
+
+// newSymbol returns the name of the symbol moved by the rule in its new
+// package.
+func (r *Rule) newSymbol() string {
+	if r.Rename != "" {
+		return r.Rename
+	}
+	return r.Symbol
+}
+
+func isExportedName(name string) bool {
+	return token.IsIdentifier(name) && token.IsExported(name)
+}
+
+// symbolMoves are the changes of the imports of a file whose symbols are
+// moved by symbol rules: the imports no longer used once their symbols are
+// moved, and the imports of the packages the symbols move to.
+type symbolMoves struct {
+	drop []*ast.ImportSpec
+	add  []newImport
+}
+
+// newImport is an import added to a file, unnamed if name is empty.
+type newImport struct {
+	name string
+	path string
+}
+
+// moveSymbols renames the qualifiers of the identifiers of the golang source
+// file moved to another package by the symbol rules to the name of the
+// import of that package, added unless the file imports it already, and the
+// identifiers renamed by the rules. The name of the package is resolved
+// like goimports does, through the modules walked and the module graph. The
+// imports whose identifiers all moved are dropped. A symbol is not moved if
+// the name of its new package is in use in the file for something else. The
+// returned edits apply the renames to the source, and the replacers list
+// the moved identifiers.
+func (r *Rewriter) moveSymbols(fset *token.FileSet, path string, file *ast.File) ([]textEdit, []*replacer, symbolMoves) {
+	if !r.hasSymbolRules() {
+		return nil, nil, symbolMoves{}
+	}
+
+	var (
+		edits  []textEdit
+		hits   []*replacer
+		moves  symbolMoves
+		rel    string
+		names  = make(map[string]string)
+		warned = make(map[string]bool)
+	)
+
+	// qualifier returns the name the package dest is referred to by in the
+	// file, importing it if needed, or false if the name is taken
+	qualifier := func(dest string) (string, bool) {
+		if name, ok := names[dest]; ok {
+			return name, name != ""
+		}
+		if imp := findImport(file, dest); imp != nil && importName(imp) != "_" && importName(imp) != "." {
+			names[dest] = importName(imp)
+			if names[dest] == "" {
+				names[dest] = r.packageName(path, dest)
+			}
+			return names[dest], true
+		}
+
+		name := r.packageName(path, dest)
+		for _, other := range names {
+			if other == name {
+				name = ""
+			}
+		}
+		if name != "" && nameInUse(file, name) {
+			name = ""
+		}
+		if names[dest] = name; name != "" {
+			// the import is named when its path doesn't tell the name
+			imp := newImport{path: dest}
+			if name != assumedName(dest) {
+				imp.name = name
+			}
+			moves.add = append(moves.add, imp)
+		}
+		return name, name != ""
+	}
+
+	for _, imp := range file.Imports {
+		name, impPath := importName(imp), importPath(imp)
+		if name == "_" || name == "." || impPath == cgoPath {
+			continue
+		}
+		if name == "" {
+			name = assumedName(impPath)
+		}
+
+		// the symbols moving to the path the import is rewritten to keep
+		// its qualifier
+		rewrittenTo := ""
+		if _, np, ok := r.match(path, impPath); ok {
+			rewrittenTo = np
+		}
+
+		moved := false
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			id, ok := sel.X.(*ast.Ident)
+			if !ok || id.Name != name || id.Obj != nil {
+				return true
+			}
+			i, ok := r.symbolRule(path, impPath, sel.Sel.Name, &rel)
+			if !ok {
+				return true
+			}
+
+			dest, qual := r.rules[i].Dest, id.Name
+			if dest != rewrittenTo {
+				qual, ok = qualifier(dest)
+			}
+			if !ok {
+				if !warned[dest] {
+					r.Log.Warnf("%s: symbols of %s are not moved to %s, whose name is already in use", fset.Position(sel.Pos()), impPath, dest)
+					warned[dest] = true
+				}
+				return true
+			}
+
+			if qual != id.Name {
+				off := fset.Position(id.Pos()).Offset
+				edits = append(edits, textEdit{start: off, end: off + len(id.Name), text: qual})
+				id.Name, moved = qual, true
+			}
+			if symbol := r.rules[i].newSymbol(); symbol != sel.Sel.Name {
+				off := fset.Position(sel.Sel.Pos()).Offset
+				edits = append(edits, textEdit{start: off, end: off + len(sel.Sel.Name), text: symbol})
+			}
+			hits = append(hits, &replacer{
+				oldPath: impPath + "." + sel.Sel.Name,
+				newPath: dest + "." + r.rules[i].newSymbol(),
+				rule:    i,
+				kind:    kindSymbol,
+				pos:     fset.Position(sel.Pos()),
+			})
+			sel.Sel.Name = r.rules[i].newSymbol()
+			return true
+		})
+
+		if moved && !qualifierUsed(file, name) {
+			moves.drop = append(moves.drop, imp)
+		}
+	}
+	return edits, hits, moves
+}
+
+// hasSymbolRules reports whether some rules move symbols.
+func (r *Rewriter) hasSymbolRules() bool {
+	for i := range r.rules {
+		if r.rules[i].Symbol != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// symbolRule returns the index of the first symbol rule moving the symbol of
+// the package impPath in the file.
+func (r *Rewriter) symbolRule(file, impPath, symbol string, rel *string) (int, bool) {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Symbol == symbol && rule.Source == impPath && r.appliesTo(rule, file, rel) {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -0,0 +1,150 @@
+package yolk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSymbolRule(t *testing.T) {
+	move := Rule{Source: "corp.example.com/util", Dest: "corp.example.com/strutil", Symbol: "TrimX"}
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		src   string
+		want  string
+	}{
+		{
+			name:  "moved",
+			rules: []Rule{move},
+			src: `package a
+
+import "corp.example.com/util"
+
+var _ = util.TrimX
+var _ = util.Other
+`,
+			want: `package a
+
+import (
+	"corp.example.com/strutil"
+	"corp.example.com/util"
+)
+
+var _ = strutil.TrimX
+var _ = util.Other
+`,
+		},
+		{
+			name:  "all moved",
+			rules: []Rule{move},
+			src: `package a
+
+import (
+	"fmt"
+
+	"corp.example.com/util"
+)
+
+func f() { fmt.Println(util.TrimX("x")) }
+`,
+			want: `package a
+
+import (
+	"fmt"
+
+	"corp.example.com/strutil"
+)
+
+func f() { fmt.Println(strutil.TrimX("x")) }
+`,
+		},
+		{
+			name:  "already imported",
+			rules: []Rule{move},
+			src: `package a
+
+import (
+	su "corp.example.com/strutil"
+	"corp.example.com/util"
+)
+
+var _ = util.TrimX
+var _ = su.TrimY
+`,
+			want: `package a
+
+import (
+	su "corp.example.com/strutil"
+)
+
+var _ = su.TrimX
+var _ = su.TrimY
+`,
+		},
+		{
+			name:  "renamed",
+			rules: []Rule{{Source: "old/http", Symbol: "Client", Rename: "Transport"}},
+			src: `package a
+
+import "old/http"
+
+var c http.Client
+`,
+			want: `package a
+
+import "old/http"
+
+var c http.Transport
+`,
+		},
+		{
+			name:  "name in use",
+			rules: []Rule{move},
+			src: `package a
+
+import "corp.example.com/util"
+
+func f(strutil string) string { return util.TrimX(strutil) }
+`,
+			want: `package a
+
+import "corp.example.com/util"
+
+func f(strutil string) string { return util.TrimX(strutil) }
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRuleRewriter(t, tt.rules...)
+			got, err := r.RewriteSource("a.go", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{Source: "corp.example.com/util", Dest: "corp.example.com/strutil", Symbol: "trimX"}, "exported identifier"},
+		{Rule{Source: "corp.example.com/util", Symbol: "TrimX", Rename: "trim"}, "exported identifier"},
+		{Rule{Source: "corp.example.com/util", Symbol: "TrimX"}, "source and a destination"},
+		{Rule{Source: "corp.example.com/util", Dest: "corp.example.com/strutil", Symbol: "TrimX", Mode: MatchPrefix}, "exact paths"},
+	}
+
+	for _, tt := range tests {
+		err := NewRewriter().Add(tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Add(%s) fails with %v, want an error about %q", tt.rule, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package yolk
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SkipSymlink is the reason why the symlinks met by RewriteDir are skipped
+// when FollowSymlinks is off.
+const SkipSymlink = "symlink not followed"
+
+// walker walks a directory as filepath.Walk does, following the symlinks
+// if the rewriter is told to.
+type walker struct {
+	r    *Rewriter
+	fn   filepath.WalkFunc
+	skip func(path, reason string)
+
+	// seen maps the real paths walked so far to the path they were walked
+	// under, so neither a symlink cycle nor a file reached twice is walked
+	// more than once.
+	seen map[string]string
+}
+
+// walk walks the file tree rooted at root, calling fn for every file and
+// directory in lexical order. Unless FollowSymlinks is set, the symlinks to
+// directories and handled files are skipped and recorded in the summary.
+func (r *Rewriter) walk(root string, fn filepath.WalkFunc) error {
+	return r.walkTree(root, fn, r.skip)
+}
+
+// walkTree walks root as walk does, calling skip, if not nil, for every
+// path which is not walked.
+func (r *Rewriter) walkTree(root string, fn filepath.WalkFunc, skip func(path, reason string)) error {
+	if skip == nil {
+		skip = func(string, string) {}
+	}
+	w := &walker{r: r, fn: fn, skip: skip, seen: make(map[string]string)}
+
+	// the root itself is always followed
+	info, err := r.fs().Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, info)
+	}
+
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (w *walker) walk(path string, info os.FileInfo) error {
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := w.r.fs().Stat(path)
+		if err != nil {
+			w.skip(path, "broken symlink")
+			return nil
+		}
+
+		if !w.r.FollowSymlinks {
+			if _, ok := w.r.handlerFor(path); ok || target.IsDir() {
+				w.skip(path, SkipSymlink)
+			}
+			return nil
+		}
+		info = target
+	}
+
+	if w.r.FollowSymlinks {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			if first, ok := w.seen[real]; ok {
+				w.skip(path, "already walked as "+first)
+				return nil
+			}
+			w.seen[real] = path
+		}
+	}
+
+	err := w.fn(path, info, nil)
+	if !info.IsDir() || err != nil {
+		if err == filepath.SkipDir && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	names, err := w.r.fs().ReadDir(path)
+	if err != nil {
+		if err := w.fn(path, info, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		info, err := w.r.fs().Lstat(child)
+		if err != nil {
+			err = w.fn(child, nil, err)
+		} else {
+			err = w.walk(child, info)
+		}
+
+		if err == filepath.SkipDir {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package yolk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathTemplate is the source of a prefix or exact rule holding placeholders
+// such as {pkg}, each one matching the text of a single path element, which
+// are resolved in the destination of the rule for every import path.
+type pathTemplate struct {
+	re    *regexp.Regexp
+	names []string
+}
+
+// templatePart is a piece of a path template: a literal text, or the name
+// of a placeholder.
+type templatePart struct {
+	lit  string
+	name string
+}
+
+// parsePlaceholders splits s into its literal texts and {name} placeholders.
+func parsePlaceholders(s string) ([]templatePart, error) {
+	var parts []templatePart
+	for s != "" {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			parts = append(parts, templatePart{lit: s})
+			break
+		}
+		if i > 0 {
+			parts = append(parts, templatePart{lit: s[:i]})
+		}
+
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in %s", s[i:])
+		}
+		name := s[i+1 : i+j]
+		if !isPlaceholderName(name) {
+			return nil, fmt.Errorf("invalid placeholder {%s}", name)
+		}
+		parts = append(parts, templatePart{name: name})
+		s = s[i+j+1:]
+	}
+	return parts, nil
+}
+
+// isPlaceholderName reports whether name is a valid placeholder name, made
+// of letters, digits and underscores.
+func isPlaceholderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// compileTemplate returns the template of the source of a rule, or nil if
+// the source holds no placeholder. Every placeholder referenced by dest must
+// be defined by the source.
+func compileTemplate(source, dest string, mode MatchMode) (*pathTemplate, error) {
+	parts, err := parsePlaceholders(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		expr    strings.Builder
+		names   []string
+		defined = make(map[string]bool)
+	)
+	expr.WriteString("^")
+	for _, p := range parts {
+		if p.name == "" {
+			expr.WriteString(regexp.QuoteMeta(p.lit))
+			continue
+		}
+		if defined[p.name] {
+			return nil, fmt.Errorf("placeholder {%s} defined twice", p.name)
+		}
+		defined[p.name] = true
+		names = append(names, p.name)
+		expr.WriteString("([^/]+)")
+	}
+
+	dparts, err := parsePlaceholders(dest)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range dparts {
+		if p.name != "" && !defined[p.name] {
+			return nil, fmt.Errorf("placeholder {%s} of %s is not defined by %s", p.name, dest, source)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// the rest of the import path is kept as a prefix rule does
+	switch {
+	case mode == MatchExact:
+		expr.WriteString("()$")
+	case strings.HasSuffix(source, "/"):
+		expr.WriteString("(.*)$")
+	default:
+		expr.WriteString("(/.*)?$")
+	}
+
+	return &pathTemplate{re: regexp.MustCompile(expr.String()), names: names}, nil
+}
+
+// apply returns the import path replaced by dest, with the placeholders
+// resolved to the text they match in path, and whether path matches at all.
+func (t *pathTemplate) apply(path, dest string) (string, bool) {
+	m := t.re.FindStringSubmatch(path)
+	if m == nil {
+		return "", false
+	}
+
+	values := make(map[string]string, len(t.names))
+	for i, name := range t.names {
+		values[name] = m[i+1]
+	}
+
+	// dest was parsed once the rule was validated already
+	parts, _ := parsePlaceholders(dest)
+	var b strings.Builder
+	for _, p := range parts {
+		if p.name == "" {
+			b.WriteString(p.lit)
+		} else {
+			b.WriteString(values[p.name])
+		}
+	}
+	b.WriteString(m[len(m)-1])
+	return b.String(), true
+}
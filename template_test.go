@@ -0,0 +1,74 @@
+package yolk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleTemplate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		tests []matchTest
+	}{
+		{
+			name: "prefix",
+			rule: Rule{Source: "corp/libs/{pkg}", Dest: "corp.example.com/go-{pkg}/v2"},
+			tests: []matchTest{
+				{"corp/libs/yaml", "corp.example.com/go-yaml/v2"},
+				{"corp/libs/yaml/decode", "corp.example.com/go-yaml/v2/decode"},
+				{"corp/libs", ""},
+				{"corp/libsx/yaml", ""},
+			},
+		},
+		{
+			name: "several placeholders",
+			rule: Rule{Source: "corp/{team}/{pkg}", Dest: "corp.example.com/{pkg}/{team}"},
+			tests: []matchTest{
+				{"corp/infra/log", "corp.example.com/log/infra"},
+				{"corp/infra/log/sink", "corp.example.com/log/infra/sink"},
+			},
+		},
+		{
+			name: "exact",
+			rule: Rule{Source: "corp/libs/{pkg}", Dest: "corp.example.com/{pkg}", Mode: MatchExact},
+			tests: []matchTest{
+				{"corp/libs/yaml", "corp.example.com/yaml"},
+				{"corp/libs/yaml/decode", ""},
+			},
+		},
+		{
+			name: "unused placeholder",
+			rule: Rule{Source: "corp/{team}/log", Dest: "corp.example.com/log"},
+			tests: []matchTest{
+				{"corp/infra/log", "corp.example.com/log"},
+				{"corp/infra/log/sink", "corp.example.com/log/sink"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runMatchTests(t, newRuleRewriter(t, tt.rule), tt.tests)
+		})
+	}
+}
+
+func TestRuleTemplateErrors(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{Source: "corp/{pkg", Dest: "new.corp/lib"}, "unterminated"},
+		{Rule{Source: "corp/{pkg-name}", Dest: "new.corp/lib"}, "invalid placeholder"},
+		{Rule{Source: "corp/{pkg}/{pkg}", Dest: "new.corp/{pkg}"}, "defined twice"},
+		{Rule{Source: "corp/{pkg}", Dest: "new.corp/{name}"}, "not defined"},
+	}
+
+	for _, tt := range tests {
+		err := NewRewriter().Add(tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Add(%s) fails with %v, want an error about %q", tt.rule, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package yolk
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Policies of Testdata.
+const (
+	TestdataRewrite = "rewrite"
+	TestdataSkip    = "skip"
+)
+
+// inTestdata reports whether path is under a testdata directory, which the
+// go tool ignores.
+func inTestdata(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if elem == "testdata" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTestdata checks the policy of Testdata.
+func (r *Rewriter) validateTestdata() error {
+	switch r.Testdata {
+	case "", TestdataRewrite, TestdataSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown testdata policy %q, want %s or %s", r.Testdata, TestdataRewrite, TestdataSkip)
+}
@@ -0,0 +1,12 @@
+//go:build linux && !cgo
+// +build linux,!cgo
+
+package a
+
+import (
+	"fmt"
+
+	"old.corp/lib/foo"
+)
+
+var _, _ = fmt.Println, foo.X
@@ -0,0 +1,11 @@
+//go:build ignore
+
+// The generator of the tables, run by go generate.
+package main
+
+import (
+	"old.corp/lib/gen"
+	"old.corp/lib/tables"
+)
+
+func main() { gen.Write(tables.All) }
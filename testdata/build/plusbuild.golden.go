@@ -0,0 +1,11 @@
+// Copyright 2020 The Authors.
+
+// +build integration
+// +build !windows
+
+// Package a is only built for the integration tests.
+package a
+
+import "new.corp/lib/foo"
+
+var _ = foo.X
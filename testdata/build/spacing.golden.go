@@ -0,0 +1,9 @@
+//go:build (linux||darwin)&&   amd64
+//+build linux darwin
+// +build    amd64
+
+package a
+
+import "new.corp/lib/foo"
+
+var _ = foo.X
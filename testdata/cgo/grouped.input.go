@@ -0,0 +1,14 @@
+package a
+
+import (
+	"old.corp/lib/zz"
+	"fmt"
+	// #include <stdlib.h>
+	"C"
+	"old.corp/lib/aa" // trailing
+)
+
+func Size() int {
+	fmt.Println(zz.X, aa.X)
+	return int(C.size_t(1))
+}
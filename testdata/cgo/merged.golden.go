@@ -0,0 +1,14 @@
+package a
+
+// #cgo LDFLAGS: -lm
+// #include <math.h>
+import "C"
+
+import (
+	"new.corp/lib/foo"
+)
+
+func Sqrt(x float64) float64 {
+	_ = foo.X
+	return float64(C.sqrt(C.double(x))) + foo.Y
+}
@@ -0,0 +1,21 @@
+package a
+
+/*
+#include <stdio.h>
+#include <stdlib.h>
+
+static void hello(void) { printf("hello\n"); }
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"new.corp/lib/foo"
+)
+
+func Hello() {
+	p := C.CString(foo.Name)
+	defer C.free(unsafe.Pointer(p))
+	C.hello()
+}
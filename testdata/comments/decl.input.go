@@ -0,0 +1,13 @@
+package a
+
+// The imports of the package.
+import (
+	/* standard library */
+	"fmt"
+
+	// corp libraries, moving to new.corp
+	"old.corp/lib/bar" /* bar */
+	"old.corp/lib/foo"
+) // end of the imports
+
+var _, _, _ = fmt.Println, bar.X, foo.X
@@ -0,0 +1,11 @@
+package a
+
+import (
+	"fmt"
+
+	"github.com/bar/bar"
+	//nolint:depguard
+	"new.corp/lib/foo"
+)
+
+var _, _, _ = fmt.Println, foo.X, bar.X
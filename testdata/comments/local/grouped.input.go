@@ -0,0 +1,10 @@
+package a
+
+import (
+	"fmt"
+	//nolint:depguard
+	"old.corp/lib/foo"
+	"github.com/bar/bar"
+)
+
+var _, _, _ = fmt.Println, foo.X, bar.X
@@ -0,0 +1,10 @@
+package a
+
+import (
+	// doc for fmt
+	"fmt" // fmt trailing
+	// doc for foo
+	"new.corp/lib/foo" // trailing
+)
+
+var _, _ = fmt.Println, foo.X
@@ -0,0 +1,10 @@
+package a
+
+import (
+	// doc for foo
+	"old.corp/lib/foo" // trailing
+	// doc for fmt
+	"fmt" // fmt trailing
+)
+
+var _, _ = fmt.Println, foo.X
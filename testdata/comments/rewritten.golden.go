@@ -0,0 +1,9 @@
+package a
+
+import (
+	"fmt"
+	// doc for foo
+	"new.corp/lib/foo" // trailing
+)
+
+var _, _ = fmt.Println, foo.X
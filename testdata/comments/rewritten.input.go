@@ -0,0 +1,9 @@
+package a
+
+import (
+	"fmt"
+	// doc for foo
+	"old.corp/lib/foo" // trailing
+)
+
+var _, _ = fmt.Println, foo.X
@@ -0,0 +1,9 @@
+package a
+
+import (
+	"fmt"
+
+	"new.corp/lib/foo" // trailing
+)
+
+var _, _ = fmt.Println, foo.X
@@ -0,0 +1,8 @@
+package a
+
+import (
+	"old.corp/lib/foo" // trailing
+	"fmt"
+)
+
+var _, _ = fmt.Println, foo.X
@@ -0,0 +1,12 @@
+package a
+
+import (
+	"fmt"
+	"os"
+
+	// doc for errgroup
+	"golang.org/x/sync/errgroup"
+	"new.corp/lib/foo" // trailing
+)
+
+var _, _, _, _ = fmt.Println, errgroup.Group{}, foo.X, os.Exit
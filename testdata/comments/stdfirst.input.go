@@ -0,0 +1,11 @@
+package a
+
+import (
+	"fmt"
+	// doc for errgroup
+	"golang.org/x/sync/errgroup"
+	"old.corp/lib/foo" // trailing
+	"os"
+)
+
+var _, _, _, _ = fmt.Println, errgroup.Group{}, foo.X, os.Exit
@@ -0,0 +1,35 @@
+package yolk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies of Tests.
+const (
+	TestsInclude = "include"
+	TestsOnly    = "only"
+	TestsSkip    = "skip"
+)
+
+// validateTests checks the policy of Tests.
+func (r *Rewriter) validateTests() error {
+	switch r.Tests {
+	case "", TestsInclude, TestsOnly, TestsSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown tests policy %q, want %s, %s or %s", r.Tests, TestsInclude, TestsOnly, TestsSkip)
+}
+
+// testsSkipReason returns the reason why the file named filename is skipped
+// by the policy of Tests, if it is.
+func (r *Rewriter) testsSkipReason(filename string) string {
+	isTest := strings.HasSuffix(filename, "_test.go")
+	switch {
+	case r.Tests == TestsOnly && !isTest:
+		return "not a test file"
+	case r.Tests == TestsSkip && isTest:
+		return "test file"
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package yolk
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// transform is a built-in rule rewriting the import paths following a
+// common path convention, and the name of the transform undoing it.
+type transform struct {
+	apply   func(path string) (string, bool)
+	reverse string
+}
+
+// transforms are the built-in transforms selected by the Transform of a
+// rule.
+var transforms = map[string]transform{
+	// gopkg.in/yaml.v1 => github.com/go-yaml/yaml
+	// gopkg.in/user/pkg.v3 => github.com/user/pkg/v3
+	"gopkg.in-to-github": {apply: gopkgInToGithub, reverse: "github-to-gopkg.in"},
+	// github.com/go-yaml/yaml => gopkg.in/yaml.v1
+	// github.com/go-yaml/yaml/v3 => gopkg.in/yaml.v3
+	"github-to-gopkg.in": {apply: githubToGopkgIn, reverse: "gopkg.in-to-github"},
+}
+
+// Transforms returns the names of the built-in transforms.
+func Transforms() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gopkgInToGithub returns the github.com path of a gopkg.in path: the
+// gopkg.in/pkg.vN packages live in the github.com/go-pkg/pkg repository,
+// and gopkg.in/user/pkg.vN in github.com/user/pkg. Major versions from v2
+// are kept as a /vN suffix.
+func gopkgInToGithub(path string) (string, bool) {
+	if !strings.HasPrefix(path, "gopkg.in/") {
+		return "", false
+	}
+
+	elems := strings.SplitN(strings.TrimPrefix(path, "gopkg.in/"), "/", 3)
+	user, i := "", 0
+	if !strings.Contains(elems[0], ".v") {
+		if len(elems) < 2 {
+			return "", false
+		}
+		user, i = elems[0], 1
+	}
+
+	name, major, ok := splitGopkgIn(elems[i])
+	if !ok {
+		return "", false
+	}
+	if user == "" {
+		user = "go-" + name
+	}
+
+	np := "github.com/" + user + "/" + name
+	if major >= 2 {
+		np += "/v" + strconv.Itoa(major)
+	}
+	if rest := elems[i+1:]; len(rest) > 0 {
+		np += "/" + strings.Join(rest, "/")
+	}
+	return np, true
+}
+
+// githubToGopkgIn returns the gopkg.in path of a github.com/go-pkg/pkg
+// path, with the major version of its /vN suffix, v1 without one. Other
+// repositories are not matched, gopkg.in/user/pkg.vN can't be told from
+// any github.com/user/pkg repository.
+func githubToGopkgIn(path string) (string, bool) {
+	if !strings.HasPrefix(path, "github.com/go-") {
+		return "", false
+	}
+
+	elems := strings.Split(strings.TrimPrefix(path, "github.com/"), "/")
+	if len(elems) < 2 || elems[0] != "go-"+elems[1] {
+		return "", false
+	}
+
+	major, rest := "v1", elems[2:]
+	if len(rest) > 0 && isMajorVersion(rest[0]) {
+		major, rest = rest[0], rest[1:]
+	}
+
+	np := "gopkg.in/" + elems[1] + "." + major
+	if len(rest) > 0 {
+		np += "/" + strings.Join(rest, "/")
+	}
+	return np, true
+}
+
+// splitGopkgIn splits a pkg.vN path element of gopkg.in into its package
+// name and major version.
+func splitGopkgIn(elem string) (string, int, bool) {
+	i := strings.LastIndex(elem, ".v")
+	if i <= 0 {
+		return "", 0, false
+	}
+	major, err := strconv.Atoi(elem[i+2:])
+	if err != nil || major < 0 || strconv.Itoa(major) != elem[i+2:] {
+		return "", 0, false
+	}
+	return elem[:i], major, true
+}
+
+// validateTransform checks that the transform of the rule exists and that
+// no source or destination is given along with it.
+func (r *Rule) validateTransform() error {
+	if _, ok := transforms[r.Transform]; !ok {
+		return fmt.Errorf("unknown transform %q, want one of %s", r.Transform, strings.Join(Transforms(), ", "))
+	}
+	if r.Source != "" || r.Dest != "" {
+		return fmt.Errorf("transform %s can't have a source or destination", r.Transform)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package yolk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleTransform(t *testing.T) {
+	tests := []struct {
+		transform string
+		tests     []matchTest
+	}{
+		{
+			transform: "gopkg.in-to-github",
+			tests: []matchTest{
+				{"gopkg.in/yaml.v1", "github.com/go-yaml/yaml"},
+				{"gopkg.in/yaml.v3", "github.com/go-yaml/yaml/v3"},
+				{"gopkg.in/check.v1/internal", "github.com/go-check/check/internal"},
+				{"gopkg.in/user/pkg.v2", "github.com/user/pkg/v2"},
+				{"gopkg.in/user/pkg.v2/sub", "github.com/user/pkg/v2/sub"},
+				{"gopkg.in/yaml", ""},
+				{"gopkg.in/yaml.v01", ""},
+				{"github.com/go-yaml/yaml", ""},
+			},
+		},
+		{
+			transform: "github-to-gopkg.in",
+			tests: []matchTest{
+				{"github.com/go-yaml/yaml", "gopkg.in/yaml.v1"},
+				{"github.com/go-yaml/yaml/v3", "gopkg.in/yaml.v3"},
+				{"github.com/go-yaml/yaml/v3/sub", "gopkg.in/yaml.v3/sub"},
+				{"github.com/go-check/check/internal", "gopkg.in/check.v1/internal"},
+				{"github.com/go-kit/log", ""},
+				{"github.com/user/pkg", ""},
+				{"gopkg.in/yaml.v3", ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transform, func(t *testing.T) {
+			runMatchTests(t, newRuleRewriter(t, Rule{Transform: tt.transform}), tt.tests)
+		})
+	}
+}
+
+func TestRuleTransformErrors(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want string
+	}{
+		{Rule{Transform: "upper"}, "unknown transform"},
+		{Rule{Transform: "gopkg.in-to-github", Source: "gopkg.in/yaml.v3"}, "can't have a source"},
+	}
+
+	for _, tt := range tests {
+		err := NewRewriter().Add(tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Add(%s) fails with %v, want an error about %q", tt.rule, err, tt.want)
+		}
+	}
+}
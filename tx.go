@@ -0,0 +1,80 @@
+package yolk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// transaction writes a batch of rewritten files all or nothing: every file
+// is backed up before being written, and all of them are restored from
+// their backups as soon as one write fails. The backups are only deleted
+// once every file is written, so a run dying halfway leaves them on disk.
+type transaction struct {
+	staged  []*fileResult
+	backups []string
+
+	// fsys is the file system of the files, the disk if nil, where the
+	// files are written in place and restored from their content in memory.
+	fsys FileSystem
+}
+
+// stage adds the rewritten file to the batch.
+func (t *transaction) stage(res *fileResult) {
+	t.staged = append(t.staged, res)
+}
+
+// commit writes all staged files, or none of them.
+func (t *transaction) commit() error {
+	if t.fsys != nil {
+		return t.commitFS()
+	}
+
+	for _, res := range t.staged {
+		backname, err := backupFile(res.path+".", res.src, res.perm)
+		if err != nil {
+			os.Remove(backname)
+			return t.rollback(&FileError{Path: res.path, Err: err})
+		}
+		t.backups = append(t.backups, backname)
+
+		if err := ioutil.WriteFile(res.path, res.dst, res.perm); err != nil {
+			return t.rollback(&FileError{Path: res.path, Err: err})
+		}
+	}
+
+	for _, backname := range t.backups {
+		os.Remove(backname)
+	}
+	return nil
+}
+
+// commitFS writes all staged files to fsys, writing back the content of the
+// files already written if one of them fails.
+func (t *transaction) commitFS() error {
+	for i, res := range t.staged {
+		if err := t.fsys.WriteFile(res.path, res.dst, res.perm); err != nil {
+			errs := Errors{&FileError{Path: res.path, Err: err}}
+			for _, done := range t.staged[:i] {
+				if err := t.fsys.WriteFile(done.path, done.src, done.perm); err != nil {
+					errs = append(errs, &FileError{Path: done.path, Err: fmt.Errorf("restore fails: %v", err)})
+				}
+			}
+			return errs
+		}
+	}
+	return nil
+}
+
+// rollback restores every file backed up so far, and returns the error
+// causing the rollback along with the files failing to be restored.
+func (t *transaction) rollback(cause *FileError) error {
+	errs := Errors{cause}
+	for i, backname := range t.backups {
+		path := t.staged[i].path
+		if err := os.Rename(backname, path); err != nil {
+			errs = append(errs, &FileError{Path: path, Err: fmt.Errorf("restore from %s fails: %v", backname, err)})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,195 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// typedInfo is what Typed mode learns from loading the packages of the
+// walked directory before rewriting them.
+type typedInfo struct {
+	// modules maps the import paths of the packages and their dependencies
+	// to the path of the module providing them, and known holds these
+	// module paths.
+	modules map[string]string
+	known   map[string]bool
+
+	// errors holds the messages of the errors the packages have before
+	// being rewritten, which are not blamed on the rewrite.
+	errors map[string]bool
+}
+
+// loadTyped loads the packages of dir along with their dependencies, and
+// type checks them.
+func loadTyped(dir string) (*typedInfo, error) {
+	cfg := &packages.Config{
+		Dir:  dir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("load packages of %s fails: %v", dir, err)
+	}
+
+	errs, err := typeErrors(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &typedInfo{
+		modules: make(map[string]string),
+		known:   make(map[string]bool),
+		errors:  make(map[string]bool),
+	}
+	for _, e := range errs {
+		info.errors[e.Msg] = true
+	}
+	dirs := make(map[string]string)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if len(pkg.GoFiles) == 0 {
+			return
+		}
+		pkgDir := filepath.Dir(pkg.GoFiles[0])
+		mod, ok := dirs[pkgDir]
+		if !ok {
+			mod = modulePathOf(pkgDir)
+			dirs[pkgDir] = mod
+		}
+		if mod != "" {
+			info.modules[pkg.PkgPath] = mod
+			info.known[mod] = true
+		}
+	})
+	return info, nil
+}
+
+// modulePathOf returns the path of the module whose go.mod file is in dir or
+// one of its parents, if any.
+func modulePathOf(dir string) string {
+	for ; ; dir = filepath.Dir(dir) {
+		if m, ok := readModule(diskFS{}, dir); ok {
+			return m.path
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// typeErrors loads the packages of dir and type checks them, their
+// dependencies being imported from source, and returns their errors.
+func typeErrors(dir string) ([]packages.Error, error) {
+	cfg := &packages.Config{
+		Dir:  dir,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedImports,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("load packages of %s fails: %v", dir, err)
+	}
+
+	fset := token.NewFileSet()
+	imp := importer.ForCompiler(fset, "source", nil)
+
+	var errs []packages.Error
+	for _, pkg := range pkgs {
+		errs = append(errs, pkg.Errors...)
+		if len(pkg.GoFiles) == 0 {
+			continue
+		}
+
+		var files []*ast.File
+		for _, name := range pkg.GoFiles {
+			f, err := parser.ParseFile(fset, name, nil, 0)
+			if err != nil {
+				errs = append(errs, packages.Error{Pos: name, Msg: err.Error(), Kind: packages.ParseError})
+				continue
+			}
+			files = append(files, f)
+		}
+
+		conf := types.Config{
+			Importer: imp,
+			Sizes:    types.SizesFor("gc", runtime.GOARCH),
+			Error: func(err error) {
+				if te, ok := err.(types.Error); ok {
+					errs = append(errs, packages.Error{Pos: te.Fset.Position(te.Pos).String(), Msg: te.Msg, Kind: packages.TypeError})
+				}
+			},
+		}
+		conf.Check(pkg.PkgPath, fset, files, nil)
+	}
+	return errs, nil
+}
+
+// moves reports whether the import path matched by the rule i is provided by
+// the module the rule moves. When the source of the rule is a module path
+// itself, the modules nested in it and its other major versions are not
+// moved by the rule, even though their paths start with the source.
+// Packages not loaded, such as those of the standard library or missing
+// ones, are left to the rule.
+func (t *typedInfo) moves(rule *Rule, path string) bool {
+	if t == nil || rule.Mode == MatchRegex || rule.tmpl != nil || rule.Transform != "" {
+		return true
+	}
+
+	mod, ok := t.modules[path]
+	if !ok || mod == rule.Source || !strings.HasPrefix(mod, rule.Source+"/") {
+		return true
+	}
+
+	return !isMajorVersion(mod[len(rule.Source)+1:]) && !t.known[rule.Source]
+}
+
+// isMajorVersion reports whether elem is a major version suffix of a module
+// path, as v2.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' || elem[1] == '0' {
+		return false
+	}
+	for _, c := range elem[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// typeCheck type checks the packages of dir again once rewritten, and
+// returns the errors they didn't have before.
+func (t *typedInfo) typeCheck(dir string) error {
+	found, err := typeErrors(dir)
+	if err != nil {
+		return err
+	}
+
+	var errs Errors
+	for _, e := range found {
+		if t.errors[e.Msg] {
+			continue
+		}
+
+		path := e.Pos
+		if i := strings.Index(path, ":"); i > 0 {
+			path = path[:i]
+		}
+		if path == "" || path == "-" {
+			path = dir
+		}
+		errs = append(errs, &FileError{Path: path, Err: fmt.Errorf("rewritten code doesn't type check: %s", e.Msg)})
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,168 @@
+package yolk
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strings"
+
+	modpath "golang.org/x/mod/module"
+)
+
+// kindUnaliased is the kind of the replacers of the imports whose name is
+// only dropped by unalias rules.
+const kindUnaliased = "unaliased import"
+
+// The modes of the Unalias of a rule, telling which names of its imports it
+// drops.
+const (
+	// UnaliasAlways drops every name the imports are given.
+	UnaliasAlways = "always"
+	// UnaliasVersioned only drops the names holding the major version of
+	// the import path, as yamlv3 for gopkg.in/yaml.v3 or log2 for
+	// corp/log/v2, the imports being named after the path without it.
+	UnaliasVersioned = "versioned"
+)
+
+func (r *Rule) validateUnalias() error {
+	if r.Dest != "" || r.Transform != "" || r.Alias != "" || r.Remove != "" || r.Add != "" || r.Symbol != "" || r.Embed {
+		return fmt.Errorf("unalias rule %s can't have a destination, transform, alias, remove, add, symbol or embed", r)
+	}
+
+	switch r.Unalias {
+	case UnaliasAlways, UnaliasVersioned:
+	default:
+		return fmt.Errorf("unknown unalias mode %q of rule %s", r.Unalias, r.Source)
+	}
+
+	switch r.Mode {
+	case "":
+		r.Mode = MatchExact
+		if r.Source == "" || r.Unalias == UnaliasVersioned {
+			r.Mode = MatchPrefix
+		}
+	case MatchPrefix, MatchExact:
+	case MatchRegex:
+		re, err := regexp.Compile(r.Source)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of unalias rule %s: %v", r.Source, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown match mode %q of unalias rule %s", r.Mode, r.Source)
+	}
+	return nil
+}
+
+// unaliasing returns the index of the first unalias rule dropping the name
+// of the import of path in the golang source file.
+func (r *Rewriter) unaliasing(file, path, name string, rel *string) (int, bool) {
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if rule.Unalias == "" || !r.appliesTo(rule, file, rel) {
+			continue
+		}
+		if rule.Source == "" && rule.excepts(path) || rule.Source != "" && !rule.matchPattern(rule.Source, path) {
+			continue
+		}
+		if rule.Unalias == UnaliasVersioned && !versionedName(name, path) {
+			continue
+		}
+		return i, true
+	}
+	return -1, false
+}
+
+// versionedName reports whether the name of an import of path holds the
+// major version of path.
+func versionedName(name, path string) bool {
+	_, major, ok := modpath.SplitPathVersion(path)
+	if !ok || major == "" {
+		return false
+	}
+	return name != assumedName(path) && strings.HasSuffix(name, major[2:])
+}
+
+// unaliases marks the replacers of the named imports of the golang source
+// file whose name is dropped by an unalias rule once rewritten, and returns
+// the replacers of those the other rules leave alone. The imports renamed
+// by the alias of their rule, and those which would clash with another
+// name of the file, keep their name.
+func (r *Rewriter) unaliases(fset *token.FileSet, path string, file *ast.File, replacers []*replacer, dropped map[*ast.ImportSpec]bool) []*replacer {
+	rewritten := make(map[*ast.ImportSpec]*replacer)
+	for _, rp := range replacers {
+		rewritten[rp.spec] = rp
+	}
+
+	var (
+		added []*replacer
+		taken = make(map[string]bool)
+		rel   = ""
+	)
+	for _, imp := range file.Imports {
+		name := importName(imp)
+		if imp.Name == nil || name == "_" || name == "." || dropped[imp] {
+			continue
+		}
+
+		p := importPath(imp)
+		rp := rewritten[imp]
+		if rp != nil {
+			if rp.removed || r.rules[rp.rule].Alias != "" {
+				continue
+			}
+			p = rp.newPath
+		}
+		i, ok := r.unaliasing(path, p, name, &rel)
+		if !ok {
+			continue
+		}
+
+		base := assumedName(p)
+		if name != base && (nameInUse(file, base) || taken[base]) {
+			r.Log.Warnf("%s: the name %s of %s is kept, %s is already in use", fset.Position(imp.Path.Pos()), name, p, base)
+			continue
+		}
+		taken[base] = true
+
+		if rp == nil {
+			rp = &replacer{
+				spec:    imp,
+				oldPath: p,
+				newPath: p,
+				name:    name,
+				newName: name,
+				rule:    i,
+				kind:    kindUnaliased,
+				pos:     fset.Position(imp.Path.Pos()),
+			}
+			added = append(added, rp)
+		}
+		rp.unaliased = true
+	}
+	return added
+}
+
+// dropAliases drops the names of the imports of the replacers marked by
+// unaliases, and renames the qualifiers referring to them after the
+// package. The returned edits apply the renames to the source.
+func (r *Rewriter) dropAliases(fset *token.FileSet, file *ast.File, replacers []*replacer) []textEdit {
+	var edits []textEdit
+	for _, rp := range replacers {
+		if !rp.unaliased || rp.merged {
+			continue
+		}
+
+		oldName, newName := rp.name, assumedName(rp.newPath)
+		rp.newName = ""
+		if oldName == newName {
+			continue
+		}
+		for _, id := range renameQualifier(file, oldName, newName) {
+			off := fset.Position(id.Pos()).Offset
+			edits = append(edits, textEdit{start: off, end: off + len(oldName), text: newName})
+		}
+	}
+	return edits
+}
@@ -0,0 +1,131 @@
+package yolk
+
+import "testing"
+
+func TestUnaliasRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		src   string
+		want  string
+	}{
+		{
+			name:  "always",
+			rules: []Rule{{Source: "github.com/pkg/errors", Unalias: UnaliasAlways}},
+			src: `package a
+
+import errs "github.com/pkg/errors"
+
+var _ = errs.New
+`,
+			want: `package a
+
+import "github.com/pkg/errors"
+
+var _ = errors.New
+`,
+		},
+		{
+			name:  "versioned",
+			rules: []Rule{{Unalias: UnaliasVersioned}},
+			src: `package a
+
+import (
+	log2 "corp.example.com/log/v2"
+	yamlv3 "gopkg.in/yaml.v3"
+	y "gopkg.in/yaml.v2"
+)
+
+var _ = log2.Print
+var _ = yamlv3.Marshal
+var _ = y.Marshal
+`,
+			want: `package a
+
+import (
+	"corp.example.com/log/v2"
+	y "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = log.Print
+var _ = yaml.Marshal
+var _ = y.Marshal
+`,
+		},
+		{
+			name:  "every import",
+			rules: []Rule{{Unalias: UnaliasAlways, Except: []string{"corp.example.com/keep"}}},
+			src: `package a
+
+import (
+	k "corp.example.com/keep"
+	u "corp.example.com/util"
+	_ "corp.example.com/driver"
+)
+
+var _ = k.X
+var _ = u.X
+`,
+			want: `package a
+
+import (
+	_ "corp.example.com/driver"
+	k "corp.example.com/keep"
+	"corp.example.com/util"
+)
+
+var _ = k.X
+var _ = util.X
+`,
+		},
+		{
+			name:  "name in use",
+			rules: []Rule{{Source: "github.com/pkg/errors", Unalias: UnaliasAlways}},
+			src: `package a
+
+import errs "github.com/pkg/errors"
+
+func f(errors []error) error { return errs.New("x") }
+`,
+			want: `package a
+
+import errs "github.com/pkg/errors"
+
+func f(errors []error) error { return errs.New("x") }
+`,
+		},
+		{
+			name: "rewritten",
+			rules: []Rule{
+				{Source: "old.corp/log", Dest: "corp.example.com/log/v2"},
+				{Unalias: UnaliasVersioned},
+			},
+			src: `package a
+
+import log2 "old.corp/log"
+
+var _ = log2.Print
+`,
+			want: `package a
+
+import "corp.example.com/log/v2"
+
+var _ = log.Print
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRuleRewriter(t, tt.rules...)
+			got, err := r.RewriteSource("a.go", []byte(tt.src))
+			if err != nil {
+				t.Fatalf("RewriteSource() fails: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("RewriteSource() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package yolk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// isModulesTxt reports whether path is the vendor/modules.txt file written
+// by go mod vendor.
+func isModulesTxt(path string) bool {
+	return filepath.Base(path) == "modules.txt" && isVendorDir(filepath.Base(filepath.Dir(path)))
+}
+
+// isVendorDir reports whether name is the name of a vendor directory.
+func isVendorDir(name string) bool {
+	if foldPaths {
+		return strings.EqualFold(name, "vendor")
+	}
+	return name == "vendor"
+}
+
+// rewriteModulesTxt returns the content of the vendor/modules.txt file src
+// with its module and package paths rewritten. Module lines look like
+//
+//	# github.com/old/mod v1.0.0
+//	# github.com/old/mod v1.0.0 => github.com/fork/mod v1.0.1
+//	## explicit
+//	github.com/old/mod/pkg
+func (r *Rewriter) rewriteModulesTxt(path string, src []byte) ([]byte, []*replacer) {
+	var replacers []*replacer
+	rewrite := func(old string) string {
+		rule, np, ok := r.match(path, old)
+		if !ok || np == old {
+			return old
+		}
+		replacers = append(replacers, &replacer{oldPath: old, newPath: np, rule: rule, kind: kindVendor})
+		return np
+	}
+
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	var dst bytes.Buffer
+	for _, line := range lines {
+		text := string(line)
+		body := strings.TrimRight(text, "\r\n")
+		eol := text[len(body):]
+
+		switch {
+		case strings.HasPrefix(body, "## "), body == "":
+		case strings.HasPrefix(body, "# "):
+			fields := strings.Fields(body[2:])
+			for i, f := range fields {
+				// module paths are the fields followed by a version or
+				// standing right after the => separator
+				if i == 0 || fields[i-1] == "=>" {
+					fields[i] = rewrite(f)
+				}
+			}
+			body = "# " + strings.Join(fields, " ")
+		default:
+			body = rewrite(body)
+		}
+
+		dst.WriteString(body)
+		dst.WriteString(eol)
+	}
+
+	if len(replacers) == 0 {
+		return src, nil
+	}
+	return dst.Bytes(), replacers
+}
+
+// vendoring reports whether the go command builds the module of the go.mod
+// file in dir from its vendor directory: GOFLAGS sets -mod=vendor, or sets
+// no -mod while the module, at go 1.14 or later, has a vendor/modules.txt
+// file.
+func vendoring(fsys FileSystem, dir string) bool {
+	for _, flag := range strings.Fields(os.Getenv("GOFLAGS")) {
+		if mode := strings.TrimPrefix(flag, "-mod="); mode != flag {
+			return mode == "vendor"
+		}
+	}
+
+	if _, err := fsys.Stat(filepath.Join(dir, "vendor", "modules.txt")); err != nil {
+		return false
+	}
+	data, err := fsys.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return false
+	}
+	for _, d := range parseDirectives(data) {
+		if d.verb == "go" && len(d.args) == 1 {
+			return semver.Compare("v"+d.args[0].text, "v1.14") >= 0
+		}
+	}
+	return false
+}
+
+// warnVendoring warns about the modules of the run with changed files which
+// build from their vendor directory, left alone unless IncludeVendor is set,
+// until go mod vendor is run in them, as in Vendor mode.
+func (r *Rewriter) warnVendoring() {
+	if r.IncludeVendor || r.Vendor {
+		return
+	}
+
+	r.mu.Lock()
+	var dirs []string
+	for m, n := range r.summary.modules {
+		if n > 0 {
+			dirs = append(dirs, m.dir)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if vendoring(r.fs(), dir) {
+			r.Log.Warnf("%s builds with -mod=vendor but its vendor directory is not rewritten, run go mod vendor in it once rewritten", dir)
+		}
+	}
+}
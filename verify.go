@@ -0,0 +1,68 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+)
+
+// Verifications run by Verify.
+const (
+	VerifyBuild = "build"
+	VerifyVet   = "vet"
+)
+
+// verify checks that the code still compiles once the files are written by
+// RewriteDir from dir, with the type checking of Typed mode and the go
+// command of Verify.
+func (r *Rewriter) verify(dir string, written []*fileResult) error {
+	if r.typed != nil {
+		if err := r.typed.typeCheck(dir); err != nil {
+			return err
+		}
+	}
+	if r.Verify == "" {
+		return nil
+	}
+
+	// go build ./... stops at nested modules, so it runs in every walked
+	// module with written files
+	dirs := make(map[string]bool)
+	for _, res := range written {
+		if d, _, ok := r.moduleOf(res.path); ok {
+			dirs[d] = true
+		} else {
+			dirs[dir] = true
+		}
+	}
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+
+	var errs Errors
+	for _, d := range sorted {
+		r.Log.Infof("running go %s ./... in %s", r.Verify, d)
+		cmd := exec.Command("go", r.Verify, "./...")
+		cmd.Dir = d
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, &FileError{Path: d, Err: fmt.Errorf("go %s fails due to %v: %s", r.Verify, err, bytes.TrimSpace(out))})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// validateVerify checks the verification asked by Verify.
+func (r *Rewriter) validateVerify() error {
+	switch r.Verify {
+	case "", VerifyBuild, VerifyVet:
+		return nil
+	}
+	return fmt.Errorf("unknown verification %q, want %s or %s", r.Verify, VerifyBuild, VerifyVet)
+}
@@ -0,0 +1,406 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// RewriteDir walks the directory dir and rewrites every golang source file
+// found in it, using Jobs concurrent workers. Files which fail to be
+// rewritten are skipped and returned as Errors once all files are done. In
+// strict mode the run stops at the first failing file instead, and the files
+// already rewritten are restored. In atomic mode no file is written unless
+// all of them are rewritten successfully, and in typed mode or with Verify
+// all files are restored if the code doesn't compile once written.
+func (r *Rewriter) RewriteDir(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("you must specify a directory to handle")
+	}
+
+	if _, _, err := r.handlers(); err != nil {
+		return err
+	}
+	if err := r.validateVerify(); err != nil {
+		return err
+	}
+	if err := r.validateTestdata(); err != nil {
+		return err
+	}
+	if err := r.validateTests(); err != nil {
+		return err
+	}
+	if err := r.validateFS(); err != nil {
+		return err
+	}
+
+	r.findModules(dir)
+	r.resetIgnores(dir)
+	r.root = dir
+
+	r.cache = r.loadCache(dir)
+	defer func() {
+		if err := r.saveCache(); err != nil {
+			r.Log.Warnf("write cache %s fails due to %v", filepath.Join(dir, CacheFile), err)
+		}
+		if r.cache != nil && r.cache.hits > 0 {
+			r.Log.Debugf("%d files unchanged since a previous run", r.cache.hits)
+		}
+		r.cache = nil
+	}()
+	defer r.warnVendoring()
+
+	r.tracked = nil
+	if r.GitTracked {
+		tracked, err := gitTrackedFiles(dir)
+		if err != nil {
+			return err
+		}
+		r.tracked = tracked
+	}
+
+	r.typed = nil
+	if r.Typed {
+		typed, err := loadTyped(dir)
+		if err != nil {
+			return err
+		}
+		r.typed = typed
+	}
+
+	var paths []string
+	err := r.walk(dir, func(path string, info os.FileInfo, errx error) error {
+		if errx != nil {
+			return errx
+		}
+
+		ok, reason, err := r.handle(dir, path, info)
+		if ok {
+			if r.MaxFiles > 0 && len(paths) == r.MaxFiles {
+				return fmt.Errorf("more than %d files to handle in %s", r.MaxFiles, dir)
+			}
+			paths = append(paths, path)
+		} else if reason != "" {
+			r.skip(path, reason)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	r.Log.Debugf("%d files to handle in %s", len(paths), dir)
+
+	if r.Atomic || r.Typed || r.Verify != "" {
+		return r.runAtomic(dir, paths)
+	}
+
+	var (
+		errs    Errors
+		written []*fileResult
+	)
+	r.run(paths, func(res *fileResult) bool {
+		if err := r.commit(res); err != nil {
+			if err == ErrStop {
+				return false
+			}
+			errs = append(errs, &FileError{Path: res.path, Err: err})
+			return !r.Strict
+		}
+
+		if (r.Strict || r.Journal || r.BackupDir != "") && !r.DryRun && res.skipped == "" && !bytes.Equal(res.src, res.dst) {
+			written = append(written, res)
+		}
+		return true
+	})
+
+	if len(errs) > 0 && r.Strict {
+		for _, res := range written {
+			if err := r.writeFile(res.path, res.dst, res.src, res.perm); err != nil {
+				errs = append(errs, &FileError{Path: res.path, Err: fmt.Errorf("restore fails: %v", err)})
+				continue
+			}
+			r.keepTime(res)
+		}
+		return errs
+	}
+
+	if r.Journal {
+		if err := r.writeJournal(dir, written); err != nil {
+			if len(errs) == 0 {
+				return err
+			}
+			errs = append(errs, &FileError{Path: filepath.Join(dir, JournalFile), Err: err})
+		}
+	}
+
+	if r.BackupDir != "" {
+		if err := r.writeBackups(dir, written); err != nil {
+			if len(errs) == 0 {
+				return err
+			}
+			errs = append(errs, &FileError{Path: resolveBackupDir(dir, r.BackupDir), Err: err})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// runAtomic rewrites paths walked from dir in memory first, and writes them
+// in a single transaction only if all of them succeed.
+func (r *Rewriter) runAtomic(dir string, paths []string) error {
+	var (
+		errs Errors
+		tx   = transaction{fsys: r.FS}
+	)
+	r.run(paths, func(res *fileResult) bool {
+		err := r.confirm(res)
+		if err == ErrStop {
+			return false
+		}
+		if err == nil {
+			err = r.report(res)
+		}
+		r.record(res, err)
+		if err != nil {
+			errs = append(errs, &FileError{Path: res.path, Err: err})
+			return !r.Strict
+		}
+
+		if !r.DryRun && res.skipped == "" && !bytes.Equal(res.src, res.dst) {
+			tx.stage(res)
+		}
+		return true
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := tx.commit(); err != nil {
+		return err
+	}
+	for _, res := range tx.staged {
+		if err := r.keepTime(res); err != nil {
+			errs = append(errs, &FileError{Path: res.path, Err: err})
+		}
+	}
+
+	if len(tx.staged) > 0 {
+		if err := r.verify(dir, tx.staged); err != nil {
+			errs, ok := err.(Errors)
+			if !ok {
+				errs = Errors{&FileError{Path: dir, Err: err}}
+			}
+			for _, res := range tx.staged {
+				if err := r.writeFile(res.path, res.dst, res.src, res.perm); err != nil {
+					errs = append(errs, &FileError{Path: res.path, Err: fmt.Errorf("restore fails: %v", err)})
+					continue
+				}
+				r.keepTime(res)
+			}
+			r.fail(errs)
+			return errs
+		}
+	}
+
+	if r.BackupDir != "" {
+		if err := r.writeBackups(dir, tx.staged); err != nil {
+			return err
+		}
+	}
+	if r.Journal {
+		if err := r.writeJournal(dir, tx.staged); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		r.fail(errs)
+		return errs
+	}
+	return nil
+}
+
+// handle reports whether the file path walked from root should be
+// rewritten, and if not, the reason why a golang source file is skipped.
+// The returned error controls the walking, as filepath.WalkFunc does.
+func (r *Rewriter) handle(root, path string, info os.FileInfo) (bool, string, error) {
+	rel := relPath(root, path)
+
+	if info.IsDir() {
+		r.addModule(path)
+
+		// the journal, cache and backups of the runs are never rewritten,
+		// nor reported
+		if info.Name() == filepath.Dir(JournalFile) {
+			return false, "", filepath.SkipDir
+		}
+		if r.BackupDir != "" && filepath.Clean(path) == resolveBackupDir(root, r.BackupDir) {
+			return false, "backup directory", filepath.SkipDir
+		}
+
+		if info.Name() == "testdata" && r.Testdata == TestdataSkip {
+			return false, "testdata directory", filepath.SkipDir
+		}
+
+		if isVendorDir(info.Name()) && !r.IncludeVendor {
+			return false, "vendor directory", filepath.SkipDir
+		}
+
+		if pattern, ok := matchAny(r.Exclude, rel); ok && rel != "." {
+			return false, "excluded by " + pattern, filepath.SkipDir
+		}
+		if !r.work.contains(rel, true) {
+			return false, "outside workspace", filepath.SkipDir
+		}
+		if r.MaxDepth > 0 && rel != "." && strings.Count(rel, "/")+1 >= r.MaxDepth {
+			return false, fmt.Sprintf("deeper than %d levels", r.MaxDepth), filepath.SkipDir
+		}
+		if file, ok := r.ignored(root, path, true); ok {
+			return false, "ignored by " + file, filepath.SkipDir
+		}
+		return false, "", nil
+	}
+
+	filename := info.Name()
+	h, ok := r.handlerFor(path)
+	switch {
+	case !ok:
+		return false, "", nil
+	case h != nil:
+	case filename == "go.mod" || isWorkFile(filename):
+		if !r.GoMod {
+			return false, "", nil
+		}
+	case isModulesTxt(path):
+	case strings.HasSuffix(filename, ".go"):
+		// build constraints are not evaluated, every variant of a package
+		// is rewritten regardless of the GOOS, GOARCH and tags it targets
+		for _, skip := range r.SkipSuffixes {
+			if strings.HasSuffix(filename, skip) {
+				return false, "skipped suffix " + skip, nil
+			}
+		}
+	default:
+		return false, "", nil
+	}
+
+	if reason := r.testsSkipReason(filename); reason != "" {
+		return false, reason, nil
+	}
+	if pattern, ok := matchAny(r.Exclude, rel); ok {
+		return false, "excluded by " + pattern, nil
+	}
+	if file, ok := r.ignored(root, path, false); ok {
+		return false, "ignored by " + file, nil
+	}
+
+	// the go.work files stand at the root of the workspace, out of its
+	// modules
+	if !isWorkFile(filename) && !r.work.contains(rel, false) {
+		return false, "outside workspace", nil
+	}
+
+	if r.tracked != nil && !r.tracked[filepath.Clean(path)] {
+		return false, "untracked", nil
+	}
+
+	if len(r.Include) > 0 {
+		if _, ok := matchAny(r.Include, rel); !ok {
+			return false, "not included", nil
+		}
+	}
+
+	if len(r.Modules) > 0 && !r.inModules(root, path) {
+		return false, "outside modules", nil
+	}
+
+	if r.MaxFileSize > 0 && info.Size() > r.MaxFileSize {
+		return false, fmt.Sprintf("larger than %d bytes", r.MaxFileSize), nil
+	}
+
+	return true, "", nil
+}
+
+// relPath returns path relative to root with slash separators, or path
+// itself if it is not under root.
+func relPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// run processes paths with a bounded pool of workers, and calls done with
+// every result in the order of paths from the calling goroutine. The run
+// stops early once done returns false.
+func (r *Rewriter) run(paths []string, done func(*fileResult) bool) {
+	jobs := r.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	type indexed struct {
+		i   int
+		res *fileResult
+	}
+
+	todo := make(chan int)
+	quit := make(chan struct{})
+	results := make(chan indexed, jobs)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range todo {
+				results <- indexed{i, r.process(paths[i])}
+			}
+		}()
+	}
+
+	go func() {
+	feed:
+		for i := range paths {
+			select {
+			case todo <- i:
+			case <-quit:
+				break feed
+			}
+		}
+		close(todo)
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]*fileResult)
+	next := 0
+	stopped := false
+	for ir := range results {
+		if stopped {
+			continue
+		}
+
+		pending[ir.i] = ir.res
+		for res, ok := pending[next]; ok; res, ok = pending[next] {
+			delete(pending, next)
+			next++
+			if !done(res) {
+				stopped = true
+				close(quit)
+				break
+			}
+			r.progress(next, len(paths))
+		}
+	}
+	r.Log.endProgress()
+}
@@ -0,0 +1,64 @@
+package yolk
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRelPath(t *testing.T) {
+	tests := []struct {
+		root string
+		path string
+		want string
+	}{
+		{root: "repo", path: "repo", want: "."},
+		{root: "repo", path: "repo/a.go", want: "a.go"},
+		{root: "repo", path: "repo/cmd/yolk/main.go", want: "cmd/yolk/main.go"},
+		{root: "repo/", path: "repo/pkg/./b.go", want: "pkg/b.go"},
+		{root: "/abs/repo", path: "/abs/repo/pkg/c.go", want: "pkg/c.go"},
+		{root: "repo/pkg", path: "repo/other/d.go", want: "../other/d.go"},
+	}
+	for _, tt := range tests {
+		root, path := filepath.FromSlash(tt.root), filepath.FromSlash(tt.path)
+		if got := relPath(root, path); got != tt.want {
+			t.Errorf("relPath(%q, %q) = %q, want %q", root, path, got, tt.want)
+		}
+	}
+}
+
+func TestIsVendorDir(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "vendor", want: true},
+		{name: "Vendor", want: foldPaths},
+		{name: "VENDOR", want: foldPaths},
+		{name: "vendors", want: false},
+		{name: "third_party", want: false},
+	}
+	for _, tt := range tests {
+		if got := isVendorDir(tt.name); got != tt.want {
+			t.Errorf("isVendorDir(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsModulesTxt(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "vendor/modules.txt", want: true},
+		{path: "repo/sub/vendor/modules.txt", want: true},
+		{path: "repo/Vendor/modules.txt", want: foldPaths},
+		{path: "repo/modules.txt", want: false},
+		{path: "repo/vendor/pkg/modules.txt", want: false},
+	}
+	for _, tt := range tests {
+		path := filepath.FromSlash(tt.path)
+		if got := isModulesTxt(path); got != tt.want {
+			t.Errorf("isModulesTxt(%q) = %v, want %v", path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package yolk
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long a changed file has to stay quiet before it is
+// rewritten, so the burst of events of a single save is handled once.
+const watchDelay = 200 * time.Millisecond
+
+// Watch monitors the directory dir and rewrites the golang source files in
+// it whenever they are created or modified, until done is closed. Files are
+// only written when their content actually changes.
+func (r *Rewriter) Watch(dir string, done <-chan struct{}) error {
+	if r.FS != nil {
+		return fmt.Errorf("watching requires the files to be on disk, not in FS")
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	r.findModules(dir)
+	r.resetIgnores(dir)
+	r.root = dir
+	if err := r.watchTree(w, dir, dir); err != nil {
+		return err
+	}
+
+	pending := make(map[string]struct{})
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return nil
+
+		case err := <-w.Errors:
+			r.Log.Errorf("watch %s fails due to %s", dir, err)
+
+		case ev := <-w.Events:
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Rename) == 0 {
+				continue
+			}
+
+			info, err := os.Stat(ev.Name)
+			if err != nil {
+				continue
+			}
+
+			if info.IsDir() {
+				if ev.Op&fsnotify.Create != 0 {
+					if err := r.watchTree(w, dir, ev.Name); err != nil {
+						r.Log.Errorf("watch %s fails due to %s", ev.Name, err)
+					}
+				}
+				continue
+			}
+
+			if ok, _, _ := r.handle(dir, ev.Name, info); ok {
+				pending[ev.Name] = struct{}{}
+				timer.Reset(watchDelay)
+			}
+
+		case <-timer.C:
+			for path := range pending {
+				r.rewriteChanged(path)
+			}
+			pending = make(map[string]struct{})
+		}
+	}
+}
+
+// watchTree adds dir under the watched root and all of its walked
+// subdirectories to w, also rewriting the files already in them.
+func (r *Rewriter) watchTree(w *fsnotify.Watcher, root, dir string) error {
+	return r.walk(dir, func(path string, info os.FileInfo, errx error) error {
+		if errx != nil {
+			return errx
+		}
+
+		ok, _, err := r.handle(root, path, info)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return w.Add(path)
+		}
+
+		if ok {
+			r.rewriteChanged(path)
+		}
+		return nil
+	})
+}
+
+// rewriteChanged rewrites path unless its content is left unchanged, which
+// would otherwise trigger another event for the file.
+func (r *Rewriter) rewriteChanged(path string) {
+	res := r.process(path)
+	if res.err == nil && bytes.Equal(res.src, res.dst) {
+		return
+	}
+
+	if err := r.commit(res); err != nil {
+		r.Log.Errorf("%v", &FileError{Path: path, Err: err})
+	}
+}
@@ -0,0 +1,257 @@
+package yolk
+
+import (
+	"bytes"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// kindWorkFile is the kind of the replacers of the go.work files.
+	kindWorkFile = "go.work"
+	// kindWorkSum is the kind of the replacers of the go.work.sum files,
+	// whose lines of the rewritten modules are dropped, their checksums
+	// being recomputed by the go command for the new paths.
+	kindWorkSum = "go.work.sum"
+)
+
+// isWorkFile reports whether name is the name of a go.work file or of its
+// checksums.
+func isWorkFile(name string) bool {
+	return name == "go.work" || name == "go.work.sum"
+}
+
+// workspace is the go.work file of the walked directory.
+type workspace struct {
+	// file is the path of the go.work file, and uses the directories of its
+	// use directives, slash separated and relative to the walked directory.
+	file string
+	uses []string
+}
+
+// findWorkspace records the workspace of the go.work file named by GOWORK,
+// or else of the first one found in the walked directory root and its
+// parents, unless GOWORK is off or IgnoreWorkspace is set. A go.work file
+// using no module is ignored.
+func (r *Rewriter) findWorkspace(root string) {
+	r.work = nil
+	gowork := os.Getenv("GOWORK")
+	if r.IgnoreWorkspace || gowork == "off" {
+		return
+	}
+
+	abs := filepath.Clean(root)
+	if r.FS == nil {
+		var err error
+		if abs, err = filepath.Abs(root); err != nil {
+			return
+		}
+	}
+
+	file := gowork
+	for dir := abs; file == ""; dir = filepath.Dir(dir) {
+		if _, err := r.fs().Stat(filepath.Join(dir, "go.work")); err == nil {
+			file = filepath.Join(dir, "go.work")
+		} else if filepath.Dir(dir) == dir {
+			return
+		}
+	}
+
+	data, err := r.fs().ReadFile(file)
+	if err != nil {
+		r.Log.Warnf("read workspace %s fails due to %v", file, err)
+		return
+	}
+
+	w := &workspace{file: file}
+	for _, d := range parseDirectives(data) {
+		if d.verb != "use" || len(d.args) != 1 {
+			continue
+		}
+		dir := filepath.FromSlash(unquoteToken(d.args[0].text))
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(file), dir)
+		}
+		w.uses = append(w.uses, relPath(abs, dir))
+	}
+	if len(w.uses) > 0 {
+		r.Log.Debugf("workspace %s uses %s", file, strings.Join(w.uses, ", "))
+		r.work = w
+	}
+}
+
+// contains reports whether the path rel, relative to the walked directory,
+// belongs to a module of the workspace, or may hold one if it is a
+// directory. Everything belongs to a nil workspace.
+func (w *workspace) contains(rel string, dir bool) bool {
+	if w == nil || rel == "." {
+		return true
+	}
+	for _, u := range w.uses {
+		if u == "." || hasPathPrefix(rel, u) || dir && hasPathPrefix(u, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// directive is a directive of a go.mod or go.work file, standing on its own
+// or in a block, its arguments located by their offsets in the file.
+type directive struct {
+	verb string
+	line int
+	args []directiveToken
+}
+
+type directiveToken struct {
+	text  string
+	start int
+}
+
+// parseDirectives returns the directives of the go.mod or go.work file src,
+// whatever their verbs and versions, which modfile only parses if it knows
+// them.
+func parseDirectives(src []byte) []directive {
+	var (
+		directives []directive
+		block      string
+		off        int
+	)
+	for i, line := range bytes.SplitAfter(src, []byte("\n")) {
+		toks := directiveTokens(string(line), off)
+		off += len(line)
+
+		switch {
+		case len(toks) == 0:
+		case block != "" && toks[0].text == ")":
+			block = ""
+		case block != "":
+			directives = append(directives, directive{verb: block, line: i + 1, args: toks})
+		case len(toks) == 2 && toks[1].text == "(":
+			block = toks[0].text
+		default:
+			directives = append(directives, directive{verb: toks[0].text, line: i + 1, args: toks[1:]})
+		}
+	}
+	return directives
+}
+
+// directiveTokens splits the line of a go.mod or go.work file, starting at
+// offset off, into its tokens up to its comment, the quoted strings being
+// kept whole.
+func directiveTokens(line string, off int) []directiveToken {
+	var toks []directiveToken
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+		case strings.HasPrefix(line[i:], "//"):
+			return toks
+		case c == '"' || c == '`':
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if c == '"' && line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			}
+			toks = append(toks, directiveToken{text: line[i:end], start: off + i})
+			i = end
+			continue
+		}
+
+		end := i
+		for end < len(line) && !strings.ContainsRune(" \t\r\n", rune(line[end])) && !strings.HasPrefix(line[end:], "//") {
+			end++
+		}
+		toks = append(toks, directiveToken{text: line[i:end], start: off + i})
+		i = end
+	}
+	return toks
+}
+
+// rewriteWorkFile returns the content of the go.work file src with the
+// module paths of its replace directives rewritten, the directories of its
+// use directives and the local replacements being left alone. Every other
+// byte of src is kept as it is.
+func (r *Rewriter) rewriteWorkFile(path string, src []byte) ([]byte, []*replacer) {
+	var (
+		edits     []textEdit
+		replacers []*replacer
+	)
+	rewrite := func(d directive, i int) {
+		old := unquoteToken(d.args[i].text)
+		rule, np, ok := r.match(path, old)
+		if !ok || np == old {
+			return
+		}
+
+		tok := d.args[i]
+		edits = append(edits, textEdit{start: tok.start, end: tok.start + len(tok.text), text: modfile.AutoQuote(np)})
+		if b := r.bumped; b != nil && rule == b.rule && i+1 < len(d.args) && d.args[i+1].text != "=>" {
+			v := d.args[i+1]
+			edits = append(edits, textEdit{start: v.start, end: v.start + len(v.text), text: b.bumpVersion(v.text)})
+		}
+		pos := token.Position{Line: d.line, Column: tok.start - bytes.LastIndexByte(src[:tok.start], '\n')}
+		replacers = append(replacers, &replacer{oldPath: old, newPath: np, rule: rule, kind: kindWorkFile, pos: pos})
+	}
+
+	for _, d := range parseDirectives(src) {
+		if d.verb != "replace" {
+			continue
+		}
+		arrow := -1
+		for i, tok := range d.args {
+			if tok.text == "=>" {
+				arrow = i
+			}
+		}
+		if arrow < 1 || arrow+1 >= len(d.args) {
+			continue
+		}
+
+		rewrite(d, 0)
+		if !modfile.IsDirectoryPath(unquoteToken(d.args[arrow+1].text)) {
+			rewrite(d, arrow+1)
+		}
+	}
+
+	if len(replacers) == 0 {
+		return src, nil
+	}
+	return applyEdits(src, edits), replacers
+}
+
+// rewriteWorkSum returns the content of the go.work.sum file src without the
+// checksums of the modules whose paths are rewritten, which the go command
+// adds back for their new paths.
+func (r *Rewriter) rewriteWorkSum(path string, src []byte) ([]byte, []*replacer) {
+	var (
+		dst       bytes.Buffer
+		replacers []*replacer
+	)
+	for i, line := range bytes.SplitAfter(src, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) == 3 {
+			if rule, np, ok := r.match(path, fields[0]); ok && np != fields[0] {
+				pos := token.Position{Line: i + 1, Column: 1}
+				replacers = append(replacers, &replacer{oldPath: fields[0], newPath: np, rule: rule, kind: kindWorkSum, pos: pos})
+				continue
+			}
+		}
+		dst.Write(line)
+	}
+
+	if len(replacers) == 0 {
+		return src, nil
+	}
+	return dst.Bytes(), replacers
+}
@@ -0,0 +1,115 @@
+package yolk
+
+import (
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestRewriteWorkFile(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "replace",
+			src:  "go 1.18\n\nuse ./app\n\nreplace old.corp/lib v1.0.0 => example.com/fork v1.0.1\n",
+			want: "go 1.18\n\nuse ./app\n\nreplace new.corp/lib v1.0.0 => example.com/fork v1.0.1\n",
+		},
+		{
+			name: "replace block",
+			src:  "go 1.18\n\nreplace (\n\texample.com/x => old.corp/lib/x v0.2.0 // fork\n\t\"old.corp/lib\" => ./lib\n)\n",
+			want: "go 1.18\n\nreplace (\n\texample.com/x => new.corp/lib/x v0.2.0 // fork\n\tnew.corp/lib => ./lib\n)\n",
+		},
+		{
+			name: "use",
+			src:  "go 1.18\n\nuse (\n\t./old.corp/lib\n\t./app\n)\n",
+			want: "go 1.18\n\nuse (\n\t./old.corp/lib\n\t./app\n)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRuleRewriter(t, Rule{Source: "old.corp/lib", Dest: "new.corp/lib"})
+			got, replacers := r.rewriteWorkFile("go.work", []byte(tt.src))
+			if string(got) != tt.want {
+				t.Errorf("rewriteWorkFile() = %q, want %q", got, tt.want)
+			}
+			if changed := tt.src != tt.want; changed != (len(replacers) > 0) {
+				t.Errorf("rewriteWorkFile() returns %d replacers", len(replacers))
+			}
+		})
+	}
+}
+
+func TestRewriteWorkSum(t *testing.T) {
+	const src = "example.com/x v1.0.0 h1:abc=\nold.corp/lib v1.0.0 h1:def=\nold.corp/lib v1.0.0/go.mod h1:ghi=\n"
+	r := newRuleRewriter(t, Rule{Source: "old.corp/lib", Dest: "new.corp/lib"})
+	got, replacers := r.rewriteWorkSum("go.work.sum", []byte(src))
+	if want := "example.com/x v1.0.0 h1:abc=\n"; string(got) != want {
+		t.Errorf("rewriteWorkSum() = %q, want %q", got, want)
+	}
+	if len(replacers) != 2 {
+		t.Errorf("rewriteWorkSum() returns %d replacers, want 2", len(replacers))
+	}
+}
+
+func TestRewriteDirWorkspace(t *testing.T) {
+	if os.Getenv("GOWORK") != "" {
+		t.Skip("GOWORK is set")
+	}
+
+	const work = "go 1.18\n\nuse ./app\n\nreplace old.corp/lib => ../lib\n"
+	files := map[string][]byte{
+		"go.work":        []byte(work),
+		"go.work.sum":    []byte("old.corp/lib v1.0.0 h1:def=\n"),
+		"app/go.mod":     []byte("module example.com/app\n\ngo 1.18\n"),
+		"app/a.go":       []byte(oldSource),
+		"tools/go.mod":   []byte("module example.com/tools\n\ngo 1.18\n"),
+		"tools/tools.go": []byte(oldSource),
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(r *Rewriter)
+		changed []string
+	}{
+		{name: "used modules", changed: []string{"app/a.go"}},
+		{
+			name:    "go.work",
+			setup:   func(r *Rewriter) { r.GoMod = true },
+			changed: []string{"app/a.go", "go.work", "go.work.sum"},
+		},
+		{
+			name:    "ignore workspace",
+			setup:   func(r *Rewriter) { r.IgnoreWorkspace = true },
+			changed: []string{"app/a.go", "tools/tools.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemFS(files)
+			r := newMemRewriter(t)
+			r.FS = IOFS(mem)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			if err := r.RewriteDir("."); err != nil {
+				t.Fatal(err)
+			}
+
+			var changed []string
+			for name, data := range mem.Files() {
+				if string(data) != string(files[name]) {
+					changed = append(changed, name)
+				}
+			}
+			sort.Strings(changed)
+			if !equalStrings(changed, tt.changed) {
+				t.Errorf("RewriteDir() changes %q, want %q", changed, tt.changed)
+			}
+		})
+	}
+}
@@ -1,23 +1,12 @@
-package main
+// Package yolk replaces the import path of golang source code.
+package yolk
 
 import (
-	"bytes"
-	"flag"
 	"fmt"
-	"go/ast"
-	"go/format"
-	"go/parser"
+	"go/build/constraint"
 	"go/printer"
-	"go/token"
-	"io/ioutil"
-	"log"
-	"os"
-	"path/filepath"
 	"runtime"
-	"strconv"
-	"strings"
-
-	"golang.org/x/tools/go/ast/astutil"
+	"sync"
 )
 
 const (
@@ -26,239 +15,328 @@ const (
 	printerMode = printer.UseSpaces | printer.TabIndent
 
 	chmodSupported = runtime.GOOS != "windows"
+	// foldPaths tells whether file names are case insensitive
+	foldPaths = runtime.GOOS == "windows"
 )
 
-var (
-	dir               = flag.String("d", "./", "source code directory which to handle")
-	source            = flag.String("s", "", "source import path which to replace")
-	dest              = flag.String("r", "", "destination import path which to replace")
-	codeSuffixSkipped = []string{"pb.go", "pb.gopherjs.go", "stateGen.go", "reactGen.go"}
-)
-
-var replaceRules = map[string]string{}
-
-type replacer struct {
-	name    string
-	oldPath string
-	newPath string
-}
-
-func init() {
-	log.SetFlags(log.Lshortfile | log.Ldate | log.Ltime)
-
-	flag.Usage = usage
-	flag.Parse()
-}
-
-func usage() {
-	fmt.Fprint(os.Stderr, "yolk is go source code import statement modifier\n")
-	fmt.Fprint(os.Stderr, "Usage: yolk [options]\n")
-	fmt.Fprint(os.Stderr, "Options: \n")
-	fmt.Fprint(os.Stderr, "-d   source code directory which to handle\n")
-	fmt.Fprint(os.Stderr, "-s   source import path which to replace\n")
-	fmt.Fprint(os.Stderr, "-r   destination import path which to replace\n")
-	os.Exit(0)
+var codeSuffixSkipped = []string{"pb.go", "pb.gopherjs.go", "stateGen.go", "reactGen.go"}
+
+// Rewriter rewrites the import statements of golang source files according
+// to its replace rules. The rules are tried in the order they are added, and
+// only the first one matching an import path rewrites it, so more specific
+// rules must be added before the broader ones.
+type Rewriter struct {
+	// DryRun performs all parsing and rule matching but writes nothing.
+	DryRun bool
+
+	// Log, if not nil, receives the messages of the rewriter and the
+	// progress of RewriteDir.
+	Log *Logger
+
+	// Reporter, if not nil, receives every file changed by the rewriter.
+	Reporter Reporter
+
+	// Explain tells a Reporter which is an Explainer the rule behind every
+	// change of the files, to debug overlapping rules.
+	Explain bool
+
+	// Confirm, if not nil, is asked whether to write every changed file, in
+	// walking order. A declined file is skipped, and returning ErrStop stops
+	// the run.
+	Confirm func(path string, src, dst []byte) (bool, error)
+
+	// SkipSuffixes lists the file name suffixes which are never rewritten.
+	SkipSuffixes []string
+
+	// Exclude lists glob patterns of the files and directories which are not
+	// rewritten, matched against their slash separated path relative to the
+	// walked directory. "**" matches any number of path elements, and a
+	// pattern without a slash matches the base name at any depth.
+	Exclude []string
+
+	// Include, if not empty, restricts the rewritten files to those matching
+	// any of its glob patterns, in the syntax of Exclude.
+	Include []string
+
+	// RenameSelectors renames the package qualifiers of the selector
+	// expressions in a file, when the package name implied by a rewritten
+	// unnamed import changes. The old name is kept as an import alias if the
+	// new one is already in use.
+	RenameSelectors bool
+
+	// AliasPreserve aliases the rewritten unnamed imports whose package name
+	// changes with the old name, so no code has to be touched.
+	AliasPreserve bool
+
+	// PruneUnused deletes the imports of the rewritten golang source files
+	// which no code refers to anymore once rewritten, as goimports does, by
+	// scanning the identifiers of the file rather than loading its types.
+	PruneUnused bool
+
+	// Atomic makes RewriteDir write either all of the rewritten files or
+	// none of them: files are only written once every file is rewritten in
+	// memory, and are all restored if one of the writes fails.
+	Atomic bool
+
+	// Journal records the files written by RewriteDir in the JournalFile of
+	// the walked directory, replacing the journal of the previous run, so
+	// that Undo can revert them.
+	Journal bool
+
+	// PreserveTimes sets the modification time of the written files back to
+	// the one they had, for build systems keyed on it. Files are always
+	// written in place, keeping their owner, group and permissions.
+	PreserveTimes bool
+
+	// BackupDir, if set, is the directory where RewriteDir copies the old
+	// content of the files it writes, in a new directory named after the
+	// time of every run, mirroring their path relative to the walked
+	// directory. A relative BackupDir is relative to the walked directory,
+	// which is not rewritten. See DefaultBackupDir and RestoreBackup.
+	BackupDir string
+
+	// KeepBackups, if positive, is the number of the latest backup runs kept
+	// in BackupDir, the older ones being removed.
+	KeepBackups int
+
+	// Cache makes RewriteDir skip the files found unchanged by a previous
+	// run with the same rules and options, as long as their content is the
+	// same, recording them in the CacheFile of the walked directory. It only
+	// applies to files on disk, and not to Typed runs.
+	Cache bool
+
+	// GitTracked restricts RewriteDir to the files tracked by git.
+	GitTracked bool
+
+	// RespectGitignore also skips the untracked paths git ignores when the
+	// walked directory is inside a git worktree, as told by its .gitignore
+	// files, those of the parent directories included, .git/info/exclude
+	// and core.excludesFile.
+	RespectGitignore bool
+
+	// LocalPrefixes lists the import path prefixes grouped after the third
+	// party packages in rewritten files, as goimports -local does.
+	LocalPrefixes []string
+
+	// MinimalDiff only changes the lines holding a rewritten import path:
+	// the paths and names of the imports are replaced in place and the lines
+	// of the merged imports deleted, their declaration being neither sorted
+	// nor formatted again.
+	MinimalDiff bool
+
+	// Strict stops RewriteDir at the first file failing to be rewritten, and
+	// restores the files already rewritten by it.
+	Strict bool
+
+	// DropImportComments removes the canonical import path annotation of
+	// package clauses, as in package foo // import "example.com/foo",
+	// instead of rewriting it.
+	DropImportComments bool
+
+	// GenerateDirectives also rewrites the import and module paths found in
+	// //go:generate directives.
+	GenerateDirectives bool
+
+	// Strings also rewrites the string literals holding an import path
+	// matched by the rules as a whole. Every rewritten literal is listed in
+	// the summary, since it might not refer to a package at all.
+	Strings bool
+
+	// RewriteGenerated also rewrites the files marked as generated code by a
+	// "// Code generated ... DO NOT EDIT." comment, which are skipped by
+	// default.
+	RewriteGenerated bool
+
+	// FS is the file system walked and rewritten, the disk if nil. Typed,
+	// Verify, GitTracked, Journal, BackupDir and PreserveTimes, which run
+	// commands on the files or write other files, require the disk.
+	FS FileSystem
+
+	// FollowSymlinks makes RewriteDir walk the directories and rewrite the
+	// files reached through symlinks, each real path being walked once.
+	// Otherwise they are skipped as SkipSymlink.
+	FollowSymlinks bool
+
+	// Testdata is the policy for the files under testdata directories,
+	// ignored by the go tool: TestdataRewrite, the default, rewrites them
+	// like any other file; TestdataSkip doesn't walk them at all.
+	Testdata string
+
+	// Tests is the policy for the _test.go files: TestsInclude, the
+	// default, rewrites them like any other file; TestsOnly only rewrites
+	// them, leaving every other file alone; TestsSkip never rewrites them,
+	// such as to keep the tests importing an old package for a while.
+	Tests string
+
+	// FailOnParseError makes the golang source files which fail to be parsed
+	// fail, rather than being skipped as SkipParseError. Files under testdata
+	// directories are always skipped, since test data is often invalid on
+	// purpose.
+	FailOnParseError bool
+
+	// IncludeVendor also walks vendor directories, rewriting the vendored
+	// golang source files and vendor/modules.txt.
+	IncludeVendor bool
+
+	// IgnoreWorkspace also rewrites the directories outside of the modules
+	// used by the go.work file of the walked directory, which are left
+	// alone by default, as they are with GOWORK=off.
+	IgnoreWorkspace bool
+
+	// FileTypes lists the types of the files rewritten, golang source files
+	// only by default. See Types for the known types.
+	FileTypes []string
+
+	// Modules, if not empty, restricts RewriteDir to the files of the
+	// modules whose go.mod file is in one of its directories, relative to
+	// the walked directory. The files of a nested module belong to that
+	// module only.
+	Modules []string
+
+	// Typed makes RewriteDir load the packages of the walked directory with
+	// go/packages, along with their dependencies. An import matched by a rule
+	// is then only rewritten if the module providing it is the one moved by
+	// the rule, not one of its nested modules or other major versions. Once
+	// written, the packages are type checked again, and all files are
+	// restored if they have errors they didn't have before. Typed implies
+	// Atomic.
+	Typed bool
+
+	// Verify, VerifyBuild or VerifyVet, runs go build or go vet on the
+	// packages of every module with files written by RewriteDir, and
+	// restores all files if it fails. Verify implies Atomic.
+	Verify string
+
+	// GoMod also rewrites the module paths in go.mod files found by RewriteDir,
+	// and those of the go.work and go.work.sum files of workspaces.
+	GoMod bool
+
+	// Tidy and Vendor have RunModCommands run go mod tidy and go mod vendor
+	// in the modules with changed files.
+	Tidy   bool
+	Vendor bool
+
+	// Jobs is the number of files rewritten concurrently by RewriteDir.
+	// Zero means the number of CPUs.
+	Jobs int
+
+	// MaxDepth, if positive, is the number of directory levels walked under
+	// the directory of RewriteDir: 1 only rewrites its own files, 2 those of
+	// its subdirectories too.
+	MaxDepth int
+
+	// MaxFileSize, if positive, is the size in bytes above which files are
+	// skipped rather than read, such as huge generated files.
+	MaxFileSize int64
+
+	// MaxFiles, if positive, is the number of files above which RewriteDir
+	// fails before rewriting any of them, when pointed at a directory much
+	// larger than intended.
+	MaxFiles int
+
+	rules   []Rule
+	policy  []Policy
+	custom  []Handler
+	tracked map[string]bool
+	modules map[string]module
+	typed   *typedInfo
+	renamed *packageRename
+	bumped  *majorBump
+	forked  *moduleFork
+	ignores map[string][]ignoreList
+	gitIgn  map[string]bool
+	cache   *fileCache
+	root    string
+	builds  map[string]constraint.Expr
+	pkgName map[string]string
+	work    *workspace
+
+	mu      sync.Mutex
+	summary summary
 }
 
-func exitOnErr(err error) {
-	log.Println(err)
-	os.Exit(255)
-}
-
-var handle = func(path string, info os.FileInfo, errx error) error {
-	if errx != nil {
-		return errx
-	}
-
-	if info.IsDir() {
-		return nil
-	}
-
-	if strings.Contains(path, "vendor") {
-		return nil
+// NewRewriter returns a Rewriter without any replace rule.
+func NewRewriter() *Rewriter {
+	return &Rewriter{
+		SkipSuffixes: append([]string(nil), codeSuffixSkipped...),
 	}
+}
 
-	filename := info.Name()
-	if !strings.HasSuffix(filename, ".go") {
-		return nil
+// Add appends the rule to the replace rules of the rewriter. It fails if a
+// rule added before matches all the import paths of rule, which would then
+// never apply.
+func (r *Rewriter) Add(rule Rule) error {
+	if err := rule.validate(); err != nil {
+		return err
 	}
 
-	for _, skip := range codeSuffixSkipped {
-		if strings.HasSuffix(filename, skip) {
-			return nil
+	for i := range r.rules {
+		if r.rules[i].shadows(&rule) {
+			return fmt.Errorf("rule %s never applies, rule %s added before matches all of its paths", rule.located(), r.rules[i].located())
 		}
 	}
 
-	if err := rewriteImport(path); err != nil {
-		return err
-	}
-
+	r.rules = append(r.rules, rule)
 	return nil
 }
 
-func importPath(s *ast.ImportSpec) string {
-	t, err := strconv.Unquote(s.Path.Value)
-	if err != nil {
-		return ""
-	}
-	return t
+// AddRule adds a rule which replaces the import path prefix source with dest.
+func (r *Rewriter) AddRule(source, dest string) error {
+	return r.Add(Rule{Source: source, Dest: dest, Mode: MatchPrefix})
 }
 
-func importName(s *ast.ImportSpec) string {
-	if s.Name == nil {
-		return ""
-	}
-	return s.Name.Name
-}
-
-func rewriteImport(path string) error {
-	var errx error
-	defer func() {
-		if errx != nil {
-			log.Printf("rewrite import fails with %s due to %s", path, errx)
-		}
-	}()
-
-	f, err := os.Open(path)
-	if err != nil {
-		errx = err
-		return nil
-	}
-	defer f.Close()
-
-	var perm os.FileMode
-	if fi, err := f.Stat(); err == nil {
-		perm = fi.Mode().Perm()
-	} else {
-		errx = err
-		return nil
-	}
-
-	src, err := ioutil.ReadAll(f)
-	if err != nil {
-		errx = err
-		return nil
-	}
-
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
-	if err != nil {
-		errx = err
-		return nil
-	}
-
-	replacers := make([]*replacer, 0)
-	imports := astutil.Imports(fset, file)
-	for _, grp := range imports {
-		for _, imp := range grp {
-			impPath := importPath(imp)
-			for pre, will := range replaceRules {
-				if strings.HasPrefix(impPath, pre) {
-					np := fmt.Sprintf("%s%s", will, strings.TrimPrefix(impPath, pre))
-					op := impPath
-					replacer := &replacer{oldPath: op, newPath: np, name: importName(imp)}
-					replacers = append(replacers, replacer)
-				}
-			}
-
+// Reverse replaces every rule of the rewriter with its reverse, so that
+// rewriting again undoes a previous run. The rules are left alone if one of
+// them can't be reversed.
+func (r *Rewriter) Reverse() error {
+	rules := r.rules
+	r.rules = nil
+	for _, rule := range rules {
+		rev, err := rule.Reverse()
+		if err == nil {
+			err = r.Add(rev)
 		}
-	}
-
-	for _, r := range replacers {
-		if !astutil.DeleteNamedImport(fset, file, r.name, r.oldPath) {
-			errx = fmt.Errorf("delete old path fails")
-			return nil
-		}
-
-		if !astutil.AddNamedImport(fset, file, r.name, r.newPath) {
-			errx = fmt.Errorf("add new path fails")
-			return nil
+		if err != nil {
+			r.rules = rules
+			return err
 		}
 	}
-
-	var dst bytes.Buffer
-	cfg := printer.Config{Mode: printerMode, Tabwidth: tabWidth}
-	if err := cfg.Fprint(&dst, fset, file); err != nil {
-		errx = err
-		return nil
-	}
-
-	bs, err := format.Source(dst.Bytes())
-	if err != nil {
-		errx = err
-		return nil
-	}
-
-	// backup first
-	backname, err := backupFile(path+".", src, perm)
-	if err != nil {
-		errx = err
-		return nil
-	}
-
-	// write content to file
-	if err := ioutil.WriteFile(path, bs, perm); err != nil {
-		os.Rename(backname, path)
-		errx = err
-		return nil
-	}
-
-	// delete backup file
-	if err := os.Remove(backname); err != nil {
-		errx = err
-		return nil
-	}
-
 	return nil
 }
 
-func backupFile(filename string, data []byte, perm os.FileMode) (string, error) {
-	backfile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
-	if err != nil {
-		return "", err
-	}
-
-	backname := backfile.Name()
-
-	if chmodSupported {
-		err = backfile.Chmod(perm)
-		if err != nil {
-			backfile.Close()
-			os.Remove(backname)
-			return backname, err
-		}
-	}
-
-	if _, err := backfile.Write(data); err != nil {
-		return backname, err
-	}
-
-	if err := backfile.Close(); err != nil {
-		return backname, err
-	}
-
-	return backname, nil
-
+// Rules returns a copy of the replace rules in the order they were added.
+func (r *Rewriter) Rules() []Rule {
+	return append([]Rule(nil), r.rules...)
 }
 
-func initReplaceRules() {
-	replaceRules = map[string]string{
-		*source: *dest,
+// match returns the index of the first rule matching path in the file, and
+// the path replaced by it. The rules scoped to some files don't apply
+// outside of any file, when file is empty, and the rules which don't
+// rewrite paths only apply to golang source files.
+func (r *Rewriter) match(file, path string) (int, string, bool) {
+	rel := ""
+	for i := range r.rules {
+		if !r.rules[i].rewrites() || !r.appliesTo(&r.rules[i], file, &rel) {
+			continue
+		}
+		if np, ok := r.rules[i].apply(path); ok && !r.otherMajor(i, path) && !r.otherModule(i, path) {
+			return i, np, true
+		}
 	}
+	return -1, "", false
 }
 
-func main() {
-	if *dir == "" {
-		exitOnErr(fmt.Errorf("you must specify a directory to handle"))
+// appliesTo reports whether the rule applies to file, rel caching the path
+// of file relative to the walked directory across the rules.
+func (r *Rewriter) appliesTo(rule *Rule, file string, rel *string) bool {
+	if !rule.scoped() {
+		return true
 	}
-
-	if *source == "" || *dest == "" {
-		exitOnErr(fmt.Errorf("you must specify a source or destination import path to handle"))
+	if file == "" {
+		return false
 	}
-
-	initReplaceRules()
-
-	if err := filepath.Walk(*dir, handle); err != nil {
-		exitOnErr(err)
+	if *rel == "" {
+		*rel = relPath(r.root, file)
 	}
+	return rule.inScope(*rel) && r.inBuild(rule, file)
 }